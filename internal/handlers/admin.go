@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/jo-sobo/qvoch/internal/logging"
+	"github.com/jo-sobo/qvoch/internal/sfu"
+)
+
+var adminLog = logging.For(logging.HTTP)
+
+const maxAdminBodySize = 4096
+
+type adminMessageRequest struct {
+	Message string `json:"message"`
+}
+
+type adminLastNRequest struct {
+	Speakers int `json:"speakers"`
+}
+
+type adminREDRequest struct {
+	Enabled bool `json:"enabled"`
+}
+
+type adminPTTRequest struct {
+	Mode string `json:"mode"`
+}
+
+type adminRevokeRequest struct {
+	PeerID string `json:"peerId"`
+	RoomID string `json:"roomId"`
+	All    bool   `json:"all"`
+}
+
+// NewAdminHandler returns the /admin/api handler for hub. It does no
+// authentication of its own; main wraps it in the bearer token middleware.
+//
+//	GET    /admin/api/rooms              rooms, sub-channels, peers, invites
+//	POST   /admin/api/peers/{id}/kick    remove a peer and revoke its session
+//	POST   /admin/api/peers/{id}/mute    mute a peer server-side
+//	POST   /admin/api/peers/{id}/unmute  clear a moderator mute
+//	POST   /admin/api/rooms/{id}/close   close a room or sub-channel
+//	POST   /admin/api/rooms/{id}/last-n  set last-N speaker forwarding (0 disables)
+//	POST   /admin/api/rooms/{id}/red     send Opus RED to every capable listener
+//	POST   /admin/api/rooms/{id}/ptt     set the push-to-talk mode (off, open, floor)
+//	DELETE /admin/api/invites/{token}    expire a room invite token or sub-channel invite
+//	POST   /admin/api/sessions/revoke    revoke sessions by peerId, roomId or all
+//	GET    /admin/api/recordings         recording manifests
+//	GET    /admin/api/recordings/{id}    download a finished recording as zip
+func NewAdminHandler(hub *sfu.Hub) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /admin/api/rooms", func(w http.ResponseWriter, r *http.Request) {
+		writeAdminJSON(w, http.StatusOK, hub.AdminSnapshot())
+	})
+
+	mux.HandleFunc("POST /admin/api/peers/{id}/kick", func(w http.ResponseWriter, r *http.Request) {
+		var req adminMessageRequest
+		if !decodeAdminBody(w, r, &req) {
+			return
+		}
+		peer, err := hub.KickPeer(r.PathValue("id"), req.Message)
+		if err != nil {
+			writeAdminError(w, err)
+			return
+		}
+		logAdminAction(r, "kick", "peer_id", peer.ID)
+		closeRemovedPeers([]*sfu.Peer{peer})
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	forceMute := func(muted bool) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			var req adminMessageRequest
+			if !decodeAdminBody(w, r, &req) {
+				return
+			}
+			peer, err := hub.ForceMute(r.PathValue("id"), muted, req.Message)
+			if err != nil {
+				writeAdminError(w, err)
+				return
+			}
+			logAdminAction(r, "force_mute", "peer_id", peer.ID, "muted", muted)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}
+	mux.HandleFunc("POST /admin/api/peers/{id}/mute", forceMute(true))
+	mux.HandleFunc("POST /admin/api/peers/{id}/unmute", forceMute(false))
+
+	mux.HandleFunc("POST /admin/api/rooms/{id}/close", func(w http.ResponseWriter, r *http.Request) {
+		var req adminMessageRequest
+		if !decodeAdminBody(w, r, &req) {
+			return
+		}
+		roomID := r.PathValue("id")
+		peers, err := hub.CloseRoom(roomID, req.Message)
+		if err != nil {
+			writeAdminError(w, err)
+			return
+		}
+		logAdminAction(r, "close_room", "room_id", roomID)
+		closeRemovedPeers(peers)
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	mux.HandleFunc("POST /admin/api/rooms/{id}/last-n", func(w http.ResponseWriter, r *http.Request) {
+		var req adminLastNRequest
+		if !decodeAdminBody(w, r, &req) {
+			return
+		}
+		room, err := hub.SetLastN(r.PathValue("id"), req.Speakers)
+		if err != nil {
+			writeAdminError(w, err)
+			return
+		}
+		logAdminAction(r, "set_last_n", "room_id", room.ID, "speakers", req.Speakers)
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	mux.HandleFunc("POST /admin/api/rooms/{id}/red", func(w http.ResponseWriter, r *http.Request) {
+		var req adminREDRequest
+		if !decodeAdminBody(w, r, &req) {
+			return
+		}
+		room, err := hub.SetRED(r.PathValue("id"), req.Enabled)
+		if err != nil {
+			writeAdminError(w, err)
+			return
+		}
+		logAdminAction(r, "set_red", "room_id", room.ID, "enabled", req.Enabled)
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	mux.HandleFunc("POST /admin/api/rooms/{id}/ptt", func(w http.ResponseWriter, r *http.Request) {
+		var req adminPTTRequest
+		if !decodeAdminBody(w, r, &req) {
+			return
+		}
+		room, err := hub.SetPTTMode(r.PathValue("id"), req.Mode)
+		if err != nil {
+			writeAdminError(w, err)
+			return
+		}
+		logAdminAction(r, "set_ptt_mode", "room_id", room.ID, "mode", req.Mode)
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	mux.HandleFunc("DELETE /admin/api/invites/{token}", func(w http.ResponseWriter, r *http.Request) {
+		newToken, err := hub.ExpireInvite(r.PathValue("token"))
+		if err != nil {
+			writeAdminError(w, err)
+			return
+		}
+		logAdminAction(r, "expire_invite")
+		if newToken == "" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		writeAdminJSON(w, http.StatusOK, map[string]string{"inviteToken": newToken})
+	})
+
+	mux.HandleFunc("POST /admin/api/sessions/revoke", func(w http.ResponseWriter, r *http.Request) {
+		var req adminRevokeRequest
+		if !decodeAdminBody(w, r, &req) {
+			return
+		}
+		if req.PeerID == "" && req.RoomID == "" && !req.All {
+			writeAdminError(w, sfu.NewSignalError(sfu.ErrInvalidMessage, "Provide peerId, roomId or all=true"))
+			return
+		}
+		n := hub.RevokeSessions(req.PeerID, req.RoomID)
+		logAdminAction(r, "revoke_sessions", "peer_id", req.PeerID, "room_id", req.RoomID, "count", n)
+		writeAdminJSON(w, http.StatusOK, map[string]int{"revoked": n})
+	})
+
+	mux.HandleFunc("GET /admin/api/recordings", func(w http.ResponseWriter, r *http.Request) {
+		writeAdminJSON(w, http.StatusOK, hub.Recordings())
+	})
+
+	mux.HandleFunc("GET /admin/api/recordings/{id}", func(w http.ResponseWriter, r *http.Request) {
+		rec, err := hub.FinishedRecording(r.PathValue("id"))
+		if err != nil {
+			writeAdminError(w, err)
+			return
+		}
+		logAdminAction(r, "download_recording", "recording_id", rec.ID())
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="recording-%s.zip"`, rec.ID()))
+		if err := writeRecordingZip(w, rec); err != nil {
+			adminLog.Warn("recording download failed", "recording_id", rec.ID(), "err", err)
+		}
+	})
+
+	return mux
+}
+
+// writeRecordingZip streams the manifest and Ogg files of rec as a zip
+// archive.
+func writeRecordingZip(w io.Writer, rec *sfu.Recording) error {
+	manifest := rec.Manifest()
+	files := []string{"manifest.json"}
+	for _, track := range manifest.Tracks {
+		files = append(files, track.File)
+	}
+
+	zw := zip.NewWriter(w)
+	for _, name := range files {
+		f, err := os.Open(filepath.Join(rec.Dir(), name))
+		if err != nil {
+			return err
+		}
+		entry, err := zw.Create(name)
+		if err == nil {
+			_, err = io.Copy(entry, f)
+		}
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// closeRemovedPeers closes the WebSockets of peers removed by an operator. The
+// connection's read loop then runs the usual disconnect cleanup.
+func closeRemovedPeers(peers []*sfu.Peer) {
+	deadline := time.Now().Add(writeWait)
+	for _, p := range peers {
+		p.WriteClose(websocket.ClosePolicyViolation, "Removed by administrator", deadline)
+	}
+}
+
+func decodeAdminBody(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, maxAdminBodySize)
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil && !errors.Is(err, io.EOF) {
+		writeAdminError(w, sfu.NewSignalError(sfu.ErrInvalidMessage, "Invalid JSON body"))
+		return false
+	}
+	return true
+}
+
+func writeAdminJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeAdminError(w http.ResponseWriter, err error) {
+	sigErr := sfu.AsSignalError(err)
+	status := http.StatusInternalServerError
+	switch sigErr.Code {
+	case sfu.ErrUserNotFound, sfu.ErrChannelNotFound, sfu.ErrInviteExpired, sfu.ErrRecordingMissing:
+		status = http.StatusNotFound
+	case sfu.ErrInvalidMessage:
+		status = http.StatusBadRequest
+	}
+	writeAdminJSON(w, status, sigErr.Payload())
+}
+
+func logAdminAction(r *http.Request, action string, args ...any) {
+	adminLog.Info("admin action", append([]any{"action", action, "ip", extractIP(r)}, args...)...)
+}
@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"github.com/jo-sobo/qvoch/internal/logging"
+	"github.com/jo-sobo/qvoch/internal/metrics"
+)
+
+var signalingLog = logging.For(logging.Signaling)
+
+var (
+	securityEvents = metrics.NewCounterVec("qvoch_security_events_total",
+		"Events logged with the SECURITY message.", "event")
+	rateLimitViolations = metrics.NewCounterVec("qvoch_rate_limit_violations_total",
+		"Requests rejected by a rate limiter.", "limiter")
+)
+
+// RegisterMetrics exposes the signaling handler's counters on reg.
+func RegisterMetrics(reg *metrics.Registry) {
+	reg.MustRegister(securityEvents, rateLimitViolations)
+}
+
+// logSecurityEvent logs a SECURITY warning with the given key/value
+// attributes and counts it.
+func logSecurityEvent(event string, args ...any) {
+	securityEvents.WithLabelValues(event).Inc()
+	signalingLog.Warn("SECURITY", append([]any{"event", event}, args...)...)
+}
@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/jo-sobo/qvoch/internal/sfu"
+)
+
+// NewRecordingDownloadHandler serves the download links sent to room owners
+// in "recording-stopped" events. Unlike the admin API it needs no
+// ADMIN_TOKEN: the link's one-time token is bound to the owner's session.
+func NewRecordingDownloadHandler(hub *sfu.Hub) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		rec, err := hub.RedeemRecordingDownload(id, r.URL.Query().Get("token"))
+		if err != nil {
+			logSecurityEvent("recording_download_rejected", "recording_id", id, "ip", extractIP(r))
+			http.Error(w, "Download link is invalid or has expired", http.StatusNotFound)
+			return
+		}
+
+		adminLog.Info("owner recording download", "recording_id", rec.ID(), "ip", extractIP(r))
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="recording-%s.zip"`, rec.ID()))
+		if err := writeRecordingZip(w, rec); err != nil {
+			adminLog.Warn("recording download failed", "recording_id", rec.ID(), "err", err)
+		}
+	})
+}
@@ -1,12 +1,14 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
-	"log"
+	"errors"
 	"net"
 	"net/http"
 	"os"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -28,7 +30,7 @@ func init() {
 				allowedOrigins[o] = true
 			}
 		}
-		log.Printf("CORS: allowing origins %v", allowedOrigins)
+		signalingLog.Info("CORS: allowing origins", "origins", strings.Split(origins, ","))
 	}
 }
 
@@ -76,6 +78,15 @@ func (rl *rateLimiter) allow() bool {
 	return true
 }
 
+// retryAfter reports how long until the limiter refills.
+func (rl *rateLimiter) retryAfter() time.Duration {
+	remaining := time.Second - time.Since(rl.lastReset)
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
 var (
 	connLimiters   = make(map[string]*connLimiterEntry)
 	connLimitersMu sync.Mutex
@@ -142,18 +153,119 @@ const (
 	writeWait    = 10 * time.Second
 )
 
-func HandleWebSocket(w http.ResponseWriter, r *http.Request) {
+// WebSocketHandler serves /ws signaling for a hub and keeps track of open
+// connections so they can be drained on shutdown.
+type WebSocketHandler struct {
+	hub *sfu.Hub
+
+	mu             sync.Mutex
+	conns          map[*sfu.Peer]*websocket.Conn
+	shuttingDown   bool
+	reconnectAfter time.Duration
+	wg             sync.WaitGroup
+}
+
+// NewWebSocketHandler returns the /ws signaling handler bound to hub.
+func NewWebSocketHandler(hub *sfu.Hub) *WebSocketHandler {
+	return &WebSocketHandler{
+		hub:   hub,
+		conns: make(map[*sfu.Peer]*websocket.Conn),
+	}
+}
+
+func (h *WebSocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	if h.shuttingDown {
+		retryAfter := int((h.reconnectAfter + time.Second - 1) / time.Second)
+		h.mu.Unlock()
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		http.Error(w, "Server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	h.wg.Add(1)
+	h.mu.Unlock()
+	defer h.wg.Done()
+
+	h.serve(w, r)
+}
+
+// Shutdown stops accepting new upgrades, sends a server-shutdown envelope to
+// every connected client, drains the hub's PeerConnections and then closes
+// the WebSockets. It returns once all connection handlers have exited or ctx
+// is done, in which case remaining connections are closed forcibly.
+func (h *WebSocketHandler) Shutdown(ctx context.Context, reconnectAfter time.Duration) error {
+	h.mu.Lock()
+	h.shuttingDown = true
+	h.reconnectAfter = reconnectAfter
+	peers := make([]*sfu.Peer, 0, len(h.conns))
+	for p := range h.conns {
+		peers = append(peers, p)
+	}
+	h.mu.Unlock()
+
+	signalingLog.Info("shutdown: notifying connected clients", "clients", len(peers))
+	notice := sfu.ServerShutdownPayload{
+		Reason:           "restart",
+		ReconnectAfterMs: reconnectAfter.Milliseconds(),
+	}
+	for _, p := range peers {
+		p.SendJSON("server-shutdown", notice)
+	}
+
+	if err := h.hub.Shutdown(ctx); err != nil {
+		signalingLog.Warn("shutdown: hub drain incomplete", "err", err)
+	}
+
+	deadline := time.Now().Add(writeWait)
+	for _, p := range peers {
+		p.WriteClose(websocket.CloseServiceRestart, "Server restarting", deadline)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		h.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		h.mu.Lock()
+		for _, conn := range h.conns {
+			conn.Close()
+		}
+		h.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+func (h *WebSocketHandler) trackConn(peer *sfu.Peer, conn *websocket.Conn) {
+	h.mu.Lock()
+	h.conns[peer] = conn
+	h.mu.Unlock()
+}
+
+func (h *WebSocketHandler) untrackConn(peer *sfu.Peer) {
+	h.mu.Lock()
+	delete(h.conns, peer)
+	h.mu.Unlock()
+}
+
+func (h *WebSocketHandler) serve(w http.ResponseWriter, r *http.Request) {
+	hub := h.hub
 	ip := extractIP(r)
 
 	if !allowConnection(ip) {
-		log.Printf("SECURITY: conn_rate_limit ip=%s", ip)
+		rateLimitViolations.WithLabelValues("connection").Inc()
+		logSecurityEvent("conn_rate_limit", "ip", ip)
 		http.Error(w, "Too many connections", http.StatusTooManyRequests)
 		return
 	}
 
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Printf("websocket upgrade error: %v", err)
+		signalingLog.Warn("websocket upgrade failed", "ip", ip, "err", err)
 		return
 	}
 
@@ -163,7 +275,8 @@ func HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 		Conn: conn,
 	}
 
-	log.Printf("peer connected: %s ip=%s", peerID, ip)
+	h.trackConn(peer, conn)
+	signalingLog.Info("peer connected", "peer_id", peerID, "ip", ip)
 
 	// Ping/pong keepalive: set read deadline and pong handler
 	conn.SetReadDeadline(time.Now().Add(pongWait))
@@ -191,13 +304,12 @@ func HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 
 	defer func() {
 		close(pingDone)
-		hub := sfu.GetHub()
+		h.untrackConn(peer)
 		hub.RemovePeer(peer, true)
 		conn.Close()
-		log.Printf("peer disconnected: %s", peerID)
+		signalingLog.Info("peer disconnected", "peer_id", peerID)
 	}()
 
-	hub := sfu.GetHub()
 	limiter := newRateLimiter(30)
 	violations := 0
 
@@ -205,15 +317,16 @@ func HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 		_, message, err := conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
-				log.Printf("peer %s: read error: %v", peerID, err)
+				signalingLog.Warn("websocket read failed", "peer_id", peerID, "err", err)
 			}
 			break
 		}
 
 		if !limiter.allow() {
+			rateLimitViolations.WithLabelValues("message").Inc()
 			violations++
 			if violations >= 50 {
-				log.Printf("SECURITY: rate_abuse ip=%s peer=%s violations=%d", ip, peerID, violations)
+				logSecurityEvent("rate_abuse", "ip", ip, "peer_id", peerID, "violations", violations)
 				conn.WriteControl(
 					websocket.CloseMessage,
 					websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "Too many requests"),
@@ -221,13 +334,14 @@ func HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 				)
 				break
 			}
-			peer.SendError(sfu.ErrInvalidMessage, "Rate limit exceeded")
+			peer.SendSignalError(sfu.NewSignalError(sfu.ErrRateLimited, "Rate limit exceeded").
+				WithRetryAfter(limiter.retryAfter()))
 			continue
 		}
 
 		var env sfu.Envelope
 		if err := json.Unmarshal(message, &env); err != nil {
-			log.Printf("SECURITY: malformed_json ip=%s peer=%s", ip, peerID)
+			logSecurityEvent("malformed_json", "ip", ip, "peer_id", peerID)
 			peer.SendError(sfu.ErrInvalidMessage, "Invalid JSON message")
 			continue
 		}
@@ -245,6 +359,8 @@ func HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 			handleChat(hub, peer, env.Payload)
 		case "mute":
 			handleMute(hub, peer, env.Payload)
+		case "publish-video":
+			handlePublishVideo(hub, peer, env.Payload)
 		case "sub-invite":
 			handleSubInvite(hub, peer, env.Payload)
 		case "sub-response":
@@ -253,6 +369,40 @@ func HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 			hub.HandleMoveToMain(peer)
 		case "move-to-sub":
 			handleMoveToSub(hub, peer, env.Payload)
+		case "recording-start":
+			handleRecordingControl(hub, peer, env.Payload, true)
+		case "recording-stop":
+			handleRecordingControl(hub, peer, env.Payload, false)
+		case "recording-consent":
+			handleRecordingConsent(hub, peer, env.Payload)
+		case "stats":
+			handleStats(hub, peer)
+		case "ptt-start":
+			if err := hub.StartTalk(peer); err != nil {
+				peer.SendSignalError(err)
+			}
+		case "ptt-stop":
+			hub.StopTalk(peer)
+		case "ptt-mode":
+			handlePTTMode(hub, peer, env.Payload)
+		case "force-mute":
+			handleForceMute(hub, peer, env.Payload)
+		case "whisper-start":
+			handleWhisperStart(hub, peer, env.Payload)
+		case "whisper-stop":
+			hub.StopWhisper(peer)
+		case "listen-start":
+			handleListenStart(hub, peer, env.Payload)
+		case "listen-response":
+			handleListenResponse(hub, peer, env.Payload)
+		case "listen-stop":
+			hub.StopListening(peer)
+		case "all-call-start":
+			if err := hub.StartAllCall(peer); err != nil {
+				peer.SendSignalError(err)
+			}
+		case "all-call-stop":
+			hub.StopAllCall(peer)
 		case "leave":
 			hub.RemovePeer(peer, false)
 		default:
@@ -307,12 +457,16 @@ func handleCreate(hub *sfu.Hub, peer *sfu.Peer, payload json.RawMessage, ip stri
 
 	peer.Name = username
 
-	room, err := hub.CreateRoom(p.ChannelName, p.Password, peer, ip)
+	room, err := hub.CreateRoom(p.ChannelName, p.Password, p.AudioProfile, peer, ip)
 	if err != nil {
-		if strings.Contains(err.Error(), "full") || strings.Contains(err.Error(), "limit") {
-			log.Printf("SECURITY: room_limit ip=%s detail=%s", ip, err.Error())
+		var sigErr *sfu.SignalError
+		if errors.As(err, &sigErr) && (sigErr.Code == sfu.ErrServerFull || sigErr.Code == sfu.ErrRateLimited) {
+			if sigErr.Code == sfu.ErrRateLimited {
+				rateLimitViolations.WithLabelValues("room_create").Inc()
+			}
+			logSecurityEvent("room_limit", "ip", ip, "peer_id", peer.ID, "code", sigErr.Code, "retry_after", sigErr.RetryAfter)
 		}
-		peer.SendError(sfu.ErrInternalError, err.Error())
+		peer.SendSignalError(err)
 		return
 	}
 
@@ -324,12 +478,12 @@ func handleCreate(hub *sfu.Hub, peer *sfu.Peer, payload json.RawMessage, ip stri
 	peer.SendJSON("welcome", welcome)
 
 	if err := hub.CreatePeerConnection(peer, room); err != nil {
-		log.Printf("failed to create peer connection for %s: %v", peer.ID, err)
+		signalingLog.Error("create peer connection failed", "peer_id", peer.ID, "room_id", room.ID, "err", err)
 		return
 	}
 	go func() {
 		if err := hub.NegotiateOffer(peer, true); err != nil {
-			log.Printf("failed to send offer to %s: %v", peer.ID, err)
+			signalingLog.Warn("initial offer failed", "peer_id", peer.ID, "room_id", room.ID, "err", err)
 		}
 	}()
 }
@@ -360,48 +514,20 @@ func handleJoin(hub *sfu.Hub, peer *sfu.Peer, payload json.RawMessage, ip string
 
 	room, sessionToken, reconnectNotice, err := hub.JoinRoom(p, peer)
 	if err != nil {
-		errMsg := err.Error()
-		code := sfu.ErrInternalError
-		msg := errMsg
-		for i := 0; i < len(errMsg); i++ {
-			if errMsg[i] == ':' {
-				code = errMsg[:i]
-				msg = errMsg[i+1:]
-				break
-			}
+		var sigErr *sfu.SignalError
+		if errors.As(err, &sigErr) && sigErr.Code == sfu.ErrPasswordWrong {
+			logSecurityEvent("wrong_password", "ip", ip, "peer_id", peer.ID, "channel", p.ChannelName)
 		}
-		if code == sfu.ErrPasswordWrong {
-			log.Printf("SECURITY: wrong_password ip=%s channel=%s", ip, p.ChannelName)
-		}
-		peer.SendError(code, msg)
+		peer.SendSignalError(err)
 		return
 	}
 
-	log.Printf("peer %s: join from ip=%s", peer.ID, ip)
+	signalingLog.Info("peer joined", "peer_id", peer.ID, "room_id", room.ID, "ip", ip)
 
 	welcome := hub.BuildWelcomePayload(peer, room, sessionToken, reconnectNotice)
 	peer.SendJSON("welcome", welcome)
 
-	hub.RemoveTrackFromPeers(peer, room)
-	hub.ClosePeerConnection(peer)
-
-	if err := hub.CreatePeerConnection(peer, room); err != nil {
-		log.Printf("failed to create peer connection for %s: %v", peer.ID, err)
-	} else {
-		hub.AddTrackToPeers(peer, room)
-		go func(target *sfu.Peer, targetRoom *sfu.Room) {
-			if err := hub.NegotiateOffer(target, true); err != nil {
-				log.Printf("failed to send initial offer to %s: %v", target.ID, err)
-				return
-			}
-
-			if hub.AddRoomTracksToPeer(target, targetRoom) {
-				if err := hub.NegotiateOffer(target, false); err != nil {
-					log.Printf("failed to send room-track offer to %s: %v", target.ID, err)
-				}
-			}
-		}(peer, room)
-	}
+	hub.SetupPeerMedia(peer, room)
 
 	hub.BroadcastRoomUpdatePublic(room)
 }
@@ -421,6 +547,101 @@ func handleMoveToSub(hub *sfu.Hub, peer *sfu.Peer, payload json.RawMessage) {
 	hub.HandleMoveToSub(peer, p.SubChannelID)
 }
 
+func handleRecordingControl(hub *sfu.Hub, peer *sfu.Peer, payload json.RawMessage, start bool) {
+	var p sfu.RecordingControlPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		peer.SendError(sfu.ErrInvalidMessage, "Invalid recording payload")
+		return
+	}
+
+	var err error
+	if start {
+		err = hub.StartRecording(peer, p.ChannelID)
+	} else {
+		err = hub.StopRecording(peer, p.ChannelID)
+	}
+	if err != nil {
+		peer.SendSignalError(err)
+	}
+}
+
+func handlePTTMode(hub *sfu.Hub, peer *sfu.Peer, payload json.RawMessage) {
+	var p sfu.PTTModePayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		peer.SendError(sfu.ErrInvalidMessage, "Invalid ptt-mode payload")
+		return
+	}
+
+	if err := hub.HandlePTTMode(peer, p.ChannelID, p.Mode); err != nil {
+		peer.SendSignalError(err)
+	}
+}
+
+func handleForceMute(hub *sfu.Hub, peer *sfu.Peer, payload json.RawMessage) {
+	var p sfu.ForceMuteRequestPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		peer.SendError(sfu.ErrInvalidMessage, "Invalid force-mute payload")
+		return
+	}
+
+	if err := hub.HandleForceMute(peer, p.TargetUserID, p.Muted); err != nil {
+		peer.SendSignalError(err)
+	}
+}
+
+func handleWhisperStart(hub *sfu.Hub, peer *sfu.Peer, payload json.RawMessage) {
+	var p sfu.WhisperStartPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		peer.SendError(sfu.ErrInvalidMessage, "Invalid whisper-start payload")
+		return
+	}
+
+	if err := hub.StartWhisper(peer, p.Targets); err != nil {
+		peer.SendSignalError(err)
+	}
+}
+
+func handleListenStart(hub *sfu.Hub, peer *sfu.Peer, payload json.RawMessage) {
+	var p sfu.ListenPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		peer.SendError(sfu.ErrInvalidMessage, "Invalid listen-start payload")
+		return
+	}
+
+	if err := hub.StartListening(peer, p.ChannelID); err != nil {
+		peer.SendSignalError(err)
+	}
+}
+
+func handleListenResponse(hub *sfu.Hub, peer *sfu.Peer, payload json.RawMessage) {
+	var p sfu.ListenResponsePayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		peer.SendError(sfu.ErrInvalidMessage, "Invalid listen-response payload")
+		return
+	}
+
+	if err := hub.HandleListenResponse(peer, p.RequestID, p.Accepted); err != nil {
+		peer.SendSignalError(err)
+	}
+}
+
+func handleRecordingConsent(hub *sfu.Hub, peer *sfu.Peer, payload json.RawMessage) {
+	var p sfu.RecordingConsentPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		peer.SendError(sfu.ErrInvalidMessage, "Invalid recording-consent payload")
+		return
+	}
+
+	if p.RecordingID == "" {
+		peer.SendError(sfu.ErrInvalidMessage, "recordingId is required")
+		return
+	}
+
+	if err := hub.ConsentRecording(peer, p.RecordingID); err != nil {
+		peer.SendSignalError(err)
+	}
+}
+
 func handleAnswer(hub *sfu.Hub, peer *sfu.Peer, payload json.RawMessage) {
 	var p sfu.AnswerPayload
 	if err := json.Unmarshal(payload, &p); err != nil {
@@ -429,13 +650,13 @@ func handleAnswer(hub *sfu.Hub, peer *sfu.Peer, payload json.RawMessage) {
 	}
 
 	if len(p.SDP) > 100_000 {
-		log.Printf("SECURITY: oversized_sdp peer=%s size=%d", peer.ID, len(p.SDP))
+		logSecurityEvent("oversized_sdp", "peer_id", peer.ID, "size", len(p.SDP))
 		peer.SendError(sfu.ErrInvalidMessage, "SDP too large")
 		return
 	}
 
 	if err := hub.HandleAnswer(peer, p.SDP, p.Seq, p.Epoch); err != nil {
-		log.Printf("peer %s: handle answer error: %v", peer.ID, err)
+		signalingLog.Warn("handle answer failed", "peer_id", peer.ID, "epoch", p.Epoch, "seq", p.Seq, "err", err)
 	}
 }
 
@@ -447,13 +668,13 @@ func handleCandidate(hub *sfu.Hub, peer *sfu.Peer, payload json.RawMessage) {
 	}
 
 	if len(p.Candidate) > 2_000 {
-		log.Printf("SECURITY: oversized_candidate peer=%s size=%d", peer.ID, len(p.Candidate))
+		logSecurityEvent("oversized_candidate", "peer_id", peer.ID, "size", len(p.Candidate))
 		peer.SendError(sfu.ErrInvalidMessage, "Candidate too large")
 		return
 	}
 
 	if err := hub.HandleICECandidate(peer, p.Candidate, p.SDPMid, p.SDPMLineIndex, p.Seq, p.Epoch); err != nil {
-		log.Printf("peer %s: handle candidate error: %v", peer.ID, err)
+		signalingLog.Warn("handle candidate failed", "peer_id", peer.ID, "epoch", p.Epoch, "seq", p.Seq, "err", err)
 	}
 }
 
@@ -481,6 +702,29 @@ func handleMute(hub *sfu.Hub, peer *sfu.Peer, payload json.RawMessage) {
 	hub.HandleMute(peer, p.Muted)
 }
 
+func handlePublishVideo(hub *sfu.Hub, peer *sfu.Peer, payload json.RawMessage) {
+	var p sfu.PublishVideoPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		peer.SendError(sfu.ErrInvalidMessage, "Invalid publish-video payload")
+		return
+	}
+
+	if err := hub.HandlePublishVideo(peer, p.Source, p.Enabled); err != nil {
+		peer.SendSignalError(err)
+	}
+}
+
+// handleStats answers with the peer's connection stats, or null while it
+// has no media connection.
+func handleStats(hub *sfu.Hub, peer *sfu.Peer) {
+	stats, ok := hub.ConnectionStats(peer)
+	if !ok {
+		peer.SendJSON("stats", nil)
+		return
+	}
+	peer.SendJSON("stats", stats)
+}
+
 func handleSubInvite(hub *sfu.Hub, peer *sfu.Peer, payload json.RawMessage) {
 	var p sfu.SubInvitePayload
 	if err := json.Unmarshal(payload, &p); err != nil {
@@ -0,0 +1,150 @@
+// Package logging configures log/slog for the server. Output format and
+// levels come from the environment:
+//
+//	LOG_FORMAT  text (default) or json
+//	LOG_LEVEL   debug, info (default), warn or error
+//	LOG_LEVELS  per-subsystem overrides, e.g. "media=warn,signaling=debug"
+//
+// Subsystems obtain their logger with For; every record carries a
+// "subsystem" attribute and is filtered by that subsystem's level.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+const (
+	Signaling = "signaling"
+	Media     = "media"
+	Hub       = "hub"
+	HTTP      = "http"
+)
+
+var (
+	base         slog.Handler
+	defaultLevel = new(slog.LevelVar)
+
+	levelsMu sync.Mutex
+	levels   = make(map[string]*slog.LevelVar)
+)
+
+func init() {
+	if err := Configure(os.Stderr, os.Getenv("LOG_FORMAT"), os.Getenv("LOG_LEVEL"), os.Getenv("LOG_LEVELS")); err != nil {
+		fmt.Fprintf(os.Stderr, "logging: %v\n", err)
+	}
+}
+
+// Configure replaces the output handler and levels. It is called from init
+// with the environment; loggers returned by For before or after pick up the
+// new levels, while the output format applies to loggers created afterwards.
+func Configure(w io.Writer, format, level, subsystemLevels string) error {
+	var errs []string
+
+	lvl, err := parseLevel(level, slog.LevelInfo)
+	if err != nil {
+		errs = append(errs, err.Error())
+	}
+	defaultLevel.Set(lvl)
+
+	opts := &slog.HandlerOptions{Level: slog.LevelDebug}
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "json":
+		base = slog.NewJSONHandler(w, opts)
+	case "", "text":
+		base = slog.NewTextHandler(w, opts)
+	default:
+		base = slog.NewTextHandler(w, opts)
+		errs = append(errs, fmt.Sprintf("unknown LOG_FORMAT %q, using text", format))
+	}
+
+	levelsMu.Lock()
+	for _, v := range levels {
+		v.Set(lvl)
+	}
+	for _, entry := range strings.Split(subsystemLevels, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			errs = append(errs, fmt.Sprintf("invalid LOG_LEVELS entry %q", entry))
+			continue
+		}
+		subLevel, err := parseLevel(value, lvl)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		levelVarLocked(strings.TrimSpace(name)).Set(subLevel)
+	}
+	levelsMu.Unlock()
+
+	// Route the standard library logger (used by dependencies) through slog.
+	slog.SetDefault(slog.New(&levelHandler{level: defaultLevel, next: base}))
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// For returns the logger for a subsystem.
+func For(subsystem string) *slog.Logger {
+	levelsMu.Lock()
+	lvl := levelVarLocked(subsystem)
+	levelsMu.Unlock()
+
+	return slog.New(&levelHandler{level: lvl, next: base}).With("subsystem", subsystem)
+}
+
+func levelVarLocked(subsystem string) *slog.LevelVar {
+	if v, ok := levels[subsystem]; ok {
+		return v
+	}
+	v := new(slog.LevelVar)
+	v.Set(defaultLevel.Level())
+	levels[subsystem] = v
+	return v
+}
+
+func parseLevel(raw string, fallback slog.Level) (slog.Level, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return fallback, nil
+	}
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(raw)); err != nil {
+		return fallback, fmt.Errorf("invalid log level %q", raw)
+	}
+	return lvl, nil
+}
+
+// levelHandler filters records by a per-subsystem level before handing them
+// to the shared output handler.
+type levelHandler struct {
+	level slog.Leveler
+	next  slog.Handler
+}
+
+func (h *levelHandler) Enabled(_ context.Context, l slog.Level) bool {
+	return l >= h.level.Level()
+}
+
+func (h *levelHandler) Handle(ctx context.Context, r slog.Record) error {
+	return h.next.Handle(ctx, r)
+}
+
+func (h *levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &levelHandler{level: h.level, next: h.next.WithAttrs(attrs)}
+}
+
+func (h *levelHandler) WithGroup(name string) slog.Handler {
+	return &levelHandler{level: h.level, next: h.next.WithGroup(name)}
+}
@@ -0,0 +1,266 @@
+// Package metrics is a minimal Prometheus text-format exporter. It covers the
+// handful of metric types the server needs (counters, labelled counters,
+// gauge callbacks and histograms) without pulling in client_golang.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Collector is implemented by every metric type in this package.
+type Collector interface {
+	write(w *bufio.Writer)
+}
+
+type Registry struct {
+	mu         sync.Mutex
+	collectors []Collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) MustRegister(cs ...Collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, cs...)
+}
+
+// Handler serves all registered metrics in the Prometheus text format.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		r.mu.Lock()
+		collectors := make([]Collector, len(r.collectors))
+		copy(collectors, r.collectors)
+		r.mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		bw := bufio.NewWriter(w)
+		for _, c := range collectors {
+			c.write(bw)
+		}
+		bw.Flush()
+	})
+}
+
+type Counter struct {
+	name string
+	help string
+	val  atomic.Uint64
+}
+
+func NewCounter(name, help string) *Counter {
+	return &Counter{name: name, help: help}
+}
+
+func (c *Counter) Inc() {
+	c.val.Add(1)
+}
+
+func (c *Counter) Add(n uint64) {
+	c.val.Add(n)
+}
+
+func (c *Counter) Value() uint64 {
+	return c.val.Load()
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	writeHeader(w, c.name, c.help, "counter")
+	fmt.Fprintf(w, "%s %d\n", c.name, c.val.Load())
+}
+
+// CounterVec is a family of counters partitioned by label values.
+type CounterVec struct {
+	name     string
+	help     string
+	labels   []string
+	mu       sync.RWMutex
+	children map[string]*vecChild
+}
+
+type vecChild struct {
+	values  []string
+	counter *Counter
+}
+
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{
+		name:     name,
+		help:     help,
+		labels:   labels,
+		children: make(map[string]*vecChild),
+	}
+}
+
+// WithLabelValues returns the counter for the given label values, creating it
+// on first use. Hot paths should hold on to the returned counter.
+func (v *CounterVec) WithLabelValues(values ...string) *Counter {
+	key := strings.Join(values, "\xff")
+
+	v.mu.RLock()
+	child, ok := v.children[key]
+	v.mu.RUnlock()
+	if ok {
+		return child.counter
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if child, ok := v.children[key]; ok {
+		return child.counter
+	}
+	child = &vecChild{
+		values:  append([]string(nil), values...),
+		counter: &Counter{name: v.name},
+	}
+	v.children[key] = child
+	return child.counter
+}
+
+// Delete drops the series for the given label values so label sets tied to
+// short-lived objects (rooms) don't accumulate forever.
+func (v *CounterVec) Delete(values ...string) {
+	key := strings.Join(values, "\xff")
+	v.mu.Lock()
+	delete(v.children, key)
+	v.mu.Unlock()
+}
+
+func (v *CounterVec) write(w *bufio.Writer) {
+	v.mu.RLock()
+	children := make([]*vecChild, 0, len(v.children))
+	for _, c := range v.children {
+		children = append(children, c)
+	}
+	v.mu.RUnlock()
+
+	sort.Slice(children, func(i, j int) bool {
+		return strings.Join(children[i].values, "\xff") < strings.Join(children[j].values, "\xff")
+	})
+
+	writeHeader(w, v.name, v.help, "counter")
+	for _, c := range children {
+		fmt.Fprintf(w, "%s%s %d\n", v.name, formatLabels(v.labels, c.values), c.counter.Value())
+	}
+}
+
+// GaugeFunc reports the value returned by fn at scrape time.
+type GaugeFunc struct {
+	name string
+	help string
+	fn   func() float64
+}
+
+func NewGaugeFunc(name, help string, fn func() float64) *GaugeFunc {
+	return &GaugeFunc{name: name, help: help, fn: fn}
+}
+
+func (g *GaugeFunc) write(w *bufio.Writer) {
+	writeHeader(w, g.name, g.help, "gauge")
+	fmt.Fprintf(w, "%s %s\n", g.name, formatFloat(g.fn()))
+}
+
+type Histogram struct {
+	name    string
+	help    string
+	buckets []float64
+	mu      sync.Mutex
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func NewHistogram(name, help string, buckets []float64) *Histogram {
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+	return &Histogram{
+		name:    name,
+		help:    help,
+		buckets: sorted,
+		counts:  make([]uint64, len(sorted)),
+	}
+}
+
+func (h *Histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, upper := range h.buckets {
+		if v <= upper {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.mu.Lock()
+	counts := append([]uint64(nil), h.counts...)
+	sum := h.sum
+	count := h.count
+	h.mu.Unlock()
+
+	writeHeader(w, h.name, h.help, "histogram")
+	for i, upper := range h.buckets {
+		fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", h.name, formatFloat(upper), counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", h.name, count)
+	fmt.Fprintf(w, "%s_sum %s\n", h.name, formatFloat(sum))
+	fmt.Fprintf(w, "%s_count %d\n", h.name, count)
+}
+
+func writeHeader(w *bufio.Writer, name, help, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, typ)
+}
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		val := ""
+		if i < len(values) {
+			val = values[i]
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabelValue(val))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(v string) string {
+	return labelEscaper.Replace(v)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
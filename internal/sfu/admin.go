@@ -0,0 +1,467 @@
+package sfu
+
+import (
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AdminRoom is the operator view of a main room or sub-channel.
+type AdminRoom struct {
+	ID           string      `json:"id"`
+	Name         string      `json:"name"`
+	FullName     string      `json:"fullName,omitempty"`
+	InviteToken  string      `json:"inviteToken,omitempty"`
+	CreatedAt    time.Time   `json:"createdAt"`
+	Expiry       *time.Time  `json:"expiry,omitempty"`
+	Sessions     int         `json:"sessions"`
+	AudioProfile string      `json:"audioProfile"`
+	LastN        int         `json:"lastN,omitempty"`
+	RED          bool        `json:"red,omitempty"`
+	PTT          *PTTInfo    `json:"ptt,omitempty"`
+	Listeners    []string    `json:"listeners,omitempty"`
+	Peers        []AdminPeer `json:"peers"`
+	SubChannels  []AdminRoom `json:"subChannels,omitempty"`
+}
+
+// AdminPeer is the operator view of a peer, including WebRTC state.
+type AdminPeer struct {
+	ID              string           `json:"id"`
+	Name            string           `json:"name"`
+	Muted           bool             `json:"muted"`
+	ForceMuted      bool             `json:"forceMuted"`
+	Publishing      []string         `json:"publishing,omitempty"`
+	ConnectionState string           `json:"connectionState"`
+	ICEState        string           `json:"iceState"`
+	SignalingState  string           `json:"signalingState"`
+	Epoch           uint64           `json:"epoch"`
+	OfferSeq        uint64           `json:"offerSeq"`
+	Stats           *ConnectionStats `json:"stats,omitempty"`
+}
+
+// AdminPendingInvite is the operator view of a sub-channel invite.
+type AdminPendingInvite struct {
+	ID          string    `json:"id"`
+	RoomID      string    `json:"roomId"`
+	FromPeerID  string    `json:"fromPeerId"`
+	ToPeerID    string    `json:"toPeerId"`
+	ChannelName string    `json:"channelName"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// AdminSnapshot is the full live state returned by the admin API.
+type AdminSnapshot struct {
+	Rooms          []AdminRoom          `json:"rooms"`
+	PendingInvites []AdminPendingInvite `json:"pendingInvites"`
+}
+
+// Reasons sent in the "removed" envelope.
+const (
+	RemovedReasonKicked        = "kicked"
+	RemovedReasonRoomClosed    = "room-closed"
+	RemovedReasonChannelClosed = "channel-closed"
+)
+
+// AdminSnapshot returns rooms, sub-channels, peers and pending invites.
+func (h *Hub) AdminSnapshot() AdminSnapshot {
+	h.mu.RLock()
+	mainRooms := make([]*Room, 0, len(h.Rooms))
+	for _, room := range h.Rooms {
+		if room.ParentID == "" {
+			mainRooms = append(mainRooms, room)
+		}
+	}
+	sessionsByRoom := make(map[string]int)
+	for _, p := range h.SessionMap {
+		p.mu.RLock()
+		sessionsByRoom[p.MainRoomID]++
+		p.mu.RUnlock()
+	}
+	invites := make([]AdminPendingInvite, 0, len(h.PendingInvites))
+	for _, inv := range h.PendingInvites {
+		invites = append(invites, AdminPendingInvite{
+			ID:          inv.ID,
+			RoomID:      inv.MainRoom.ID,
+			FromPeerID:  inv.FromPeer.ID,
+			ToPeerID:    inv.ToPeer.ID,
+			ChannelName: inv.ChannelName,
+			CreatedAt:   inv.CreatedAt,
+		})
+	}
+	h.mu.RUnlock()
+
+	snap := AdminSnapshot{
+		Rooms:          make([]AdminRoom, 0, len(mainRooms)),
+		PendingInvites: invites,
+	}
+	for _, room := range mainRooms {
+		room.mu.RLock()
+		ar := adminRoomLocked(room)
+		ar.FullName = room.FullName
+		ar.InviteToken = room.InviteToken
+		ar.Sessions = sessionsByRoom[room.ID]
+		for _, sub := range room.SubChannels {
+			sub.mu.RLock()
+			ar.SubChannels = append(ar.SubChannels, adminRoomLocked(sub))
+			sub.mu.RUnlock()
+		}
+		room.mu.RUnlock()
+		sort.Slice(ar.SubChannels, func(i, j int) bool {
+			return ar.SubChannels[i].CreatedAt.Before(ar.SubChannels[j].CreatedAt)
+		})
+		snap.Rooms = append(snap.Rooms, ar)
+	}
+	sort.Slice(snap.Rooms, func(i, j int) bool {
+		return snap.Rooms[i].CreatedAt.Before(snap.Rooms[j].CreatedAt)
+	})
+	return snap
+}
+
+func adminRoomLocked(room *Room) AdminRoom {
+	ar := AdminRoom{
+		ID:           room.ID,
+		Name:         room.Name,
+		CreatedAt:    room.CreatedAt,
+		AudioProfile: room.AudioProfile,
+		Peers:        make([]AdminPeer, 0, len(room.Peers)),
+	}
+	if !room.Expiry.IsZero() {
+		expiry := room.Expiry
+		ar.Expiry = &expiry
+	}
+	if room.lastN != nil {
+		ar.LastN = room.lastN.size()
+	}
+	ar.RED = room.red
+	ar.PTT = room.pttInfoLocked()
+	ar.Listeners = room.listenerIDsLocked()
+	for _, p := range room.Peers {
+		ar.Peers = append(ar.Peers, adminPeer(p))
+	}
+	sort.Slice(ar.Peers, func(i, j int) bool { return ar.Peers[i].Name < ar.Peers[j].Name })
+	return ar
+}
+
+func adminPeer(p *Peer) AdminPeer {
+	p.mu.RLock()
+	ap := AdminPeer{
+		ID:              p.ID,
+		Name:            p.Name,
+		Muted:           p.Muted,
+		ForceMuted:      p.ForceMuted,
+		Publishing:      p.publishingLocked(),
+		Epoch:           p.Epoch,
+		OfferSeq:        p.OfferSeq,
+		ConnectionState: "none",
+		ICEState:        "none",
+		SignalingState:  "none",
+	}
+	pc := p.PC
+	sample := p.quality
+	p.mu.RUnlock()
+
+	if pc != nil {
+		ap.ConnectionState = pc.ConnectionState().String()
+		ap.ICEState = pc.ICEConnectionState().String()
+		ap.SignalingState = pc.SignalingState().String()
+		if !sample.at.IsZero() {
+			stats := newConnectionStats(sample, pc)
+			ap.Stats = &stats
+		}
+	}
+	return ap
+}
+
+// findPeer looks a connected peer up by ID across all rooms and sub-channels.
+func (h *Hub) findPeer(peerID string) *Peer {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for _, room := range h.Rooms {
+		if room.ParentID != "" {
+			continue
+		}
+		room.mu.RLock()
+		for _, p := range room.AllPeersInMainAndSubs() {
+			if p.ID == peerID {
+				room.mu.RUnlock()
+				return p
+			}
+		}
+		room.mu.RUnlock()
+	}
+	return nil
+}
+
+// findRoom looks a main room or sub-channel up by ID.
+func (h *Hub) findRoom(roomID string) *Room {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if room, ok := h.Rooms[roomID]; ok {
+		return room
+	}
+	for _, room := range h.Rooms {
+		if room.ParentID != "" {
+			continue
+		}
+		room.mu.RLock()
+		sub, ok := room.SubChannels[roomID]
+		room.mu.RUnlock()
+		if ok {
+			return sub
+		}
+	}
+	return nil
+}
+
+// KickPeer removes a peer from its room through RemovePeer, drops its session
+// so it cannot reconnect with it, and sends a "removed" envelope. The caller
+// is expected to close the WebSocket afterwards.
+func (h *Hub) KickPeer(peerID, message string) (*Peer, error) {
+	peer := h.findPeer(peerID)
+	if peer == nil {
+		return nil, NewSignalError(ErrUserNotFound, "Peer not found")
+	}
+
+	peer.SendJSON("removed", RemovedPayload{Reason: RemovedReasonKicked, Message: message})
+	h.RemovePeer(peer, false)
+
+	hubLog.Info("admin: peer kicked", "peer_id", peerID)
+	return peer, nil
+}
+
+// ForceMute sets or clears a moderator mute on a peer. While it is set the
+// peer's audio is dropped by the server and the peer cannot unmute itself.
+func (h *Hub) ForceMute(peerID string, muted bool, message string) (*Peer, error) {
+	peer := h.findPeer(peerID)
+	if peer == nil {
+		return nil, NewSignalError(ErrUserNotFound, "Peer not found")
+	}
+
+	if h.setForceMuted(peer, muted, message) {
+		hubLog.Info("admin: peer force-mute changed", "peer_id", peerID, "muted", muted)
+	}
+	return peer, nil
+}
+
+// HandleForceMute sets or clears a moderator mute on targetID on behalf of
+// peer, who must be able to manage the channel the target is in. The room
+// owner cannot be muted by a sub-channel's owner.
+func (h *Hub) HandleForceMute(peer *Peer, targetID string, muted bool) error {
+	mainRoom, _, err := h.channelForPeer(peer, "")
+	if err != nil {
+		return err
+	}
+
+	var target *Peer
+	mainRoom.mu.RLock()
+	for _, p := range mainRoom.AllPeersInMainAndSubs() {
+		if p.ID == targetID {
+			target = p
+		}
+	}
+	mainRoom.mu.RUnlock()
+	if target == nil {
+		return NewSignalError(ErrUserNotFound, "User not found")
+	}
+
+	target.RLock()
+	channelID := target.RoomID
+	target.RUnlock()
+	_, channel, err := h.channelForPeer(peer, channelID)
+	if err != nil {
+		return err
+	}
+	mainRoom.mu.RLock()
+	targetIsOwner := mainRoom.OwnerID == targetID
+	mainRoom.mu.RUnlock()
+	if !canManage(peer, mainRoom, channel) || (targetIsOwner && targetID != peer.ID) {
+		return NewSignalError(ErrNotOwner, "Only the room or channel owner can mute others")
+	}
+
+	peer.RLock()
+	name := peer.Name
+	peer.RUnlock()
+	message := name + " unmuted you."
+	if muted {
+		message = name + " muted you."
+	}
+	if h.setForceMuted(target, muted, message) {
+		hubLog.Info("peer force-mute changed", "peer_id", peer.ID, "target_id", targetID, "muted", muted)
+	}
+	return nil
+}
+
+// setForceMuted applies a moderator mute and, if that changed anything,
+// tells the peer and updates its room. It reports whether it changed.
+func (h *Hub) setForceMuted(peer *Peer, muted bool, message string) bool {
+	peer.mu.Lock()
+	changed := peer.ForceMuted != muted
+	peer.ForceMuted = muted
+	mainRoomID := peer.MainRoomID
+	peer.mu.Unlock()
+
+	if !changed {
+		return false
+	}
+
+	peer.SendJSON("force-mute", ForceMutePayload{Muted: muted, Message: message})
+
+	h.mu.RLock()
+	mainRoom, ok := h.Rooms[mainRoomID]
+	h.mu.RUnlock()
+	if ok {
+		h.broadcastRoomUpdate(mainRoom)
+	}
+	return true
+}
+
+// CloseRoom closes a main room or sub-channel. Members of a main room are
+// notified and removed through RemovePeer, their sessions revoked and the
+// room deleted; members of a sub-channel are moved back to the main room.
+// It returns the peers that were removed from the server so the caller can
+// close their WebSockets.
+func (h *Hub) CloseRoom(roomID, message string) ([]*Peer, error) {
+	h.mu.Lock()
+	room, ok := h.Rooms[roomID]
+	if !ok {
+		h.mu.Unlock()
+		return h.closeSubChannel(roomID, message)
+	}
+
+	// Unlist the room first so nobody can join while members are removed.
+	room.mu.RLock()
+	peers := room.AllPeersInMainAndSubs()
+	room.mu.RUnlock()
+	delete(h.RoomsByName, room.FullName)
+	delete(h.InviteMap, room.InviteToken)
+	h.revokeSessionsLocked(func(p *Peer) bool { return p.MainRoomID == roomID })
+	for id, inv := range h.PendingInvites {
+		if inv.MainRoom == room {
+			inv.Timer.Stop()
+			delete(h.PendingInvites, id)
+		}
+	}
+	h.mu.Unlock()
+
+	notice := RemovedPayload{Reason: RemovedReasonRoomClosed, Message: message}
+	for _, p := range peers {
+		p.SendJSON("removed", notice)
+	}
+	for _, p := range peers {
+		h.RemovePeer(p, false)
+	}
+
+	h.mu.Lock()
+	delete(h.Rooms, roomID)
+	h.mu.Unlock()
+	h.metrics.forgetRoom(roomID)
+	h.deleteRecordings(roomID)
+
+	hubLog.Info("admin: room closed", "room_id", roomID, "room_name", room.FullName, "peers", len(peers))
+	return peers, nil
+}
+
+func (h *Hub) closeSubChannel(subID, message string) ([]*Peer, error) {
+	h.mu.RLock()
+	var sub *Room
+	for _, room := range h.Rooms {
+		if room.ParentID != "" {
+			continue
+		}
+		room.mu.RLock()
+		if s, ok := room.SubChannels[subID]; ok {
+			sub = s
+		}
+		room.mu.RUnlock()
+		if sub != nil {
+			break
+		}
+	}
+	h.mu.RUnlock()
+
+	if sub == nil {
+		return nil, NewSignalError(ErrChannelNotFound, "Room not found")
+	}
+
+	sub.mu.RLock()
+	peers := make([]*Peer, 0, len(sub.Peers))
+	for _, p := range sub.Peers {
+		peers = append(peers, p)
+	}
+	sub.mu.RUnlock()
+
+	notice := RemovedPayload{Reason: RemovedReasonChannelClosed, Message: message}
+	for _, p := range peers {
+		p.SendJSON("removed", notice)
+		h.HandleMoveToMain(p)
+	}
+
+	hubLog.Info("admin: sub-channel closed", "room_id", subID, "peers", len(peers))
+	return nil, nil
+}
+
+// ExpireInvite invalidates a room invite token or a pending sub-channel
+// invite ID. A room's invite token is replaced by a fresh one, which is
+// returned, so members can still share the room.
+func (h *Hub) ExpireInvite(token string) (string, error) {
+	h.mu.Lock()
+	if room, ok := h.InviteMap[token]; ok {
+		newToken := uuid.New().String()
+		delete(h.InviteMap, token)
+		room.mu.Lock()
+		room.InviteToken = newToken
+		room.mu.Unlock()
+		h.InviteMap[newToken] = room
+		h.mu.Unlock()
+
+		hubLog.Info("admin: invite token rotated", "room_id", room.ID)
+		return newToken, nil
+	}
+
+	inv, ok := h.PendingInvites[token]
+	if !ok {
+		h.mu.Unlock()
+		return "", NewSignalError(ErrInviteExpired, "Invite not found")
+	}
+	inv.Timer.Stop()
+	delete(h.PendingInvites, token)
+	h.mu.Unlock()
+
+	expired := InviteExpiredPayload{InviteID: token, Reason: "revoked"}
+	inv.FromPeer.SendJSON("invite-expired", expired)
+	inv.ToPeer.SendJSON("invite-expired", expired)
+
+	hubLog.Info("admin: sub-channel invite expired", "room_id", inv.MainRoom.ID)
+	return "", nil
+}
+
+// RevokeSessions drops session tokens so the affected peers cannot reconnect
+// with them. An empty peerID and roomID revokes every session. Connected
+// peers stay connected.
+func (h *Hub) RevokeSessions(peerID, roomID string) int {
+	h.mu.Lock()
+	n := h.revokeSessionsLocked(func(p *Peer) bool {
+		return (peerID == "" || p.ID == peerID) && (roomID == "" || p.MainRoomID == roomID)
+	})
+	h.mu.Unlock()
+
+	hubLog.Info("admin: sessions revoked", "peer_id", peerID, "room_id", roomID, "count", n)
+	return n
+}
+
+func (h *Hub) revokeSessionsLocked(match func(p *Peer) bool) int {
+	n := 0
+	for token, p := range h.SessionMap {
+		p.mu.RLock()
+		matched := match(p)
+		p.mu.RUnlock()
+		if matched {
+			delete(h.SessionMap, token)
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,61 @@
+package sfu
+
+import (
+	"errors"
+	"testing"
+)
+
+func forceMuted(p *Peer) bool {
+	p.RLock()
+	defer p.RUnlock()
+	return p.ForceMuted
+}
+
+func signalCode(err error) string {
+	var sigErr *SignalError
+	if errors.As(err, &sigErr) {
+		return sigErr.Code
+	}
+	return ""
+}
+
+func TestHandleForceMuteIsOwnerGated(t *testing.T) {
+	h, _ := newTestHub(t)
+	_, peers := newTestRoom(t, h, "alice", "bob", "carol", "dave")
+	alice, bob, carol, dave := peers[0], peers[1], peers[2], peers[3]
+
+	if err := h.HandleForceMute(bob, carol.ID, true); signalCode(err) != ErrNotOwner {
+		t.Fatalf("member force-muted another member: %v", err)
+	}
+	if err := h.HandleForceMute(alice, "nobody", true); signalCode(err) != ErrUserNotFound {
+		t.Fatalf("unknown user: %v", err)
+	}
+
+	if err := h.HandleForceMute(alice, bob.ID, true); err != nil {
+		t.Fatalf("owner force-mute: %v", err)
+	}
+	if !forceMuted(bob) {
+		t.Fatal("bob is not force-muted")
+	}
+	// Bob's own unmute does not lift it.
+	h.HandleMute(bob, false)
+	if !forceMuted(bob) {
+		t.Fatal("self-unmute cleared the force-mute")
+	}
+	if err := h.HandleForceMute(alice, bob.ID, false); err != nil || forceMuted(bob) {
+		t.Fatalf("owner could not clear the force-mute: %v", err)
+	}
+
+	// A sub-channel's owner manages its members only, and not the room owner.
+	sub := openSubChannel(t, h, carol, dave)
+	if err := h.HandleForceMute(carol, dave.ID, true); err != nil || !forceMuted(dave) {
+		t.Fatalf("sub-channel owner could not mute its member: %v", err)
+	}
+	if err := h.HandleForceMute(carol, bob.ID, true); signalCode(err) != ErrNotOwner {
+		t.Fatalf("sub-channel owner muted a main room member: %v", err)
+	}
+	h.HandleMoveToSub(alice, sub.ID)
+	if err := h.HandleForceMute(carol, alice.ID, true); signalCode(err) != ErrNotOwner || forceMuted(alice) {
+		t.Fatalf("sub-channel owner muted the room owner: %v", err)
+	}
+}
@@ -0,0 +1,188 @@
+package sfu
+
+import "github.com/pion/webrtc/v3"
+
+// An all-call lets the room owner address every channel at once during
+// breakouts. The owner's audio track is added to every PeerConnection in the
+// main room and its sub-channels until the all-call ends; clients receive an
+// "all-call" event so they can duck everyone else.
+
+// allCallTrack returns the announcer's audio track while an all-call is
+// running in peer's main room, or nil.
+func (h *Hub) allCallTrack(peer *Peer) *ForwardTrack {
+	peer.RLock()
+	mainRoomID := peer.MainRoomID
+	peer.RUnlock()
+
+	h.mu.RLock()
+	mainRoom, ok := h.Rooms[mainRoomID]
+	h.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+
+	mainRoom.mu.RLock()
+	announcer := mainRoom.allCall
+	mainRoom.mu.RUnlock()
+	if announcer == nil || announcer == peer {
+		return nil
+	}
+
+	announcer.RLock()
+	defer announcer.RUnlock()
+	return announcer.Track
+}
+
+// addAllCallTrack gives target a sender for the running all-call, if any.
+// Like AddRoomTracksToPeer it does not renegotiate.
+func (h *Hub) addAllCallTrack(target *Peer) bool {
+	track := h.allCallTrack(target)
+	if track == nil {
+		return false
+	}
+	target.RLock()
+	pc := target.PC
+	target.RUnlock()
+	if pc == nil || hasSenderForTrack(pc, track) {
+		return false
+	}
+
+	transceiver, err := pc.AddTransceiverFromTrack(track, webrtc.RTPTransceiverInit{
+		Direction: webrtc.RTPTransceiverDirectionSendonly,
+	})
+	if err != nil {
+		mediaLog.Warn("add all-call track failed", "peer_id", target.ID, "track_id", track.ID(), "err", err)
+		return false
+	}
+	if transceiver != nil && transceiver.Sender() != nil {
+		h.readSenderRTCP(transceiver.Sender())
+	}
+	return true
+}
+
+// StartAllCall sends peer's voice to every channel of its main room. Only
+// the room owner can start one, and only one runs at a time. It ends when the
+// owner stops it, switches channel or leaves.
+func (h *Hub) StartAllCall(peer *Peer) error {
+	mainRoom, _, err := h.channelForPeer(peer, "")
+	if err != nil {
+		return err
+	}
+	if !canManage(peer, mainRoom, mainRoom) {
+		return NewSignalError(ErrNotOwner, "Only the room owner can make an all-call")
+	}
+
+	peer.RLock()
+	hasTrack := peer.Track != nil
+	peer.RUnlock()
+	if !hasTrack {
+		return NewSignalError(ErrInvalidMessage, "No media connection")
+	}
+
+	mainRoom.mu.Lock()
+	switch mainRoom.allCall {
+	case peer:
+		mainRoom.mu.Unlock()
+		return nil
+	case nil:
+	default:
+		mainRoom.mu.Unlock()
+		return NewSignalError(ErrFloorTaken, "Another all-call is in progress")
+	}
+	mainRoom.allCall = peer
+	all := mainRoom.AllPeersInMainAndSubs()
+	mainRoom.mu.Unlock()
+
+	peer.Lock()
+	peer.announcing = true
+	peer.Unlock()
+
+	for _, p := range all {
+		if p != peer && h.addAllCallTrack(p) {
+			go func(target *Peer) {
+				if err := h.NegotiateOffer(target, false); err != nil {
+					signalingLog.Warn("all-call offer failed", "peer_id", target.ID, "err", err)
+				}
+			}(p)
+		}
+	}
+
+	payload := AllCallPayload{From: peer.ID, Active: true}
+	for _, p := range all {
+		p.SendJSON("all-call", payload)
+	}
+	hubLog.Info("all-call started", "peer_id", peer.ID, "room_id", mainRoom.ID)
+	return nil
+}
+
+// StopAllCall ends peer's all-call.
+func (h *Hub) StopAllCall(peer *Peer) {
+	h.endAllCall(peer)
+}
+
+// endAllCall ends peer's all-call, if it is running one, and removes its
+// track from every channel but its own the way RemoveTrackFromPeers does.
+// Peers listening in on its channel get the track back.
+func (h *Hub) endAllCall(peer *Peer) {
+	peer.Lock()
+	announcing := peer.announcing
+	peer.announcing = false
+	track := peer.Track
+	mainRoomID := peer.MainRoomID
+	peer.Unlock()
+	if !announcing {
+		return
+	}
+
+	h.mu.RLock()
+	mainRoom, ok := h.Rooms[mainRoomID]
+	h.mu.RUnlock()
+	if !ok {
+		return
+	}
+
+	mainRoom.mu.Lock()
+	if mainRoom.allCall == peer {
+		mainRoom.allCall = nil
+	}
+	channels := make([]*Room, 0, 1+len(mainRoom.SubChannels))
+	channels = append(channels, mainRoom)
+	for _, sub := range mainRoom.SubChannels {
+		channels = append(channels, sub)
+	}
+	all := mainRoom.AllPeersInMainAndSubs()
+	mainRoom.mu.Unlock()
+
+	current := h.currentRoom(peer)
+	if track != nil {
+		for _, ch := range channels {
+			// Last-N channels hear the announcer on slot tracks again.
+			if ch != current || ch.selector() != nil {
+				h.removeTracksFromRoomPeers(peer, ch, []*ForwardTrack{track})
+			}
+		}
+	}
+	if current != nil {
+		current.mu.RLock()
+		listeners := make([]*Peer, 0, len(current.listeners))
+		for _, p := range current.listeners {
+			listeners = append(listeners, p)
+		}
+		current.mu.RUnlock()
+		for _, p := range listeners {
+			if h.addListenTracks(p) {
+				go func(target *Peer) {
+					if err := h.NegotiateOffer(target, false); err != nil {
+						signalingLog.Warn("listen-in offer after all-call failed", "peer_id", target.ID, "err", err)
+					}
+				}(p)
+			}
+		}
+	}
+
+	payload := AllCallPayload{From: peer.ID, Active: false}
+	for _, p := range all {
+		p.SendJSON("all-call", payload)
+	}
+	hubLog.Info("all-call ended", "peer_id", peer.ID, "room_id", mainRoomID)
+}
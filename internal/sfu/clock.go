@@ -0,0 +1,138 @@
+package sfu
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock is the time source used by the hub for timestamps and timers.
+// Production code uses RealClock; tests can substitute a FakeClock to drive
+// sub-channel countdowns, invite expiry and GC deterministically.
+type Clock interface {
+	Now() time.Time
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is the subset of *time.Timer the hub relies on.
+type Timer interface {
+	Stop() bool
+}
+
+type realClock struct{}
+
+// RealClock returns a Clock backed by the time package.
+func RealClock() Clock {
+	return realClock{}
+}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+// FakeClock is a manually advanced Clock. Timer callbacks run synchronously
+// inside Advance, in deadline order, so callers observe their effects as soon
+// as Advance returns.
+type FakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	nextID uint64
+	timers map[uint64]*fakeTimer
+}
+
+type fakeTimer struct {
+	clock *FakeClock
+	id    uint64
+	when  time.Time
+	fn    func()
+}
+
+func NewFakeClock(start time.Time) *FakeClock {
+	return &FakeClock{
+		now:    start,
+		timers: make(map[uint64]*fakeTimer),
+	}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *FakeClock) AfterFunc(d time.Duration, f func()) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.nextID++
+	t := &fakeTimer{
+		clock: c,
+		id:    c.nextID,
+		when:  c.now.Add(d),
+		fn:    f,
+	}
+	c.timers[t.id] = t
+	return t
+}
+
+// Advance moves the clock forward by d, firing every timer whose deadline is
+// reached along the way. Timers scheduled by callbacks are honored if they
+// fall within the advanced window.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	target := c.now.Add(d)
+	c.mu.Unlock()
+
+	for {
+		c.mu.Lock()
+		due := c.dueTimersLocked(target)
+		if len(due) == 0 {
+			c.now = target
+			c.mu.Unlock()
+			return
+		}
+		next := due[0]
+		delete(c.timers, next.id)
+		c.now = next.when
+		c.mu.Unlock()
+
+		next.fn()
+	}
+}
+
+// PendingTimers reports how many timers are scheduled and not yet fired.
+func (c *FakeClock) PendingTimers() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+func (c *FakeClock) dueTimersLocked(target time.Time) []*fakeTimer {
+	due := make([]*fakeTimer, 0)
+	for _, t := range c.timers {
+		if !t.when.After(target) {
+			due = append(due, t)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		if due[i].when.Equal(due[j].when) {
+			return due[i].id < due[j].id
+		}
+		return due[i].when.Before(due[j].when)
+	})
+	return due
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	if _, ok := t.clock.timers[t.id]; !ok {
+		return false
+	}
+	delete(t.clock.timers, t.id)
+	return true
+}
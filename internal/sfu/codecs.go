@@ -0,0 +1,143 @@
+package sfu
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// Audio profiles select the Opus parameters offered to a room's clients.
+// Browsers encode according to the fmtp line in the server's offer, so the
+// profile decides what every publisher in the room sends.
+const (
+	AudioProfileVoice = "voice"
+	AudioProfileMusic = "music"
+)
+
+// CodecConfig selects the codecs registered with the MediaEngine. Video lists
+// the forwarded video codecs ("vp8", "vp9", "h264"); an empty list disables
+// video publishing. AudioProfile is the profile of new rooms that do not ask
+// for one; VoiceBitrate and MusicBitrate are the Opus maxaveragebitrate of
+// each profile in bits per second.
+type CodecConfig struct {
+	Video        []string
+	AudioProfile string
+	VoiceBitrate int
+	MusicBitrate int
+}
+
+func defaultVideoCodecs() []string {
+	return []string{"vp8", "vp9", "h264"}
+}
+
+func loadCodecConfig() CodecConfig {
+	cfg := CodecConfig{
+		Video:        defaultVideoCodecs(),
+		AudioProfile: AudioProfileVoice,
+		VoiceBitrate: getEnvIntBounded("OPUS_VOICE_BITRATE", 32000, 6000, 510000),
+		MusicBitrate: getEnvIntBounded("OPUS_MUSIC_BITRATE", 128000, 6000, 510000),
+	}
+
+	if raw := strings.TrimSpace(strings.ToLower(os.Getenv("VIDEO_CODECS"))); raw != "" {
+		cfg.Video = nil
+		if raw != "none" {
+			for _, name := range strings.Split(raw, ",") {
+				name = strings.TrimSpace(name)
+				if _, ok := videoCodecParameters[name]; !ok {
+					mediaLog.Warn("VIDEO_CODECS: unknown codec ignored", "codec", name)
+					continue
+				}
+				cfg.Video = append(cfg.Video, name)
+			}
+		}
+	}
+
+	if profile := strings.TrimSpace(strings.ToLower(os.Getenv("AUDIO_PROFILE"))); profile != "" {
+		if validAudioProfile(profile) {
+			cfg.AudioProfile = profile
+		} else {
+			mediaLog.Warn("AUDIO_PROFILE: unknown profile, using voice", "profile", profile)
+		}
+	}
+	return cfg
+}
+
+func validAudioProfile(profile string) bool {
+	return profile == AudioProfileVoice || profile == AudioProfileMusic
+}
+
+// opusFmtp returns the Opus fmtp line offered for profile. Voice is mono
+// with DTX so silent participants cost almost nothing; music is stereo
+// without DTX so quiet passages are not gated. Both keep in-band FEC.
+func (c CodecConfig) opusFmtp(profile string) string {
+	if profile == AudioProfileMusic {
+		return fmt.Sprintf("minptime=10;useinbandfec=1;stereo=1;sprop-stereo=1;usedtx=0;maxaveragebitrate=%d", c.MusicBitrate)
+	}
+	return fmt.Sprintf("minptime=10;useinbandfec=1;stereo=0;usedtx=1;maxaveragebitrate=%d", c.VoiceBitrate)
+}
+
+// videoFeedback is registered with every video codec. NACK and PLI are added
+// by the default interceptors.
+var videoFeedback = []webrtc.RTCPFeedback{
+	{Type: "goog-remb"},
+	{Type: "ccm", Parameter: "fir"},
+}
+
+// videoCodecParameters are the video codecs the SFU can forward, with the
+// payload types and fmtp lines browsers use by default.
+var videoCodecParameters = map[string][]webrtc.RTPCodecParameters{
+	"vp8": {{
+		RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8, ClockRate: 90000, RTCPFeedback: videoFeedback},
+		PayloadType:        96,
+	}},
+	"vp9": {{
+		RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP9, ClockRate: 90000, SDPFmtpLine: "profile-id=0", RTCPFeedback: videoFeedback},
+		PayloadType:        98,
+	}},
+	"h264": {
+		{
+			RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeH264, ClockRate: 90000,
+				SDPFmtpLine: "level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42001f", RTCPFeedback: videoFeedback},
+			PayloadType: 102,
+		},
+		{
+			RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeH264, ClockRate: 90000,
+				SDPFmtpLine: "level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42e01f", RTCPFeedback: videoFeedback},
+			PayloadType: 125,
+		},
+	},
+}
+
+// registerCodecs registers Opus with profile's parameters, RED when red is
+// set and the configured video codecs, and nothing else, so offers only
+// advertise what the SFU forwards.
+func registerCodecs(me *webrtc.MediaEngine, cfg CodecConfig, profile string, red bool) error {
+	opus := webrtc.RTPCodecParameters{
+		RTPCodecCapability: webrtc.RTPCodecCapability{
+			MimeType:    webrtc.MimeTypeOpus,
+			ClockRate:   opusClockRate,
+			Channels:    2,
+			SDPFmtpLine: cfg.opusFmtp(profile),
+		},
+		PayloadType: opusPayloadType,
+	}
+	if err := me.RegisterCodec(opus, webrtc.RTPCodecTypeAudio); err != nil {
+		return fmt.Errorf("register opus: %w", err)
+	}
+	if red {
+		if err := me.RegisterCodec(redCodec, webrtc.RTPCodecTypeAudio); err != nil {
+			return fmt.Errorf("register red: %w", err)
+		}
+	}
+
+	for _, name := range cfg.Video {
+		for _, codec := range videoCodecParameters[name] {
+			if err := me.RegisterCodec(codec, webrtc.RTPCodecTypeVideo); err != nil {
+				return fmt.Errorf("register %s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
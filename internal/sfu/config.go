@@ -0,0 +1,186 @@
+package sfu
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the hub settings that were previously read from the
+// environment on first use. LoadConfig builds one from env vars; tests can
+// start from DefaultConfig and override fields directly.
+type Config struct {
+	MaxUsersPerRoom int
+	MaxRooms        int
+	ChatHistorySize int
+
+	WebRTC    WebRTCConfig
+	ICE       ICEConfig
+	TURN      TURNConfig
+	Speaking  SpeakingConfig
+	LastN     LastNConfig
+	Recording RecordingConfig
+	Codecs    CodecConfig
+	RED       REDConfig
+	PTT       PTTConfig
+
+	// PublicIPSource is the raw PUBLIC_IP value (IP or hostname). When it is a
+	// hostname and PublicIPRecheckInterval is positive, the hub periodically
+	// re-resolves it and applies changes to new and existing PeerConnections.
+	PublicIPSource              string
+	PublicIPRecheckInterval     time.Duration
+	PublicIPRecheckRebuildPeers bool
+
+	// ShutdownDrainTimeout bounds how long a graceful shutdown waits for
+	// PeerConnections and WebSockets to close. ShutdownReconnectAfter is the
+	// hint sent to clients in the server-shutdown envelope.
+	ShutdownDrainTimeout   time.Duration
+	ShutdownReconnectAfter time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		MaxUsersPerRoom: 25,
+		MaxRooms:        100,
+		ChatHistorySize: 200,
+		WebRTC: WebRTCConfig{
+			UDPMin: 40000,
+			UDPMax: 40100,
+		},
+		ICE: ICEConfig{
+			Servers:       defaultICEServers(),
+			CredentialTTL: 6 * time.Hour,
+		},
+		TURN: TURNConfig{
+			Port:          3478,
+			Realm:         "qvoch",
+			RelayMin:      49160,
+			RelayMax:      49200,
+			CredentialTTL: 6 * time.Hour,
+		},
+		Speaking: SpeakingConfig{
+			Threshold: 50,
+			Hold:      400 * time.Millisecond,
+			Interval:  200 * time.Millisecond,
+		},
+		LastN: LastNConfig{
+			SwitchHold: time.Second,
+		},
+		Codecs: CodecConfig{
+			Video:        defaultVideoCodecs(),
+			AudioProfile: AudioProfileVoice,
+			VoiceBitrate: 32000,
+			MusicBitrate: 128000,
+		},
+		RED: REDConfig{
+			Enabled:  true,
+			AutoLoss: 0.05,
+		},
+		PTT: PTTConfig{
+			Mode:    PTTModeOff,
+			MaxHold: time.Minute,
+		},
+		PublicIPRecheckRebuildPeers: true,
+		ShutdownDrainTimeout:        10 * time.Second,
+		ShutdownReconnectAfter:      3 * time.Second,
+	}
+}
+
+func LoadConfig() Config {
+	publicIPSource := strings.TrimSpace(os.Getenv("PUBLIC_IP"))
+	webrtcCfg := loadWebRTCConfig(publicIPSource)
+
+	cfg := Config{
+		MaxUsersPerRoom:             getEnvIntBounded("MAX_USERS_PER_ROOM", 25, 1, 100),
+		MaxRooms:                    getEnvIntBounded("MAX_ROOMS", 100, 1, 10000),
+		ChatHistorySize:             getEnvIntBounded("CHAT_HISTORY_SIZE", 200, 10, 1000),
+		WebRTC:                      webrtcCfg,
+		ICE:                         loadICEConfig(),
+		TURN:                        loadTURNConfig(publicIPSource, webrtcCfg.PublicIP),
+		Speaking:                    loadSpeakingConfig(),
+		LastN:                       loadLastNConfig(),
+		Recording:                   loadRecordingConfig(),
+		Codecs:                      loadCodecConfig(),
+		RED:                         loadREDConfig(),
+		PTT:                         loadPTTConfig(),
+		PublicIPSource:              publicIPSource,
+		PublicIPRecheckInterval:     getEnvDuration("PUBLIC_IP_RECHECK_INTERVAL", 0),
+		PublicIPRecheckRebuildPeers: getEnvBool("PUBLIC_IP_RECHECK_REBUILD_PEERS", true),
+		ShutdownDrainTimeout:        getEnvDuration("SHUTDOWN_DRAIN_TIMEOUT", 10*time.Second),
+		ShutdownReconnectAfter:      getEnvDuration("SHUTDOWN_RECONNECT_AFTER", 3*time.Second),
+	}
+
+	hubLog.Info("hub config loaded",
+		"max_users_per_room", cfg.MaxUsersPerRoom,
+		"max_rooms", cfg.MaxRooms,
+		"chat_history_size", cfg.ChatHistorySize)
+	return cfg
+}
+
+func getEnvInt(key string, defaultVal int) int {
+	val := os.Getenv(key)
+	if val == "" {
+		return defaultVal
+	}
+	n, err := strconv.Atoi(val)
+	if err != nil {
+		return defaultVal
+	}
+	return n
+}
+
+func getEnvIntBounded(key string, defaultVal, minVal, maxVal int) int {
+	n := getEnvInt(key, defaultVal)
+	if n < minVal {
+		return minVal
+	}
+	if n > maxVal {
+		return maxVal
+	}
+	return n
+}
+
+func getEnvUint16(key string, defaultVal uint16) uint16 {
+	val := os.Getenv(key)
+	if val == "" {
+		return defaultVal
+	}
+	n, err := strconv.Atoi(val)
+	if err != nil || n < 0 || n > 65535 {
+		return defaultVal
+	}
+	return uint16(n)
+}
+
+func getEnvDuration(key string, defaultVal time.Duration) time.Duration {
+	val := strings.TrimSpace(os.Getenv(key))
+	if val == "" {
+		return defaultVal
+	}
+
+	if d, err := time.ParseDuration(val); err == nil {
+		return d
+	}
+
+	if n, err := strconv.Atoi(val); err == nil && n >= 0 {
+		return time.Duration(n) * time.Second
+	}
+
+	return defaultVal
+}
+
+func getEnvBool(key string, defaultVal bool) bool {
+	val := strings.TrimSpace(strings.ToLower(os.Getenv(key)))
+	if val == "" {
+		return defaultVal
+	}
+	switch val {
+	case "1", "true", "yes", "on":
+		return true
+	case "0", "false", "no", "off":
+		return false
+	default:
+		return defaultVal
+	}
+}
@@ -0,0 +1,62 @@
+package sfu
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SignalError is an error that is meant to reach the client as an "error"
+// envelope. Code is one of the Err* constants; Message is safe to show to
+// users. Anything that is not a SignalError is reported as ErrInternalError
+// without leaking its text.
+type SignalError struct {
+	Code       string
+	Message    string
+	RetryAfter time.Duration
+	Details    map[string]interface{}
+}
+
+func (e *SignalError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+func NewSignalError(code, message string) *SignalError {
+	return &SignalError{Code: code, Message: message}
+}
+
+func (e *SignalError) WithRetryAfter(d time.Duration) *SignalError {
+	e.RetryAfter = d
+	return e
+}
+
+func (e *SignalError) WithDetail(key string, value interface{}) *SignalError {
+	if e.Details == nil {
+		e.Details = make(map[string]interface{})
+	}
+	e.Details[key] = value
+	return e
+}
+
+// Payload converts the error into its wire representation.
+func (e *SignalError) Payload() ErrorPayload {
+	payload := ErrorPayload{
+		Code:    e.Code,
+		Message: e.Message,
+		Details: e.Details,
+	}
+	if e.RetryAfter > 0 {
+		payload.RetryAfterMs = e.RetryAfter.Milliseconds()
+	}
+	return payload
+}
+
+// AsSignalError extracts a SignalError from err, falling back to a generic
+// ErrInternalError for anything else.
+func AsSignalError(err error) *SignalError {
+	var sigErr *SignalError
+	if errors.As(err, &sigErr) {
+		return sigErr
+	}
+	return NewSignalError(ErrInternalError, "Internal server error")
+}
@@ -1,15 +1,17 @@
 package sfu
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
 	"math/rand"
-	"os"
-	"strconv"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/pion/ice/v2"
+	"github.com/pion/interceptor/pkg/stats"
+	"github.com/pion/turn/v2"
 	"github.com/pion/webrtc/v3"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -20,10 +22,15 @@ type PendingInvite struct {
 	ToPeer      *Peer
 	MainRoom    *Room
 	ChannelName string
-	Timer       *time.Timer
+	Timer       Timer
 	CreatedAt   time.Time
 }
 
+const (
+	roomCreatesPerIPLimit  = 3
+	roomCreatesPerIPWindow = 10 * time.Minute
+)
+
 type rebuildEntry struct {
 	peer *Peer
 	room *Room
@@ -37,70 +44,181 @@ type Hub struct {
 	PendingInvites map[string]*PendingInvite
 	mu             sync.RWMutex
 
-	webrtcAPI        *webrtc.API
+	cfg              Config
+	clock            Clock
+	metrics          *hubMetrics
+	webrtcAPIs       map[string]*webrtc.API // by audio profile
 	webrtcCfg        WebRTCConfig
-	maxUsersPerRoom  int
-	maxTotalRooms    int
-	chatHistorySize  int
+	udpMux           ice.UDPMux
+	tcpMux           ice.TCPMux
 	roomCreatesPerIP map[string][]time.Time
+
+	// pcCreateMu serializes PeerConnection creation so the stats getter
+	// handed to onStatsGetter can be attributed to the right peer.
+	pcCreateMu   sync.Mutex
+	pendingStats stats.Getter
+
+	started       bool
+	stopped       bool
+	draining      bool
+	negotiations  sync.WaitGroup
+	gcTimer       Timer
+	publicIPTimer Timer
+	qualityTimer  Timer
+	// subCountdowns are the running sub-channel countdowns, by sub-channel
+	// ID; see sendSubCountdownIfNeeded.
+	subCountdowns map[string]Timer
+
+	// recordings holds running and finished recordings by ID until their
+	// main room is deleted. recordingDownloads are the download links sent
+	// to owners, by token.
+	recordings         map[string]*Recording
+	recordingDownloads map[string]recordingDownload
+
+	turnServer *turn.Server
+	turnSecret string
+	turnURLs   []string
 }
 
-var hub *Hub
-var hubOnce sync.Once
-
-func GetHub() *Hub {
-	hubOnce.Do(func() {
-		maxUsers := getEnvIntBounded("MAX_USERS_PER_ROOM", 25, 1, 100)
-		maxRooms := getEnvIntBounded("MAX_ROOMS", 100, 1, 10000)
-		chatSize := getEnvIntBounded("CHAT_HISTORY_SIZE", 200, 10, 1000)
-
-		hub = &Hub{
-			Rooms:            make(map[string]*Room),
-			RoomsByName:      make(map[string]*Room),
-			InviteMap:        make(map[string]*Room),
-			SessionMap:       make(map[string]*Peer),
-			PendingInvites:   make(map[string]*PendingInvite),
-			maxUsersPerRoom:  maxUsers,
-			maxTotalRooms:    maxRooms,
-			chatHistorySize:  chatSize,
-			roomCreatesPerIP: make(map[string][]time.Time),
-		}
+var errHubDraining = errors.New("hub is shutting down")
+
+// NewHub creates a hub with the given configuration. A nil clock falls back
+// to RealClock. Background GC and the PUBLIC_IP monitor only run between
+// Start and Stop, so several hubs can coexist in one process.
+func NewHub(cfg Config, clock Clock) *Hub {
+	if clock == nil {
+		clock = RealClock()
+	}
+
+	return &Hub{
+		Rooms:              make(map[string]*Room),
+		RoomsByName:        make(map[string]*Room),
+		InviteMap:          make(map[string]*Room),
+		SessionMap:         make(map[string]*Peer),
+		PendingInvites:     make(map[string]*PendingInvite),
+		cfg:                cfg,
+		clock:              clock,
+		metrics:            newHubMetrics(),
+		webrtcCfg:          cfg.WebRTC,
+		roomCreatesPerIP:   make(map[string][]time.Time),
+		recordings:         make(map[string]*Recording),
+		recordingDownloads: make(map[string]recordingDownload),
+		subCountdowns:      make(map[string]Timer),
+	}
+}
 
-		log.Printf("Hub: maxUsersPerRoom=%d maxRooms=%d chatHistorySize=%d", maxUsers, maxRooms, chatSize)
-		go hub.startGC()
-		go hub.startPublicIPMonitor()
-	})
-	return hub
+func (h *Hub) Start() {
+	h.mu.Lock()
+	if h.started || h.stopped {
+		h.mu.Unlock()
+		return
+	}
+	h.started = true
+	h.mu.Unlock()
+
+	h.scheduleGC()
+	h.startTURN()
+	h.scheduleQualityCheck()
+
+	if h.cfg.PublicIPSource != "" && h.cfg.PublicIPRecheckInterval > 0 {
+		hubLog.Info("PUBLIC_IP monitor enabled",
+			"source", h.cfg.PublicIPSource,
+			"interval", h.cfg.PublicIPRecheckInterval,
+			"rebuild_peers", h.cfg.PublicIPRecheckRebuildPeers)
+		h.schedulePublicIPCheck()
+	}
 }
 
-func getEnvInt(key string, defaultVal int) int {
-	val := os.Getenv(key)
-	if val == "" {
-		return defaultVal
+// Stop cancels background timers and pending invites and closes the embedded
+// TURN server and shared ICE sockets. It does not close PeerConnections or WebSockets; callers own
+// those.
+func (h *Hub) Stop() {
+	h.mu.Lock()
+	if h.stopped {
+		h.mu.Unlock()
+		return
 	}
-	n, err := strconv.Atoi(val)
-	if err != nil {
-		return defaultVal
+	h.stopped = true
+
+	if h.gcTimer != nil {
+		h.gcTimer.Stop()
+	}
+	if h.publicIPTimer != nil {
+		h.publicIPTimer.Stop()
+	}
+	if h.qualityTimer != nil {
+		h.qualityTimer.Stop()
+	}
+	for id, inv := range h.PendingInvites {
+		inv.Timer.Stop()
+		delete(h.PendingInvites, id)
+	}
+	for id, timer := range h.subCountdowns {
+		timer.Stop()
+		delete(h.subCountdowns, id)
 	}
-	return n
+	h.mu.Unlock()
+
+	h.stopTURN()
+	h.closeICEMuxes()
 }
 
-func getEnvIntBounded(key string, defaultVal, minVal, maxVal int) int {
-	n := getEnvInt(key, defaultVal)
-	if n < minVal {
-		return minVal
+// Shutdown stops new negotiations, closes every PeerConnection through
+// ClosePeerConnection and waits for in-flight negotiations to return. It
+// gives up when ctx is done. Room state is left in place so the caller can
+// still notify and disconnect WebSocket clients afterwards.
+func (h *Hub) Shutdown(ctx context.Context) error {
+	h.mu.Lock()
+	h.draining = true
+	mainRooms := make([]*Room, 0, len(h.Rooms))
+	for _, room := range h.Rooms {
+		if room.ParentID == "" {
+			mainRooms = append(mainRooms, room)
+		}
 	}
-	if n > maxVal {
-		return maxVal
+	h.mu.Unlock()
+
+	peers := make([]*Peer, 0)
+	for _, room := range mainRooms {
+		room.mu.RLock()
+		peers = append(peers, room.AllPeersInMainAndSubs()...)
+		room.mu.RUnlock()
+	}
+
+	hubLog.Info("draining peer connections", "peers", len(peers))
+	for _, p := range peers {
+		h.ClosePeerConnection(p)
+	}
+	h.finishAllRecordings()
+
+	done := make(chan struct{})
+	go func() {
+		h.negotiations.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("wait for negotiations: %w", ctx.Err())
 	}
-	return n
 }
 
 func generateRoomSuffix() string {
 	return fmt.Sprintf("#%04d", rand.Intn(10000))
 }
 
-func (h *Hub) CreateRoom(channelName, password string, creator *Peer, ip string) (*Room, error) {
+// CreateRoom creates a main room owned by creator. An empty audioProfile
+// uses the configured default.
+func (h *Hub) CreateRoom(channelName, password, audioProfile string, creator *Peer, ip string) (*Room, error) {
+	if audioProfile == "" {
+		audioProfile = h.cfg.Codecs.AudioProfile
+	}
+	if !validAudioProfile(audioProfile) {
+		return nil, NewSignalError(ErrInvalidMessage, "Audio profile must be voice or music")
+	}
+
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
 		return nil, fmt.Errorf("hash password: %w", err)
@@ -109,13 +227,13 @@ func (h *Hub) CreateRoom(channelName, password string, creator *Peer, ip string)
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
-	if len(h.Rooms) >= h.maxTotalRooms {
-		return nil, fmt.Errorf("%s:Server has reached the maximum number of rooms", ErrServerFull)
+	if len(h.Rooms) >= h.cfg.MaxRooms {
+		return nil, NewSignalError(ErrServerFull, "Server has reached the maximum number of rooms")
 	}
 
 	if ip != "" {
-		now := time.Now()
-		cutoff := now.Add(-10 * time.Minute)
+		now := h.clock.Now()
+		cutoff := now.Add(-roomCreatesPerIPWindow)
 		recent := h.roomCreatesPerIP[ip]
 		filtered := recent[:0]
 		for _, t := range recent {
@@ -124,8 +242,12 @@ func (h *Hub) CreateRoom(channelName, password string, creator *Peer, ip string)
 			}
 		}
 		h.roomCreatesPerIP[ip] = filtered
-		if len(filtered) >= 3 {
-			return nil, fmt.Errorf("%s:Too many rooms created recently, try again later", ErrServerFull)
+		if len(filtered) >= roomCreatesPerIPLimit {
+			retryAfter := filtered[0].Add(roomCreatesPerIPWindow).Sub(now)
+			return nil, NewSignalError(ErrRateLimited, "Too many rooms created recently, try again later").
+				WithRetryAfter(retryAfter).
+				WithDetail("limit", roomCreatesPerIPLimit).
+				WithDetail("windowSeconds", int(roomCreatesPerIPWindow/time.Second))
 		}
 		h.roomCreatesPerIP[ip] = append(h.roomCreatesPerIP[ip], now)
 	}
@@ -144,7 +266,14 @@ func (h *Hub) CreateRoom(channelName, password string, creator *Peer, ip string)
 	roomID := uuid.New().String()
 	inviteToken := uuid.New().String()
 
-	room := NewRoom(roomID, channelName, fullName, inviteToken, string(hashedPassword))
+	room := NewRoom(roomID, channelName, fullName, inviteToken, string(hashedPassword), h.clock)
+	room.OwnerID = creator.ID
+	room.AudioProfile = audioProfile
+	room.red = h.cfg.RED.Enabled && h.cfg.RED.Always
+	room.pttMode = h.cfg.PTT.Mode
+	if h.cfg.LastN.Speakers > 0 {
+		room.lastN = newLastNSelector(h.cfg.LastN.Speakers, h.cfg.LastN.SwitchHold)
+	}
 
 	creator.mu.Lock()
 	creator.RoomID = roomID
@@ -160,11 +289,12 @@ func (h *Hub) CreateRoom(channelName, password string, creator *Peer, ip string)
 	sessionToken := uuid.New().String()
 	creator.mu.Lock()
 	creator.SessionToken = sessionToken
-	creator.SessionCreatedAt = time.Now()
+	creator.SessionCreatedAt = h.clock.Now()
+	creator.joinedAt = h.clock.Now()
 	creator.mu.Unlock()
 	h.SessionMap[sessionToken] = creator
 
-	log.Printf("room created: %s (ID: %s)", fullName, roomID)
+	hubLog.Info("room created", "room_id", roomID, "room_name", fullName, "peer_id", creator.ID)
 	return room, nil
 }
 
@@ -175,7 +305,7 @@ func (h *Hub) JoinRoom(payload JoinPayload, peer *Peer) (*Room, string, string,
 		existingPeer, ok := h.SessionMap[payload.SessionToken]
 		if ok {
 			existingPeer.mu.RLock()
-			sessionAge := time.Since(existingPeer.SessionCreatedAt)
+			sessionAge := h.clock.Now().Sub(existingPeer.SessionCreatedAt)
 			roomID := existingPeer.RoomID
 			mainRoomID := existingPeer.MainRoomID
 			existingPeer.mu.RUnlock()
@@ -202,6 +332,10 @@ func (h *Hub) JoinRoom(payload JoinPayload, peer *Peer) (*Room, string, string,
 						}
 					}
 
+					// The old peer object is retired below and its
+					// PeerConnection's handlers are bound to it, so its media
+					// is torn down here. The reconnected peer gets its own
+					// PeerConnection through SetupPeerMedia.
 					h.mu.Unlock()
 					if oldRoom != nil {
 						h.RemoveTrackFromPeers(existingPeer, oldRoom)
@@ -212,7 +346,7 @@ func (h *Hub) JoinRoom(payload JoinPayload, peer *Peer) (*Room, string, string,
 					currentPeer, stillExists := h.SessionMap[payload.SessionToken]
 					if !stillExists || currentPeer != existingPeer {
 						h.mu.Unlock()
-						return nil, "", "", fmt.Errorf("%s:Session reconnect conflicted, retry", ErrInvalidMessage)
+						return nil, "", "", NewSignalError(ErrInvalidMessage, "Session reconnect conflicted, retry")
 					}
 
 					mainRoom = h.Rooms[mainRoomID]
@@ -236,6 +370,7 @@ func (h *Hub) JoinRoom(payload JoinPayload, peer *Peer) (*Room, string, string,
 						peer.RoomID = targetRoom.ID
 						peer.MainRoomID = mainRoomID
 						peer.Muted = existingPeer.Muted
+						peer.ForceMuted = existingPeer.ForceMuted
 						peer.mu.Unlock()
 
 						targetRoom.mu.Lock()
@@ -247,7 +382,8 @@ func (h *Hub) JoinRoom(payload JoinPayload, peer *Peer) (*Room, string, string,
 						delete(h.SessionMap, payload.SessionToken)
 						peer.mu.Lock()
 						peer.SessionToken = newSessionToken
-						peer.SessionCreatedAt = time.Now()
+						peer.SessionCreatedAt = h.clock.Now()
+						peer.joinedAt = h.clock.Now()
 						peer.mu.Unlock()
 						h.SessionMap[newSessionToken] = peer
 
@@ -260,7 +396,7 @@ func (h *Hub) JoinRoom(payload JoinPayload, peer *Peer) (*Room, string, string,
 						existingPeer.Conn = nil
 						existingPeer.mu.Unlock()
 
-						log.Printf("peer %s reconnected via session token", peer.ID)
+						hubLog.Info("peer reconnected via session token", "peer_id", peer.ID, "room_id", targetRoom.ID)
 						h.mu.Unlock()
 						return targetRoom, newSessionToken, reconnectNotice, nil
 					}
@@ -275,33 +411,33 @@ func (h *Hub) JoinRoom(payload JoinPayload, peer *Peer) (*Room, string, string,
 		r, ok := h.InviteMap[payload.InviteToken]
 		if !ok {
 			h.mu.Unlock()
-			return nil, "", "", fmt.Errorf("%s:Room not found", ErrChannelNotFound)
+			return nil, "", "", NewSignalError(ErrChannelNotFound, "Room not found")
 		}
-		if time.Since(r.CreatedAt) > 7*24*time.Hour {
+		if h.clock.Now().Sub(r.CreatedAt) > 7*24*time.Hour {
 			delete(h.InviteMap, payload.InviteToken)
 			h.mu.Unlock()
-			return nil, "", "", fmt.Errorf("%s:Invite link has expired", ErrInviteExpired)
+			return nil, "", "", NewSignalError(ErrInviteExpired, "Invite link has expired")
 		}
 		room = r
 	} else if payload.ChannelName != "" {
 		r, ok := h.RoomsByName[payload.ChannelName]
 		if !ok {
 			h.mu.Unlock()
-			return nil, "", "", fmt.Errorf("%s:Room not found", ErrChannelNotFound)
+			return nil, "", "", NewSignalError(ErrChannelNotFound, "Room not found")
 		}
 		room = r
 
 		if payload.Password == "" {
 			h.mu.Unlock()
-			return nil, "", "", fmt.Errorf("%s:Password is required", ErrPasswordRequired)
+			return nil, "", "", NewSignalError(ErrPasswordRequired, "Password is required")
 		}
 		if err := bcrypt.CompareHashAndPassword([]byte(room.PasswordHash), []byte(payload.Password)); err != nil {
 			h.mu.Unlock()
-			return nil, "", "", fmt.Errorf("%s:Invalid password", ErrPasswordWrong)
+			return nil, "", "", NewSignalError(ErrPasswordWrong, "Invalid password")
 		}
 	} else {
 		h.mu.Unlock()
-		return nil, "", "", fmt.Errorf("%s:Must provide channelName or inviteToken", ErrInvalidMessage)
+		return nil, "", "", NewSignalError(ErrInvalidMessage, "Must provide channelName or inviteToken")
 	}
 
 	room.mu.Lock()
@@ -310,7 +446,7 @@ func (h *Hub) JoinRoom(payload JoinPayload, peer *Peer) (*Room, string, string,
 	targetRoom := room
 	if room.ParentID != "" {
 		room.mu.Unlock()
-		return nil, "", "", fmt.Errorf("%s:Cannot join sub-channel directly", ErrInvalidMessage)
+		return nil, "", "", NewSignalError(ErrInvalidMessage, "Cannot join sub-channel directly")
 	}
 
 	totalPeers := len(targetRoom.Peers)
@@ -319,14 +455,14 @@ func (h *Hub) JoinRoom(payload JoinPayload, peer *Peer) (*Room, string, string,
 		totalPeers += len(sub.Peers)
 		sub.mu.RUnlock()
 	}
-	if totalPeers >= h.maxUsersPerRoom {
+	if totalPeers >= h.cfg.MaxUsersPerRoom {
 		room.mu.Unlock()
-		return nil, "", "", fmt.Errorf("%s:Room is full", ErrChannelFull)
+		return nil, "", "", NewSignalError(ErrChannelFull, "Room is full")
 	}
 
 	if h.isNameTakenInRoom(targetRoom, payload.Username) {
 		room.mu.Unlock()
-		return nil, "", "", fmt.Errorf("%s:Username already taken in this room", ErrNameTaken)
+		return nil, "", "", NewSignalError(ErrNameTaken, "Username already taken in this room")
 	}
 
 	peer.mu.Lock()
@@ -341,14 +477,15 @@ func (h *Hub) JoinRoom(payload JoinPayload, peer *Peer) (*Room, string, string,
 	sessionToken := uuid.New().String()
 	peer.mu.Lock()
 	peer.SessionToken = sessionToken
-	peer.SessionCreatedAt = time.Now()
+	peer.SessionCreatedAt = h.clock.Now()
+	peer.joinedAt = h.clock.Now()
 	peer.mu.Unlock()
 
 	h.mu.Lock()
 	h.SessionMap[sessionToken] = peer
 	h.mu.Unlock()
 
-	log.Printf("peer %s (%s) joined room %s", peer.Name, peer.ID, targetRoom.FullName)
+	hubLog.Info("peer joined room", "peer_id", peer.ID, "peer_name", peer.Name, "room_id", targetRoom.ID, "room_name", targetRoom.FullName)
 	return targetRoom, sessionToken, "", nil
 }
 
@@ -387,6 +524,8 @@ func (h *Hub) RemovePeer(peer *Peer, preserveSession bool) {
 	if roomID == "" {
 		return
 	}
+	h.dropWhispers(peer)
+	h.StopListening(peer)
 
 	var currentRoom *Room
 	h.mu.Lock()
@@ -419,15 +558,7 @@ func (h *Hub) RemovePeer(peer *Peer, preserveSession bool) {
 
 			// Immediately clean up empty sub-channels
 			if mok {
-				mainRoom.mu.Lock()
-				currentRoom.mu.RLock()
-				subEmpty := len(currentRoom.Peers) == 0
-				subID := currentRoom.ID
-				currentRoom.mu.RUnlock()
-				if subEmpty {
-					delete(mainRoom.SubChannels, subID)
-				}
-				mainRoom.mu.Unlock()
+				h.deleteEmptySubChannel(mainRoom, currentRoom)
 			}
 		}
 
@@ -443,7 +574,7 @@ func (h *Hub) RemovePeer(peer *Peer, preserveSession bool) {
 			peer.mu.Unlock()
 		}
 
-		log.Printf("peer %s removed from sub-channel %s", peer.ID, roomID)
+		hubLog.Info("peer removed from sub-channel", "peer_id", peer.ID, "room_id", roomID)
 		return
 	}
 	h.mu.Unlock()
@@ -475,7 +606,7 @@ func (h *Hub) RemovePeer(peer *Peer, preserveSession bool) {
 		peer.mu.Unlock()
 	}
 
-	log.Printf("peer %s removed from room %s", peer.ID, roomID)
+	hubLog.Info("peer removed from room", "peer_id", peer.ID, "room_id", roomID)
 }
 
 func (h *Hub) HandleChat(peer *Peer, ciphertext string) {
@@ -490,7 +621,7 @@ func (h *Hub) HandleChat(peer *Peer, ciphertext string) {
 	}
 
 	msgID := uuid.New().String()
-	now := time.Now().UnixMilli()
+	now := h.clock.Now().UnixMilli()
 
 	msg := ChatMessage{
 		ID:         msgID,
@@ -521,7 +652,7 @@ func (h *Hub) HandleChat(peer *Peer, ciphertext string) {
 	}
 
 	room.mu.Lock()
-	room.AddChatMessage(msg, h.chatHistorySize)
+	room.AddChatMessage(msg, h.cfg.ChatHistorySize)
 	room.mu.Unlock()
 
 	outMsg := ChatMessageOut{
@@ -565,7 +696,7 @@ func (h *Hub) HandleSubInvite(fromPeer *Peer, targetUserID, channelName string)
 	mainRoom, ok := h.Rooms[fromMainRoomID]
 	h.mu.RUnlock()
 	if !ok {
-		fromPeer.SendError(ErrInternalError, "Room not found")
+		fromPeer.SendError(ErrChannelNotFound, "Room not found")
 		return
 	}
 
@@ -574,7 +705,7 @@ func (h *Hub) HandleSubInvite(fromPeer *Peer, targetUserID, channelName string)
 	mainRoom.mu.RUnlock()
 
 	if !found {
-		fromPeer.SendError(ErrChannelNotFound, "User not found in main channel")
+		fromPeer.SendError(ErrUserNotFound, "User not found in main channel")
 		return
 	}
 
@@ -590,7 +721,7 @@ func (h *Hub) HandleSubInvite(fromPeer *Peer, targetUserID, channelName string)
 
 	inviteID := uuid.New().String()
 
-	timer := time.AfterFunc(30*time.Second, func() {
+	timer := h.clock.AfterFunc(30*time.Second, func() {
 		h.mu.Lock()
 		inv, exists := h.PendingInvites[inviteID]
 		if exists {
@@ -621,7 +752,7 @@ func (h *Hub) HandleSubInvite(fromPeer *Peer, targetUserID, channelName string)
 		MainRoom:    mainRoom,
 		ChannelName: channelName,
 		Timer:       timer,
-		CreatedAt:   time.Now(),
+		CreatedAt:   h.clock.Now(),
 	}
 
 	h.mu.Lock()
@@ -666,34 +797,11 @@ func (h *Hub) HandleSubResponse(peer *Peer, inviteID string, accepted bool) {
 	subID := uuid.New().String()
 	mainRoom := invite.MainRoom
 
-	subRoom := &Room{
-		ID:           subID,
-		Name:         invite.ChannelName,
-		FullName:     mainRoom.FullName,
-		ParentID:     mainRoom.ID,
-		PasswordHash: mainRoom.PasswordHash,
-		Peers:        make(map[string]*Peer),
-		SubChannels:  make(map[string]*Room),
-		ChatHistory:  make([]ChatMessage, 0),
-	}
-
-	// Save tracks before closing PCs — we need them to remove from remaining peers.
-	invite.FromPeer.RLock()
-	fromTrack := invite.FromPeer.Track
-	invite.FromPeer.RUnlock()
-
-	invite.ToPeer.RLock()
-	toTrack := invite.ToPeer.Track
-	invite.ToPeer.RUnlock()
-
-	// Close PCs FIRST so the moving peers don't receive spurious renegotiation
-	// offers (their PC is about to be replaced for the sub-channel).
-	h.ClosePeerConnection(invite.FromPeer)
-	h.ClosePeerConnection(invite.ToPeer)
-
-	// Remove tracks from remaining main room peers only (moving peers have PC=nil).
-	h.removeTrackFromRoomPeers(fromTrack, mainRoom)
-	h.removeTrackFromRoomPeers(toTrack, mainRoom)
+	subRoom := NewRoom(subID, invite.ChannelName, mainRoom.FullName, "", mainRoom.PasswordHash, h.clock)
+	subRoom.ParentID = mainRoom.ID
+	subRoom.OwnerID = invite.FromPeer.ID
+	subRoom.AudioProfile = mainRoom.AudioProfile
+	subRoom.red = mainRoom.redEnabled()
 
 	mainRoom.mu.Lock()
 	mainRoom.RemovePeer(invite.FromPeer.ID)
@@ -701,6 +809,12 @@ func (h *Hub) HandleSubResponse(peer *Peer, inviteID string, accepted bool) {
 	mainRoom.SubChannels[subID] = subRoom
 	mainRoom.mu.Unlock()
 
+	// Remove both tracks from the peers staying behind. The moving peers have
+	// already left the main room, so they keep each other's track and are
+	// renegotiated once by switchPeerRoom.
+	h.RemoveTrackFromPeers(invite.FromPeer, mainRoom)
+	h.RemoveTrackFromPeers(invite.ToPeer, mainRoom)
+
 	subRoom.mu.Lock()
 	invite.FromPeer.mu.Lock()
 	invite.FromPeer.RoomID = subID
@@ -713,25 +827,10 @@ func (h *Hub) HandleSubResponse(peer *Peer, inviteID string, accepted bool) {
 	subRoom.AddPeer(invite.ToPeer)
 	subRoom.mu.Unlock()
 
-	log.Printf("sub-channel %s created in room %s", subID, mainRoom.FullName)
+	hubLog.Info("sub-channel created", "room_id", subID, "main_room_id", mainRoom.ID)
 
 	for _, p := range []*Peer{invite.FromPeer, invite.ToPeer} {
-		if err := h.CreatePeerConnection(p, subRoom); err != nil {
-			log.Printf("failed to create PC for %s in sub-channel: %v", p.ID, err)
-			continue
-		}
-		h.AddTrackToPeers(p, subRoom)
-		go func(target *Peer, targetRoom *Room) {
-			if err := h.NegotiateOffer(target, true); err != nil {
-				log.Printf("failed to send initial offer to %s in sub-channel: %v", target.ID, err)
-				return
-			}
-			if h.AddRoomTracksToPeer(target, targetRoom) {
-				if err := h.NegotiateOffer(target, false); err != nil {
-					log.Printf("failed to send room-track offer to %s in sub-channel: %v", target.ID, err)
-				}
-			}
-		}(p, subRoom)
+		h.switchPeerRoom(p, subRoom)
 	}
 
 	h.broadcastRoomUpdate(mainRoom)
@@ -761,7 +860,6 @@ func (h *Hub) HandleMoveToMain(peer *Peer) {
 	if subOk {
 		h.RemoveTrackFromPeers(peer, sub)
 	}
-	h.ClosePeerConnection(peer)
 
 	mainRoom.mu.Lock()
 	if subOk {
@@ -781,32 +879,10 @@ func (h *Hub) HandleMoveToMain(peer *Peer) {
 		h.sendSubCountdownIfNeeded(sub)
 
 		// Immediately clean up empty sub-channels
-		mainRoom.mu.Lock()
-		sub.mu.RLock()
-		subEmpty := len(sub.Peers) == 0
-		sub.mu.RUnlock()
-		if subEmpty {
-			delete(mainRoom.SubChannels, sub.ID)
-		}
-		mainRoom.mu.Unlock()
+		h.deleteEmptySubChannel(mainRoom, sub)
 	}
 
-	if err := h.CreatePeerConnection(peer, mainRoom); err != nil {
-		log.Printf("failed to create PC for %s moving to main: %v", peer.ID, err)
-	} else {
-		h.AddTrackToPeers(peer, mainRoom)
-		go func(target *Peer, targetRoom *Room) {
-			if err := h.NegotiateOffer(target, true); err != nil {
-				log.Printf("failed to send initial offer to %s: %v", target.ID, err)
-				return
-			}
-			if h.AddRoomTracksToPeer(target, targetRoom) {
-				if err := h.NegotiateOffer(target, false); err != nil {
-					log.Printf("failed to send room-track offer to %s: %v", target.ID, err)
-				}
-			}
-		}(peer, mainRoom)
-	}
+	h.switchPeerRoom(peer, mainRoom)
 
 	h.sendChatHistory(peer, mainRoom)
 
@@ -849,7 +925,6 @@ func (h *Hub) HandleMoveToSub(peer *Peer, targetSubID string) {
 			h.RemoveTrackFromPeers(peer, currentSub)
 		}
 	}
-	h.ClosePeerConnection(peer)
 
 	mainRoom.mu.Lock()
 	if currentRoomID == mainRoomID {
@@ -871,14 +946,7 @@ func (h *Hub) HandleMoveToSub(peer *Peer, targetSubID string) {
 			h.sendSubCountdownIfNeeded(oldSub)
 
 			// Immediately clean up empty sub-channels
-			mainRoom.mu.Lock()
-			oldSub.mu.RLock()
-			oldSubEmpty := len(oldSub.Peers) == 0
-			oldSub.mu.RUnlock()
-			if oldSubEmpty {
-				delete(mainRoom.SubChannels, currentRoomID)
-			}
-			mainRoom.mu.Unlock()
+			h.deleteEmptySubChannel(mainRoom, oldSub)
 		}
 	}
 
@@ -892,22 +960,7 @@ func (h *Hub) HandleMoveToSub(peer *Peer, targetSubID string) {
 
 	h.sendSubCountdownIfNeeded(targetSub)
 
-	if err := h.CreatePeerConnection(peer, targetSub); err != nil {
-		log.Printf("failed to create PC for %s moving to sub: %v", peer.ID, err)
-	} else {
-		h.AddTrackToPeers(peer, targetSub)
-		go func(target *Peer, targetRoom *Room) {
-			if err := h.NegotiateOffer(target, true); err != nil {
-				log.Printf("failed to send initial offer to %s: %v", target.ID, err)
-				return
-			}
-			if h.AddRoomTracksToPeer(target, targetRoom) {
-				if err := h.NegotiateOffer(target, false); err != nil {
-					log.Printf("failed to send room-track offer to %s: %v", target.ID, err)
-				}
-			}
-		}(peer, targetSub)
-	}
+	h.switchPeerRoom(peer, targetSub)
 
 	h.sendChatHistory(peer, targetSub)
 
@@ -919,15 +972,13 @@ func (h *Hub) sendSubCountdownIfNeeded(sub *Room) {
 	peerCount := len(sub.Peers)
 	subID := sub.ID
 
+	start := false
 	if peerCount == 1 {
 		if sub.CountdownExpiresAt == 0 {
-			expiresAt := time.Now().Add(5 * time.Minute).UnixMilli()
+			expiresAt := h.clock.Now().Add(5 * time.Minute).UnixMilli()
 			sub.CountdownExpiresAt = expiresAt
-			sub.Expiry = time.Now()
-
-			time.AfterFunc(5*time.Minute, func() {
-				h.cleanupExpiredSubChannel(subID)
-			})
+			sub.Expiry = h.clock.Now()
+			start = true
 		}
 	} else {
 		sub.CountdownExpiresAt = 0
@@ -935,7 +986,32 @@ func (h *Hub) sendSubCountdownIfNeeded(sub *Room) {
 			sub.Expiry = time.Time{}
 		}
 	}
+	countdown := sub.CountdownExpiresAt != 0
 	sub.mu.Unlock()
+
+	// The timer is kept by the hub, which h.mu guards, so Stop can cancel it
+	// and a cancelled countdown does not fire into a later one.
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if timer, ok := h.subCountdowns[subID]; ok && (start || !countdown) {
+		timer.Stop()
+		delete(h.subCountdowns, subID)
+	}
+	if start && !h.stopped {
+		var timer Timer
+		timer = h.clock.AfterFunc(5*time.Minute, func() {
+			h.mu.Lock()
+			current := h.subCountdowns[subID] == timer
+			if current {
+				delete(h.subCountdowns, subID)
+			}
+			h.mu.Unlock()
+			if current {
+				h.cleanupExpiredSubChannel(subID)
+			}
+		})
+		h.subCountdowns[subID] = timer
+	}
 }
 
 func (h *Hub) cleanupExpiredSubChannel(subID string) {
@@ -981,14 +1057,36 @@ func (h *Hub) cleanupExpiredSubChannel(subID string) {
 		if lastPeer != nil {
 			h.HandleMoveToMain(lastPeer)
 		}
-	} else {
-		mainRoom.mu.Lock()
-		delete(mainRoom.SubChannels, subID)
-		mainRoom.mu.Unlock()
+	} else if h.deleteEmptySubChannel(mainRoom, sub) {
 		h.broadcastRoomUpdate(mainRoom)
 	}
 }
 
+// deleteEmptySubChannel deletes sub from mainRoom if nobody is left in it.
+// Its listen-ins end first, so no listener keeps pointing at a deleted room
+// and no listen request waits for members that are gone. It reports whether
+// sub was deleted.
+func (h *Hub) deleteEmptySubChannel(mainRoom, sub *Room) bool {
+	sub.mu.RLock()
+	empty := len(sub.Peers) == 0
+	sub.mu.RUnlock()
+	if !empty {
+		return false
+	}
+	h.endListenIns(sub)
+
+	mainRoom.mu.Lock()
+	defer mainRoom.mu.Unlock()
+	sub.mu.RLock()
+	empty = len(sub.Peers) == 0
+	sub.mu.RUnlock()
+	if !empty || mainRoom.SubChannels[sub.ID] != sub {
+		return false
+	}
+	delete(mainRoom.SubChannels, sub.ID)
+	return true
+}
+
 func (h *Hub) BroadcastRoomUpdatePublic(mainRoom *Room) {
 	h.broadcastRoomUpdate(mainRoom)
 }
@@ -998,11 +1096,18 @@ func (h *Hub) broadcastRoomUpdate(mainRoom *Room) {
 	users := mainRoom.GetUserInfos()
 	subChannels := mainRoom.GetSubChannelInfos()
 	allPeers := mainRoom.AllPeersInMainAndSubs()
+	var recording *RecordingInfo
+	if mainRoom.recording != nil {
+		recording = mainRoom.recording.info()
+	}
+	ptt := mainRoom.pttInfoLocked()
 	mainRoom.mu.RUnlock()
 
 	update := RoomUpdatePayload{
 		Users:       users,
 		SubChannels: subChannels,
+		Recording:   recording,
+		PTT:         ptt,
 	}
 
 	for _, p := range allPeers {
@@ -1023,15 +1128,7 @@ func (h *Hub) sendChatHistory(peer *Peer, room *Room) {
 }
 
 func (h *Hub) BuildWelcomePayload(peer *Peer, room *Room, sessionToken string, reconnectNotice string) WelcomePayload {
-	mainRoom := room
-	if room.ParentID != "" {
-		h.mu.RLock()
-		parent := h.Rooms[room.ParentID]
-		h.mu.RUnlock()
-		if parent != nil {
-			mainRoom = parent
-		}
-	}
+	mainRoom := h.mainRoomOf(room)
 
 	mainRoom.mu.RLock()
 	users := mainRoom.GetUserInfos()
@@ -1040,6 +1137,17 @@ func (h *Hub) BuildWelcomePayload(peer *Peer, room *Room, sessionToken string, r
 	mainRoomName := mainRoom.Name
 	mainRoomFullName := mainRoom.FullName
 	inviteToken := mainRoom.InviteToken
+	ownerID := mainRoom.OwnerID
+	audioProfile := mainRoom.AudioProfile
+	var recording *RecordingInfo
+	if mainRoom.recording != nil {
+		recording = mainRoom.recording.info()
+	}
+	ptt := mainRoom.pttInfoLocked()
+	var allCall string
+	if mainRoom.allCall != nil {
+		allCall = mainRoom.allCall.ID
+	}
 	mainRoom.mu.RUnlock()
 
 	room.mu.RLock()
@@ -1052,6 +1160,7 @@ func (h *Hub) BuildWelcomePayload(peer *Peer, room *Room, sessionToken string, r
 
 	return WelcomePayload{
 		UserID:          peer.ID,
+		ICEServers:      h.ICEServers(peer.ID),
 		SessionToken:    sessionToken,
 		InviteToken:     inviteToken,
 		ReconnectNotice: reconnectNotice,
@@ -1060,26 +1169,35 @@ func (h *Hub) BuildWelcomePayload(peer *Peer, room *Room, sessionToken string, r
 			Name:             mainRoomName,
 			FullName:         mainRoomFullName,
 			CurrentChannelID: currentChannelID,
+			OwnerID:          ownerID,
+			AudioProfile:     audioProfile,
 			Users:            users,
 			SubChannels:      subChannels,
 			ChatHistory:      chatHistory,
+			Recording:        recording,
+			PTT:              ptt,
+			AllCall:          allCall,
 		},
 	}
 }
 
-func (h *Hub) startGC() {
-	ticker := time.NewTicker(60 * time.Second)
-	defer ticker.Stop()
+func (h *Hub) scheduleGC() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
 
-	for range ticker.C {
-		h.gc()
+	if h.stopped {
+		return
 	}
+	h.gcTimer = h.clock.AfterFunc(60*time.Second, func() {
+		h.gc()
+		h.scheduleGC()
+	})
 }
 
 func (h *Hub) gc() {
-	now := time.Now()
-	peersToRebuild := make([]rebuildEntry, 0)
-	roomsToBroadcast := make(map[*Room]struct{})
+	now := h.clock.Now()
+	expiredSubs := make([]*Room, 0)
+	deletedRooms := make([]string, 0)
 
 	h.mu.Lock()
 
@@ -1098,7 +1216,9 @@ func (h *Hub) gc() {
 		}
 	}
 
-	cutoff := now.Add(-10 * time.Minute)
+	h.pruneRecordingDownloadsLocked(now)
+
+	cutoff := now.Add(-roomCreatesPerIPWindow)
 	for ip, times := range h.roomCreatesPerIP {
 		filtered := times[:0]
 		for _, t := range times {
@@ -1120,35 +1240,14 @@ func (h *Hub) gc() {
 
 		room.mu.Lock()
 
-		for subID, sub := range room.SubChannels {
-			sub.mu.Lock()
-
-			if len(sub.Peers) == 0 && !sub.Expiry.IsZero() && now.Sub(sub.Expiry) > 5*time.Minute {
-				delete(room.SubChannels, subID)
-				log.Printf("GC: deleted empty sub-channel %s", subID)
-				sub.mu.Unlock()
-				continue
-			}
-
-			if len(sub.Peers) == 1 && !sub.Expiry.IsZero() && now.Sub(sub.Expiry) > 5*time.Minute {
-				var lastPeer *Peer
-				for _, p := range sub.Peers {
-					lastPeer = p
-				}
-				if lastPeer != nil {
-					lastPeer.mu.Lock()
-					lastPeer.RoomID = room.ID
-					lastPeer.mu.Unlock()
-					room.AddPeer(lastPeer)
-					peersToRebuild = append(peersToRebuild, rebuildEntry{peer: lastPeer, room: room})
-					roomsToBroadcast[room] = struct{}{}
-				}
-				sub.Peers = make(map[string]*Peer)
-				delete(room.SubChannels, subID)
-				log.Printf("GC: force-moved last peer from sub-channel %s to main", subID)
+		// Expired sub-channels are only collected here; their listen-ins
+		// have to end before they are deleted, which takes locks of its own.
+		for _, sub := range room.SubChannels {
+			sub.mu.RLock()
+			if len(sub.Peers) <= 1 && !sub.Expiry.IsZero() && now.Sub(sub.Expiry) > 5*time.Minute {
+				expiredSubs = append(expiredSubs, sub)
 			}
-
-			sub.mu.Unlock()
+			sub.mu.RUnlock()
 		}
 
 		totalPeers := len(room.Peers)
@@ -1162,7 +1261,9 @@ func (h *Hub) gc() {
 			delete(h.Rooms, roomID)
 			delete(h.RoomsByName, room.FullName)
 			delete(h.InviteMap, room.InviteToken)
-			log.Printf("GC: deleted room %s (%s)", room.FullName, roomID)
+			h.metrics.forgetRoom(roomID)
+			deletedRooms = append(deletedRooms, roomID)
+			hubLog.Info("GC: deleted room", "room_id", roomID, "room_name", room.FullName)
 		}
 
 		room.mu.Unlock()
@@ -1170,27 +1271,57 @@ func (h *Hub) gc() {
 
 	h.mu.Unlock()
 
-	for _, entry := range peersToRebuild {
-		h.ClosePeerConnection(entry.peer)
-		if err := h.CreatePeerConnection(entry.peer, entry.room); err != nil {
-			log.Printf("GC: failed to rebuild PC for %s: %v", entry.peer.ID, err)
-			continue
-		}
-		h.AddTrackToPeers(entry.peer, entry.room)
-		go func(target *Peer, targetRoom *Room) {
-			if err := h.NegotiateOffer(target, true); err != nil {
-				log.Printf("GC: failed to send rebuilt initial offer to %s: %v", target.ID, err)
-				return
-			}
-			if h.AddRoomTracksToPeer(target, targetRoom) {
-				if err := h.NegotiateOffer(target, false); err != nil {
-					log.Printf("GC: failed to send rebuilt room-track offer to %s: %v", target.ID, err)
-				}
-			}
-		}(entry.peer, entry.room)
+	for _, roomID := range deletedRooms {
+		h.deleteRecordings(roomID)
 	}
 
-	for room := range roomsToBroadcast {
-		h.broadcastRoomUpdate(room)
+	for _, sub := range expiredSubs {
+		h.expireSubChannel(sub, now)
 	}
+
+	h.finishIdleRecordings()
+}
+
+// expireSubChannel deletes sub if it is still expired at now, after ending
+// its listen-ins. Its last member, if any, is force-moved to the main room.
+func (h *Hub) expireSubChannel(sub *Room, now time.Time) {
+	h.endListenIns(sub)
+
+	h.mu.RLock()
+	mainRoom := h.Rooms[sub.ParentID]
+	h.mu.RUnlock()
+	if mainRoom == nil {
+		return
+	}
+
+	mainRoom.mu.Lock()
+	sub.mu.Lock()
+	if mainRoom.SubChannels[sub.ID] != sub || len(sub.Peers) > 1 ||
+		sub.Expiry.IsZero() || now.Sub(sub.Expiry) <= 5*time.Minute {
+		sub.mu.Unlock()
+		mainRoom.mu.Unlock()
+		return
+	}
+	var lastPeer *Peer
+	for _, p := range sub.Peers {
+		lastPeer = p
+	}
+	if lastPeer != nil {
+		lastPeer.mu.Lock()
+		lastPeer.RoomID = mainRoom.ID
+		lastPeer.mu.Unlock()
+		mainRoom.AddPeer(lastPeer)
+	}
+	sub.Peers = make(map[string]*Peer)
+	delete(mainRoom.SubChannels, sub.ID)
+	sub.mu.Unlock()
+	mainRoom.mu.Unlock()
+
+	if lastPeer == nil {
+		hubLog.Info("GC: deleted empty sub-channel", "room_id", sub.ID, "main_room_id", mainRoom.ID)
+		return
+	}
+	hubLog.Info("GC: force-moved last peer from sub-channel to main", "room_id", sub.ID, "main_room_id", mainRoom.ID)
+	h.switchPeerRoom(lastPeer, mainRoom)
+	h.broadcastRoomUpdate(mainRoom)
 }
@@ -0,0 +1,255 @@
+package sfu
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+var testEpoch = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// newTestHub starts a hub driven by its own FakeClock. No ICE servers are
+// configured, so PeerConnections created by room moves stay local.
+func newTestHub(t *testing.T) (*Hub, *FakeClock) {
+	t.Helper()
+	cfg := DefaultConfig()
+	cfg.ICE.Servers = nil
+	clock := NewFakeClock(testEpoch)
+
+	h := NewHub(cfg, clock)
+	h.Start()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := h.Shutdown(ctx); err != nil {
+			t.Errorf("shutdown: %v", err)
+		}
+		h.Stop()
+	})
+	return h, clock
+}
+
+// newTestRoom creates a main room owned by a new peer and adds the other
+// names to it. Peers have no WebSocket, so events sent to them are dropped.
+func newTestRoom(t *testing.T, h *Hub, owner string, others ...string) (*Room, []*Peer) {
+	t.Helper()
+	creator := &Peer{ID: owner, Name: owner}
+	room, err := h.CreateRoom("test", "secret", "", creator, "")
+	if err != nil {
+		t.Fatalf("create room: %v", err)
+	}
+
+	peers := []*Peer{creator}
+	for _, name := range others {
+		p := &Peer{ID: name, Name: name, RoomID: room.ID, MainRoomID: room.ID}
+		room.mu.Lock()
+		room.AddPeer(p)
+		room.mu.Unlock()
+		peers = append(peers, p)
+	}
+	return room, peers
+}
+
+// openSubChannel has from invite to into a new sub-channel and accepts.
+func openSubChannel(t *testing.T, h *Hub, from, to *Peer) *Room {
+	t.Helper()
+	h.HandleSubInvite(from, to.ID, "side")
+
+	h.mu.RLock()
+	var inviteID string
+	for id, inv := range h.PendingInvites {
+		if inv.FromPeer == from && inv.ToPeer == to {
+			inviteID = id
+		}
+	}
+	h.mu.RUnlock()
+	if inviteID == "" {
+		t.Fatal("no pending invite")
+	}
+	h.HandleSubResponse(to, inviteID, true)
+
+	sub := h.currentRoom(from)
+	if sub == nil || sub.ParentID == "" {
+		t.Fatal("inviter is not in a sub-channel")
+	}
+	return sub
+}
+
+func roomIDOf(p *Peer) string {
+	p.RLock()
+	defer p.RUnlock()
+	return p.RoomID
+}
+
+func hasSubChannel(main *Room, subID string) bool {
+	main.mu.RLock()
+	defer main.mu.RUnlock()
+	_, ok := main.SubChannels[subID]
+	return ok
+}
+
+func hasRoom(h *Hub, roomID string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	_, ok := h.Rooms[roomID]
+	return ok
+}
+
+func TestSubChannelCountdownMovesLastPeer(t *testing.T) {
+	h, clock := newTestHub(t)
+	other, otherClock := newTestHub(t)
+
+	main, peers := newTestRoom(t, h, "alice", "bob", "carol")
+	alice, bob := peers[0], peers[1]
+	sub := openSubChannel(t, h, alice, bob)
+
+	otherMain, otherPeers := newTestRoom(t, other, "dave", "erin")
+	otherSub := openSubChannel(t, other, otherPeers[0], otherPeers[1])
+
+	// Bob leaves, which starts alice's countdown alone in the sub-channel.
+	h.HandleMoveToMain(bob)
+	sub.mu.RLock()
+	countdown := sub.CountdownExpiresAt
+	sub.mu.RUnlock()
+	if want := testEpoch.Add(5 * time.Minute).UnixMilli(); countdown != want {
+		t.Fatalf("countdown expires at %d, want %d", countdown, want)
+	}
+
+	clock.Advance(5*time.Minute - time.Second)
+	if got := roomIDOf(alice); got != sub.ID {
+		t.Fatalf("alice moved before the countdown ended, now in %s", got)
+	}
+
+	clock.Advance(2 * time.Second)
+	if got := roomIDOf(alice); got != main.ID {
+		t.Fatalf("alice in %s after the countdown, want main room %s", got, main.ID)
+	}
+	if hasSubChannel(main, sub.ID) {
+		t.Fatal("expired sub-channel still exists")
+	}
+	main.mu.RLock()
+	_, aliceInMain := main.Peers[alice.ID]
+	main.mu.RUnlock()
+	if !aliceInMain {
+		t.Fatal("alice is not a member of the main room")
+	}
+
+	// The other hub's clock has not moved, so its sub-channel is untouched.
+	if !hasSubChannel(otherMain, otherSub.ID) {
+		t.Fatal("sub-channel of the other hub was deleted")
+	}
+	if otherClock.Now() != testEpoch {
+		t.Fatalf("other hub's clock moved to %v", otherClock.Now())
+	}
+}
+
+func TestGCForceMovesPeerFromExpiredSubChannel(t *testing.T) {
+	h, clock := newTestHub(t)
+	main, peers := newTestRoom(t, h, "alice", "bob")
+	alice := peers[0]
+
+	// A sub-channel with one member whose countdown timer never ran, so only
+	// GC moves the member out once it expired.
+	sub := NewRoom("stale-sub", "stale", main.FullName, "", main.PasswordHash, clock)
+	sub.ParentID = main.ID
+	main.mu.Lock()
+	main.RemovePeer(alice.ID)
+	main.SubChannels[sub.ID] = sub
+	main.mu.Unlock()
+	alice.Lock()
+	alice.RoomID = sub.ID
+	alice.Unlock()
+	sub.mu.Lock()
+	sub.AddPeer(alice)
+	sub.Expiry = clock.Now()
+	sub.mu.Unlock()
+
+	clock.Advance(5 * time.Minute)
+	if !hasSubChannel(main, sub.ID) {
+		t.Fatal("GC removed the sub-channel before it expired")
+	}
+
+	clock.Advance(time.Minute)
+	if hasSubChannel(main, sub.ID) {
+		t.Fatal("GC kept the expired sub-channel")
+	}
+	if got := roomIDOf(alice); got != main.ID {
+		t.Fatalf("alice in %s after GC, want main room %s", got, main.ID)
+	}
+}
+
+func TestGCDeletesEmptyRoomAfterThirtyMinutes(t *testing.T) {
+	h, clock := newTestHub(t)
+	other, otherClock := newTestHub(t)
+
+	main, peers := newTestRoom(t, h, "alice")
+	otherMain, _ := newTestRoom(t, other, "bob")
+
+	h.RemovePeer(peers[0], false)
+	main.mu.RLock()
+	expiry := main.Expiry
+	main.mu.RUnlock()
+	if !expiry.Equal(testEpoch) {
+		t.Fatalf("empty room expiry %v, want %v", expiry, testEpoch)
+	}
+
+	clock.Advance(30 * time.Minute)
+	if !hasRoom(h, main.ID) {
+		t.Fatal("room deleted before 30 minutes")
+	}
+	clock.Advance(time.Minute)
+	if hasRoom(h, main.ID) {
+		t.Fatal("empty room not deleted after 30 minutes")
+	}
+
+	otherClock.Advance(time.Hour)
+	if !hasRoom(other, otherMain.ID) {
+		t.Fatal("occupied room of the other hub was deleted")
+	}
+}
+
+func TestStopHaltsTimers(t *testing.T) {
+	h, clock := newTestHub(t)
+	main, peers := newTestRoom(t, h, "alice", "bob")
+	h.HandleSubInvite(peers[0], peers[1].ID, "side")
+	if clock.PendingTimers() == 0 {
+		t.Fatal("no timers scheduled after Start")
+	}
+
+	h.Stop()
+	if n := clock.PendingTimers(); n != 0 {
+		t.Fatalf("%d timers still scheduled after Stop", n)
+	}
+
+	h.RemovePeer(peers[0], false)
+	h.RemovePeer(peers[1], false)
+	clock.Advance(time.Hour)
+	if !hasRoom(h, main.ID) {
+		t.Fatal("GC ran after Stop")
+	}
+	if n := clock.PendingTimers(); n != 0 {
+		t.Fatalf("%d timers scheduled after Stop", n)
+	}
+}
+
+func TestSetupPeerMediaKeepsLivePeerConnection(t *testing.T) {
+	h, _ := newTestHub(t)
+	main, peers := newTestRoom(t, h, "alice")
+	alice := peers[0]
+
+	h.SetupPeerMedia(alice, main)
+	alice.RLock()
+	pc, epoch := alice.PC, alice.Epoch
+	alice.RUnlock()
+	if pc == nil {
+		t.Fatal("no PeerConnection after the first join")
+	}
+
+	// Joining again with a live PeerConnection renegotiates it in place.
+	h.SetupPeerMedia(alice, main)
+	alice.RLock()
+	defer alice.RUnlock()
+	if alice.PC != pc || alice.Epoch != epoch {
+		t.Fatalf("PeerConnection rebuilt: epoch %d, want %d", alice.Epoch, epoch)
+	}
+}
@@ -0,0 +1,161 @@
+package sfu
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// ICEConfig is the ICE server list shared by the server's PeerConnections and
+// the browser. TURN entries without a username get TURN REST API credentials
+// derived from RESTSecret (coturn's static-auth-secret) for each session.
+type ICEConfig struct {
+	Servers       []ICEServer
+	RESTSecret    string
+	CredentialTTL time.Duration
+}
+
+func defaultICEServers() []ICEServer {
+	return []ICEServer{
+		{URLs: []string{"stun:stun.l.google.com:19302"}},
+		{URLs: []string{"stun:stun1.l.google.com:19302"}},
+	}
+}
+
+func loadICEConfig() ICEConfig {
+	cfg := ICEConfig{
+		Servers:       defaultICEServers(),
+		RESTSecret:    os.Getenv("TURN_REST_SECRET"),
+		CredentialTTL: getEnvDuration("TURN_CREDENTIAL_TTL", 6*time.Hour),
+	}
+
+	raw := os.Getenv("ICE_SERVERS")
+	if strings.TrimSpace(raw) == "" {
+		return cfg
+	}
+	servers, err := parseICEServers(raw)
+	if err != nil {
+		hubLog.Warn("invalid ICE_SERVERS, using defaults", "err", err)
+		return cfg
+	}
+	cfg.Servers = servers
+	hubLog.Info("ICE servers configured", "count", len(servers))
+	return cfg
+}
+
+// parseICEServers accepts "none", a JSON array of RTCIceServer objects, or a
+// comma- or whitespace-separated list of stun:/turn:/turns: URLs.
+func parseICEServers(raw string) ([]ICEServer, error) {
+	raw = strings.TrimSpace(raw)
+	if strings.EqualFold(raw, "none") {
+		return []ICEServer{}, nil
+	}
+
+	if strings.HasPrefix(raw, "[") {
+		var entries []struct {
+			URLs       json.RawMessage `json:"urls"`
+			Username   string          `json:"username"`
+			Credential string          `json:"credential"`
+		}
+		if err := json.Unmarshal([]byte(raw), &entries); err != nil {
+			return nil, fmt.Errorf("parse JSON: %w", err)
+		}
+		servers := make([]ICEServer, 0, len(entries))
+		for i, e := range entries {
+			var urls []string
+			var single string
+			if err := json.Unmarshal(e.URLs, &single); err == nil {
+				urls = []string{single}
+			} else if err := json.Unmarshal(e.URLs, &urls); err != nil {
+				return nil, fmt.Errorf("entry %d: urls must be a string or array", i)
+			}
+			for _, u := range urls {
+				if err := validateICEURL(u); err != nil {
+					return nil, fmt.Errorf("entry %d: %w", i, err)
+				}
+			}
+			servers = append(servers, ICEServer{URLs: urls, Username: e.Username, Credential: e.Credential})
+		}
+		return servers, nil
+	}
+
+	fields := strings.FieldsFunc(raw, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n'
+	})
+	servers := make([]ICEServer, 0, len(fields))
+	for _, u := range fields {
+		if err := validateICEURL(u); err != nil {
+			return nil, err
+		}
+		servers = append(servers, ICEServer{URLs: []string{u}})
+	}
+	return servers, nil
+}
+
+func validateICEURL(u string) error {
+	for _, scheme := range []string{"stun:", "stuns:", "turn:", "turns:"} {
+		if strings.HasPrefix(u, scheme) {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported ICE server URL %q", u)
+}
+
+func isTURNServer(s ICEServer) bool {
+	for _, u := range s.URLs {
+		if strings.HasPrefix(u, "turn:") || strings.HasPrefix(u, "turns:") {
+			return true
+		}
+	}
+	return false
+}
+
+// ICEServers returns the ICE server list for a peer: the configured list,
+// with TURN REST credentials filled in for external TURN servers, plus the
+// embedded TURN server when it runs. The server and the client use the same
+// list.
+func (h *Hub) ICEServers(peerID string) []ICEServer {
+	cfg := h.cfg.ICE
+	servers := make([]ICEServer, 0, len(cfg.Servers)+1)
+	expiresAt := time.Now().Add(cfg.CredentialTTL)
+	for _, s := range cfg.Servers {
+		s.URLs = append([]string(nil), s.URLs...)
+		if s.Username == "" && cfg.RESTSecret != "" && isTURNServer(s) {
+			s.Username, s.Credential = turnCredentials(cfg.RESTSecret, peerID, expiresAt)
+		}
+		servers = append(servers, s)
+	}
+
+	h.mu.RLock()
+	secret := h.turnSecret
+	urls := h.turnURLs
+	h.mu.RUnlock()
+
+	if len(urls) > 0 {
+		username, credential := turnCredentials(secret, peerID, time.Now().Add(h.cfg.TURN.CredentialTTL))
+		servers = append(servers, ICEServer{
+			URLs:       urls,
+			Username:   username,
+			Credential: credential,
+		})
+	}
+	return servers
+}
+
+func toWebRTCICEServers(servers []ICEServer) []webrtc.ICEServer {
+	out := make([]webrtc.ICEServer, 0, len(servers))
+	for _, s := range servers {
+		ws := webrtc.ICEServer{URLs: s.URLs}
+		if s.Username != "" {
+			ws.Username = s.Username
+			ws.Credential = s.Credential
+			ws.CredentialType = webrtc.ICECredentialTypePassword
+		}
+		out = append(out, ws)
+	}
+	return out
+}
@@ -0,0 +1,316 @@
+package sfu
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// testClient is a peer whose WebSocket is read by the test, so the events
+// the hub sends it can be asserted on.
+type testClient struct {
+	*Peer
+	events chan Envelope
+}
+
+// newTestClient connects a peer named id over a loopback WebSocket.
+func newTestClient(t *testing.T, id string) *testClient {
+	t.Helper()
+	serverConns := make(chan *websocket.Conn, 1)
+	var upgrader websocket.Upgrader
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		serverConns <- conn
+	}))
+	t.Cleanup(srv.Close)
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	server := <-serverConns
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+
+	c := &testClient{
+		Peer:   &Peer{ID: id, Name: id, Conn: server},
+		events: make(chan Envelope, 256),
+	}
+	go func() {
+		defer close(c.events)
+		for {
+			var env Envelope
+			if err := client.ReadJSON(&env); err != nil {
+				return
+			}
+			c.events <- env
+		}
+	}()
+	return c
+}
+
+// expect waits for the next event of type msgType, skipping others such as
+// offers, and decodes its payload into v when v is not nil.
+func (c *testClient) expect(t *testing.T, msgType string, v any) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case env, ok := <-c.events:
+			if !ok {
+				t.Fatalf("%s: connection closed waiting for %q", c.ID, msgType)
+			}
+			if env.Type != msgType {
+				continue
+			}
+			if v != nil {
+				if err := json.Unmarshal(env.Payload, v); err != nil {
+					t.Fatalf("%s: decode %q: %v", c.ID, msgType, err)
+				}
+			}
+			return
+		case <-timeout:
+			t.Fatalf("%s: no %q event", c.ID, msgType)
+		}
+	}
+}
+
+// expectRoomUpdate waits for a room update that satisfies match, skipping
+// the ones sent for earlier changes.
+func (c *testClient) expectRoomUpdate(t *testing.T, match func(RoomUpdatePayload) bool) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case env, ok := <-c.events:
+			if !ok {
+				t.Fatalf("%s: connection closed waiting for a room update", c.ID)
+			}
+			if env.Type != "room-update" {
+				continue
+			}
+			var u RoomUpdatePayload
+			if err := json.Unmarshal(env.Payload, &u); err != nil {
+				t.Fatalf("%s: decode room update: %v", c.ID, err)
+			}
+			if match(u) {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("%s: no matching room update", c.ID)
+		}
+	}
+}
+
+// join has c join with payload and fails the test on an error.
+func (c *testClient) join(t *testing.T, h *Hub, payload JoinPayload) (*Room, string) {
+	t.Helper()
+	room, token, _, err := h.JoinRoom(payload, c.Peer)
+	if err != nil {
+		t.Fatalf("%s: join: %v", c.ID, err)
+	}
+	if token == "" {
+		t.Fatalf("%s: join returned no session token", c.ID)
+	}
+	return room, token
+}
+
+func userIDs(users []UserInfo) map[string]bool {
+	ids := make(map[string]bool, len(users))
+	for _, u := range users {
+		ids[u.ID] = true
+	}
+	return ids
+}
+
+func TestCreateAndJoinRoom(t *testing.T) {
+	h, _ := newTestHub(t)
+	alice := newTestClient(t, "alice")
+	room, err := h.CreateRoom("Team", "secret-pass", "", alice.Peer, "10.0.0.1")
+	if err != nil {
+		t.Fatalf("CreateRoom: %v", err)
+	}
+	if room.OwnerID != alice.ID || roomIDOf(alice.Peer) != room.ID {
+		t.Fatalf("creator not the owner and member of the room")
+	}
+	if !strings.HasPrefix(room.FullName, "Team#") {
+		t.Fatalf("full name %q, want Team#<suffix>", room.FullName)
+	}
+
+	bob := newTestClient(t, "bob")
+	if got, _ := bob.join(t, h, JoinPayload{Username: "bob", ChannelName: room.FullName, Password: "secret-pass"}); got != room {
+		t.Fatal("join by name returned another room")
+	}
+
+	carol := newTestClient(t, "carol")
+	_, _, _, err = h.JoinRoom(JoinPayload{Username: "carol", ChannelName: room.FullName, Password: "wrong-pass"}, carol.Peer)
+	if signalCode(err) != ErrPasswordWrong {
+		t.Fatalf("wrong password: %v", err)
+	}
+	_, _, _, err = h.JoinRoom(JoinPayload{Username: "bob", InviteToken: room.InviteToken}, carol.Peer)
+	if signalCode(err) != ErrNameTaken {
+		t.Fatalf("taken name: %v", err)
+	}
+	if got, _ := carol.join(t, h, JoinPayload{Username: "carol", InviteToken: room.InviteToken}); got != room {
+		t.Fatal("join by invite returned another room")
+	}
+
+	h.BroadcastRoomUpdatePublic(room)
+	var update RoomUpdatePayload
+	alice.expect(t, "room-update", &update)
+	if ids := userIDs(update.Users); len(ids) != 3 || !ids[bob.ID] || !ids[carol.ID] {
+		t.Fatalf("room update users %v, want alice, bob and carol", ids)
+	}
+}
+
+func TestMoveBetweenChannels(t *testing.T) {
+	h, _ := newTestHub(t)
+	alice, bob, carol := newTestClient(t, "alice"), newTestClient(t, "bob"), newTestClient(t, "carol")
+	room, err := h.CreateRoom("Team", "secret-pass", "", alice.Peer, "")
+	if err != nil {
+		t.Fatalf("CreateRoom: %v", err)
+	}
+	bob.join(t, h, JoinPayload{Username: "bob", InviteToken: room.InviteToken})
+	carol.join(t, h, JoinPayload{Username: "carol", InviteToken: room.InviteToken})
+
+	h.HandleSubInvite(alice.Peer, bob.ID, "side")
+	var invite InviteReqPayload
+	bob.expect(t, "invite-req", &invite)
+	if invite.FromUserID != alice.ID || invite.ChannelName != "side" {
+		t.Fatalf("invite %+v, want one from alice for side", invite)
+	}
+	h.HandleSubResponse(bob.Peer, invite.InviteID, true)
+
+	sub := h.currentRoom(alice.Peer)
+	if sub == nil || sub.ParentID != room.ID || roomIDOf(bob.Peer) != sub.ID {
+		t.Fatal("alice and bob are not in a new sub-channel")
+	}
+	carol.expectRoomUpdate(t, func(u RoomUpdatePayload) bool {
+		return len(u.SubChannels) == 1 && len(u.SubChannels[0].Users) == 2
+	})
+
+	h.HandleMoveToSub(carol.Peer, sub.ID)
+	if roomIDOf(carol.Peer) != sub.ID {
+		t.Fatalf("carol in %s, want sub-channel %s", roomIDOf(carol.Peer), sub.ID)
+	}
+	var history ChatHistoryPayload
+	carol.expect(t, "chat-history", &history)
+	if history.ChannelID != sub.ID {
+		t.Fatalf("chat history of %s, want the sub-channel's", history.ChannelID)
+	}
+
+	h.HandleMoveToMain(bob.Peer)
+	if roomIDOf(bob.Peer) != room.ID {
+		t.Fatalf("bob in %s, want main room", roomIDOf(bob.Peer))
+	}
+	bob.expect(t, "chat-history", &history)
+	if history.ChannelID != room.ID {
+		t.Fatalf("chat history of %s, want the main room's", history.ChannelID)
+	}
+	// Alice is eventually told that only she and carol are left in the
+	// sub-channel.
+	alice.expectRoomUpdate(t, func(u RoomUpdatePayload) bool {
+		if len(u.SubChannels) != 1 {
+			return false
+		}
+		ids := userIDs(u.SubChannels[0].Users)
+		return len(ids) == 2 && ids[alice.ID] && ids[carol.ID]
+	})
+}
+
+func TestSessionReconnect(t *testing.T) {
+	h, _ := newTestHub(t)
+	alice, bob := newTestClient(t, "alice"), newTestClient(t, "bob")
+	room, err := h.CreateRoom("Team", "secret-pass", "", alice.Peer, "")
+	if err != nil {
+		t.Fatalf("CreateRoom: %v", err)
+	}
+	_, token := bob.join(t, h, JoinPayload{Username: "bob", InviteToken: room.InviteToken})
+	sub := openSubChannel(t, h, alice.Peer, bob.Peer)
+
+	// Bob's WebSocket drops; the handler keeps the session.
+	h.RemovePeer(bob.Peer, true)
+
+	again := newTestClient(t, "bob-again")
+	got, newToken, notice, err := h.JoinRoom(JoinPayload{Username: "bob", SessionToken: token}, again.Peer)
+	if err != nil {
+		t.Fatalf("reconnect: %v", err)
+	}
+	if got != sub || notice != "" {
+		t.Fatalf("reconnected to %s with notice %q, want sub-channel %s", got.ID, notice, sub.ID)
+	}
+	if again.ID != bob.ID || again.Name != "bob" {
+		t.Fatalf("reconnected as %s (%s), want bob's identity", again.ID, again.Name)
+	}
+	if newToken == "" || newToken == token {
+		t.Fatal("session token not rotated")
+	}
+	sub.mu.RLock()
+	member := sub.Peers[bob.ID]
+	sub.mu.RUnlock()
+	if member != again.Peer {
+		t.Fatal("reconnected peer is not the sub-channel member")
+	}
+
+	// The old token is spent.
+	_, _, _, err = h.JoinRoom(JoinPayload{Username: "bob", SessionToken: token}, newTestClient(t, "bob-stale").Peer)
+	if signalCode(err) != ErrInvalidMessage {
+		t.Fatalf("reused session token: %v", err)
+	}
+
+	// Once the sub-channel is gone, a reconnect lands in the main room with
+	// a notice.
+	h.RemovePeer(again.Peer, true)
+	h.HandleMoveToMain(alice.Peer)
+	if hasSubChannel(room, sub.ID) {
+		t.Fatal("empty sub-channel kept")
+	}
+	last := newTestClient(t, "bob-last")
+	got, _, notice, err = h.JoinRoom(JoinPayload{Username: "bob", SessionToken: newToken}, last.Peer)
+	if err != nil {
+		t.Fatalf("reconnect: %v", err)
+	}
+	if got != room || notice == "" {
+		t.Fatalf("reconnected to %s with notice %q, want the main room with a notice", got.ID, notice)
+	}
+}
+
+func TestCreateRoomRateLimitedPerIP(t *testing.T) {
+	h, clock := newTestHub(t)
+	create := func(name, ip string) error {
+		_, err := h.CreateRoom(name, "secret-pass", "", &Peer{ID: name, Name: name}, ip)
+		return err
+	}
+
+	for i, name := range []string{"one", "two", "three"} {
+		if err := create(name, "10.0.0.9"); err != nil {
+			t.Fatalf("create %d: %v", i+1, err)
+		}
+		clock.Advance(time.Minute)
+	}
+	err := create("four", "10.0.0.9")
+	if signalCode(err) != ErrRateLimited {
+		t.Fatalf("fourth create: %v", err)
+	}
+	if sigErr := err.(*SignalError); sigErr.RetryAfter != 7*time.Minute {
+		t.Fatalf("retry after %v, want 7m", sigErr.RetryAfter)
+	}
+	if err := create("other", "10.0.0.10"); err != nil {
+		t.Fatalf("create from another IP: %v", err)
+	}
+
+	clock.Advance(7 * time.Minute)
+	if err := create("four", "10.0.0.9"); err != nil {
+		t.Fatalf("create after the window: %v", err)
+	}
+}
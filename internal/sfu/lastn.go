@@ -0,0 +1,359 @@
+package sfu
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+)
+
+// maxLastN bounds the number of outbound slots a listener can be given.
+const maxLastN = 16
+
+// opusClockRate is the RTP clock rate of Opus, used to advance slot
+// timestamps across speaker switches.
+const opusClockRate = 48000
+
+// LastNConfig controls last-N speaker forwarding. Speakers is the slot count
+// applied to new main rooms (0 forwards every participant); operators can
+// change it per room through the admin API. SwitchHold is the minimum time a
+// speaker keeps its slot before a louder one may take it over.
+type LastNConfig struct {
+	Speakers   int
+	SwitchHold time.Duration
+}
+
+func loadLastNConfig() LastNConfig {
+	return LastNConfig{
+		Speakers:   getEnvIntBounded("LAST_N_SPEAKERS", 0, 0, maxLastN),
+		SwitchHold: getEnvDuration("LAST_N_SWITCH_HOLD", time.Second),
+	}
+}
+
+// lastNSelector assigns a room's speakers to its N forwarding slots from
+// their audio levels. A speaker that starts talking takes a free slot or
+// replaces the holder that has been silent longest; when every holder is
+// talking it replaces the quietest one if it is louder.
+type lastNSelector struct {
+	hold time.Duration
+
+	mu    sync.Mutex
+	slots []lastNSlot
+}
+
+type lastNSlot struct {
+	peerID     string
+	assignedAt time.Time
+	lastActive time.Time
+	level      float64 // smoothed audio level in -dBov, lower is louder
+	speaking   bool
+}
+
+func newLastNSelector(n int, hold time.Duration) *lastNSelector {
+	return &lastNSelector{hold: hold, slots: make([]lastNSlot, n)}
+}
+
+func (s *lastNSelector) size() int {
+	return len(s.slots)
+}
+
+// observe updates peerID's activity from its speech detector and returns the
+// slot it should be forwarded on, or -1, and whether the slot assignment
+// changed. Peers without the audio level extension only take free slots.
+func (s *lastNSelector) observe(peerID string, speech *speechDetector, now time.Time) (int, bool) {
+	level := 127.0
+	speaking := false
+	if speech != nil {
+		level = speech.smoothed
+		speaking = speech.speaking
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	free := -1
+	for i := range s.slots {
+		slot := &s.slots[i]
+		if slot.peerID == peerID {
+			slot.level = level
+			slot.speaking = speaking
+			if speaking {
+				slot.lastActive = now
+			}
+			return i, false
+		}
+		if slot.peerID == "" && free < 0 {
+			free = i
+		}
+	}
+
+	if !speaking && (speech != nil || free < 0) {
+		return -1, false
+	}
+
+	victim := free
+	if victim < 0 {
+		victim = s.pickVictimLocked(level, now)
+		if victim < 0 {
+			return -1, false
+		}
+	}
+	s.slots[victim] = lastNSlot{
+		peerID:     peerID,
+		assignedAt: now,
+		lastActive: now,
+		level:      level,
+		speaking:   speaking,
+	}
+	return victim, true
+}
+
+// pickVictimLocked returns the slot a speaker at level may take over, or -1.
+// Slots assigned less than hold ago are kept to avoid flapping.
+func (s *lastNSelector) pickVictimLocked(level float64, now time.Time) int {
+	victim := -1
+	for i, slot := range s.slots {
+		if now.Sub(slot.assignedAt) < s.hold {
+			continue
+		}
+		if slot.speaking {
+			continue
+		}
+		if victim < 0 || slot.lastActive.Before(s.slots[victim].lastActive) {
+			victim = i
+		}
+	}
+	if victim >= 0 {
+		return victim
+	}
+
+	for i, slot := range s.slots {
+		if now.Sub(slot.assignedAt) < s.hold || slot.level <= level {
+			continue
+		}
+		if victim < 0 || slot.level > s.slots[victim].level {
+			victim = i
+		}
+	}
+	return victim
+}
+
+// release frees the slot held by peerID and reports whether it held one.
+func (s *lastNSelector) release(peerID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.slots {
+		if s.slots[i].peerID == peerID {
+			s.slots[i] = lastNSlot{}
+			return true
+		}
+	}
+	return false
+}
+
+// assignments returns the peer ID held by each slot, "" for free slots.
+func (s *lastNSelector) assignments() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := make([]string, len(s.slots))
+	for i, slot := range s.slots {
+		ids[i] = slot.peerID
+	}
+	return ids
+}
+
+// slotTrack is one of a listener's last-N outbound tracks. It carries
+// whichever speaker holds the slot and rewrites sequence numbers and
+// timestamps so the receiver sees one continuous stream across switches.
+type slotTrack struct {
+	*ForwardTrack
+
+	mu       sync.Mutex
+	source   string
+	seqDelta uint16
+	tsDelta  uint32
+	lastSeq  uint16
+	lastTS   uint32
+	lastAt   time.Time
+	started  bool
+}
+
+func newSlotTrack(index int) *slotTrack {
+	return &slotTrack{
+		ForwardTrack: NewForwardTrack(
+			webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus},
+			fmt.Sprintf("audio-slot-%d", index),
+			fmt.Sprintf("slot-%d", index),
+		),
+	}
+}
+
+// writeFrom forwards pkt from source. On a switch to a new source the
+// sequence number continues from the last packet sent and the timestamp
+// advances by the wall-clock time since then; the first packet of the new
+// source is marked as the start of a talkspurt and starts a new RED
+// history.
+func (s *slotTrack) writeFrom(source string, pkt *rtp.Packet, srcExtensions map[uint8]string, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hdr := pkt.Header
+	if source != s.source {
+		if s.started {
+			gap := uint32(now.Sub(s.lastAt) * opusClockRate / time.Second)
+			if gap == 0 {
+				gap = opusClockRate / 50
+			}
+			s.seqDelta = s.lastSeq + 1 - pkt.SequenceNumber
+			s.tsDelta = s.lastTS + gap - pkt.Timestamp
+		}
+		s.source = source
+		hdr.Marker = true
+		// The new source's first RED packets must not carry the previous
+		// source's frames as redundancy.
+		s.resetHistory()
+	}
+
+	hdr.SequenceNumber += s.seqDelta
+	hdr.Timestamp += s.tsDelta
+	if !s.started || int16(hdr.SequenceNumber-s.lastSeq) > 0 {
+		s.lastSeq = hdr.SequenceNumber
+		s.lastTS = hdr.Timestamp
+		s.lastAt = now
+		s.started = true
+	}
+
+	return s.WriteRTP(&rtp.Packet{Header: hdr, Payload: pkt.Payload}, srcExtensions)
+}
+
+// selector returns the room's last-N selector, or nil when the room forwards
+// every participant.
+func (r *Room) selector() *lastNSelector {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.lastN
+}
+
+// slotTracks returns the first n last-N slot tracks of peer, creating them
+// on first use. They outlive channel moves like the PeerConnection does.
+func (p *Peer) slotTracks(n int) []*slotTrack {
+	p.Lock()
+	defer p.Unlock()
+
+	for len(p.slots) < n {
+		p.slots = append(p.slots, newSlotTrack(len(p.slots)))
+	}
+	return p.slots[:n]
+}
+
+// forwardLastN writes pkt from speaker to the given slot of every other
+// listener in room.
+func (h *Hub) forwardLastN(room *Room, speakerID string, slot int, pkt *rtp.Packet, srcExtensions map[uint8]string, now time.Time) error {
+	room.mu.RLock()
+	targets := make([]*slotTrack, 0, len(room.Peers))
+	for id, p := range room.Peers {
+		if id == speakerID {
+			continue
+		}
+		p.RLock()
+		if slot < len(p.slots) {
+			targets = append(targets, p.slots[slot])
+		}
+		p.RUnlock()
+	}
+	room.mu.RUnlock()
+
+	var errs []error
+	for _, t := range targets {
+		if err := t.writeFrom(speakerID, pkt, srcExtensions, now); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// addSlotTracksToPeer gives targetPeer a sender for each of room's last-N
+// slots and tells it which speaker each slot carries. Like
+// AddRoomTracksToPeer it does not renegotiate.
+func (h *Hub) addSlotTracksToPeer(targetPeer *Peer, room *Room, sel *lastNSelector) bool {
+	targetPeer.RLock()
+	pc := targetPeer.PC
+	targetPeer.RUnlock()
+	if pc == nil {
+		return false
+	}
+
+	addedAny := false
+	for i, track := range targetPeer.slotTracks(sel.size()) {
+		if hasSenderForTrack(pc, track) {
+			continue
+		}
+		transceiver, err := pc.AddTransceiverFromTrack(track, webrtc.RTPTransceiverInit{
+			Direction: webrtc.RTPTransceiverDirectionSendonly,
+		})
+		if err != nil {
+			mediaLog.Warn("add slot track failed", "peer_id", targetPeer.ID, "room_id", room.ID, "slot", i, "err", err)
+			continue
+		}
+		if transceiver != nil && transceiver.Sender() != nil {
+			h.readSenderRTCP(transceiver.Sender())
+		}
+		addedAny = true
+	}
+
+	targetPeer.SendJSON("last-n", LastNPayload{ChannelID: room.ID, Slots: sel.assignments()})
+	return addedAny
+}
+
+func (h *Hub) broadcastLastN(room *Room) {
+	payload := LastNPayload{ChannelID: room.ID, Slots: []string{}}
+	if sel := room.selector(); sel != nil {
+		payload.Slots = sel.assignments()
+	}
+	room.BroadcastToChannel("last-n", payload, "")
+}
+
+// SetLastN switches a main room or sub-channel to last-N forwarding with n
+// slots, or back to forwarding every participant when n is 0. Members keep
+// their PeerConnections and are renegotiated.
+func (h *Hub) SetLastN(roomID string, n int) (*Room, error) {
+	if n < 0 || n > maxLastN {
+		return nil, NewSignalError(ErrInvalidMessage, fmt.Sprintf("Speakers must be between 0 and %d", maxLastN))
+	}
+	room := h.findRoom(roomID)
+	if room == nil {
+		return nil, NewSignalError(ErrChannelNotFound, "Room not found")
+	}
+
+	room.mu.Lock()
+	if (room.lastN == nil && n == 0) || (room.lastN != nil && room.lastN.size() == n) {
+		room.mu.Unlock()
+		return room, nil
+	}
+	if n == 0 {
+		room.lastN = nil
+	} else {
+		room.lastN = newLastNSelector(n, h.cfg.LastN.SwitchHold)
+	}
+	peers := make([]*Peer, 0, len(room.Peers))
+	for _, p := range room.Peers {
+		peers = append(peers, p)
+	}
+	room.mu.Unlock()
+
+	if n > 0 {
+		h.stopListeners(room)
+	}
+	for _, p := range peers {
+		h.syncPeerMedia(p, room)
+	}
+	h.broadcastLastN(room)
+
+	hubLog.Info("admin: last-N forwarding changed", "room_id", roomID, "speakers", n)
+	return room, nil
+}
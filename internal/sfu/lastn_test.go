@@ -0,0 +1,49 @@
+package sfu
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+)
+
+func TestSlotTrackResetsREDHistoryOnSourceSwitch(t *testing.T) {
+	slot := newSlotTrack(0)
+	ctx := &testTrackContext{id: "listener", ssrc: 3333, payloadType: 111, redPT: 63}
+	if _, err := slot.Bind(ctx); err != nil {
+		t.Fatalf("bind: %v", err)
+	}
+	slot.setRED(ctx.ssrc, true)
+
+	now := testEpoch
+	write := func(source string, seq uint16, ts uint32, payload []byte) []byte {
+		t.Helper()
+		pkt := &rtp.Packet{
+			Header:  rtp.Header{Version: 2, PayloadType: 111, SequenceNumber: seq, Timestamp: ts, SSRC: 1},
+			Payload: payload,
+		}
+		if err := slot.writeFrom(source, pkt, nil, now); err != nil {
+			t.Fatalf("writeFrom %s: %v", source, err)
+		}
+		now = now.Add(20 * time.Millisecond)
+		got := ctx.last(t)
+		if got.header.PayloadType != 63 {
+			t.Fatalf("payload type %d, want RED", got.header.PayloadType)
+		}
+		return got.payload
+	}
+
+	alice := []byte{0xfc, 0xa1}
+	write("alice", 100, 960, alice)
+	if red := write("alice", 101, 1920, alice); len(red) == 1+len(alice) {
+		t.Fatal("second frame of a source carries no redundancy")
+	}
+
+	// The slot switches to bob: his first packet has only the primary block,
+	// a one-byte header followed by his frame.
+	bob := []byte{0xfc, 0xb0}
+	red := write("bob", 5000, 480000, bob)
+	if len(red) != 1+len(bob) || red[0] != 111 {
+		t.Fatalf("first RED packet after the switch is %x, want no redundant blocks", red)
+	}
+}
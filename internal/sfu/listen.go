@@ -0,0 +1,363 @@
+package sfu
+
+import (
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pion/webrtc/v3"
+)
+
+// Listen-in lets a peer hear a sub-channel of its main room without joining
+// it. The listener is sent the members' audio but publishes nothing into the
+// sub-channel, which lists it in SubChannelInfo.Listeners. The main room's
+// owner moderates and listens right away; anyone else needs every member's
+// consent.
+
+// listenRequestTimeout is how long members have to answer a listen request.
+const listenRequestTimeout = 30 * time.Second
+
+// listenRequest is a listen-in waiting for the members of a sub-channel to
+// consent.
+type listenRequest struct {
+	listener *Peer
+	awaiting map[string]bool // members that have not answered yet
+	timer    Timer
+}
+
+// listenerIDsLocked lists the peers listening in on r. r.mu must be held.
+func (r *Room) listenerIDsLocked() []string {
+	if len(r.listeners) == 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(r.listeners))
+	for id := range r.listeners {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// membersExcept returns r's members other than peerID.
+func (r *Room) membersExcept(peerID string) []*Peer {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	peers := make([]*Peer, 0, len(r.Peers))
+	for id, p := range r.Peers {
+		if id != peerID {
+			peers = append(peers, p)
+		}
+	}
+	return peers
+}
+
+// StartListening lets peer listen in on the sub-channel channelID. The room
+// owner starts right away; for anyone else every member is asked with a
+// "listen-request" and listening starts once all of them accepted.
+func (h *Hub) StartListening(peer *Peer, channelID string) error {
+	mainRoom, sub, err := h.channelForPeer(peer, channelID)
+	if err != nil {
+		return err
+	}
+	if sub == mainRoom {
+		return NewSignalError(ErrInvalidMessage, "Only sub-channels can be listened to")
+	}
+	peer.RLock()
+	inSub := peer.RoomID == sub.ID
+	listening := peer.listeningTo == sub.ID
+	name := peer.Name
+	peer.RUnlock()
+	if inSub || listening {
+		return nil
+	}
+	if sub.selector() != nil {
+		return NewSignalError(ErrInvalidMessage, "Listen-in is not available in last-N channels")
+	}
+
+	if canManage(peer, mainRoom, mainRoom) {
+		h.startListening(peer, sub)
+		return nil
+	}
+
+	members := sub.membersExcept(peer.ID)
+	if len(members) == 0 {
+		h.startListening(peer, sub)
+		return nil
+	}
+	requestID := uuid.New().String()
+	req := &listenRequest{listener: peer, awaiting: make(map[string]bool, len(members))}
+	for _, m := range members {
+		req.awaiting[m.ID] = true
+	}
+
+	sub.mu.Lock()
+	for _, pending := range sub.listenRequests {
+		if pending.listener == peer {
+			sub.mu.Unlock()
+			return nil
+		}
+	}
+	if sub.listenRequests == nil {
+		sub.listenRequests = make(map[string]*listenRequest)
+	}
+	sub.listenRequests[requestID] = req
+	req.timer = h.clock.AfterFunc(listenRequestTimeout, func() {
+		h.expireListenRequest(sub, requestID)
+	})
+	sub.mu.Unlock()
+
+	payload := ListenRequestPayload{
+		RequestID:  requestID,
+		FromUserID: peer.ID,
+		FromName:   name,
+		ChannelID:  sub.ID,
+	}
+	for _, m := range members {
+		m.SendJSON("listen-request", payload)
+	}
+	hubLog.Info("listen-in requested", "peer_id", peer.ID, "room_id", sub.ID, "members", len(members))
+	return nil
+}
+
+// HandleListenResponse records a member's answer to a listen request. One
+// refusal denies it; the last acceptance starts listening.
+func (h *Hub) HandleListenResponse(peer *Peer, requestID string, accepted bool) error {
+	sub := h.currentRoom(peer)
+	if sub == nil {
+		return NewSignalError(ErrChannelNotFound, "Room not found")
+	}
+
+	sub.mu.Lock()
+	req, ok := sub.listenRequests[requestID]
+	if !ok || !req.awaiting[peer.ID] {
+		sub.mu.Unlock()
+		return NewSignalError(ErrInviteExpired, "Listen request has expired or was not found")
+	}
+	delete(req.awaiting, peer.ID)
+	done := !accepted || len(req.awaiting) == 0
+	if done {
+		delete(sub.listenRequests, requestID)
+		req.timer.Stop()
+	}
+	sub.mu.Unlock()
+
+	switch {
+	case !accepted:
+		req.listener.SendSignalError(NewSignalError(ErrListenDenied, "A member of the sub-channel declined to be listened to"))
+	case done:
+		h.startListening(req.listener, sub)
+	}
+	return nil
+}
+
+// expireListenRequest denies a listen request that not every member
+// answered in time.
+func (h *Hub) expireListenRequest(sub *Room, requestID string) {
+	sub.mu.Lock()
+	req, ok := sub.listenRequests[requestID]
+	delete(sub.listenRequests, requestID)
+	sub.mu.Unlock()
+
+	if ok {
+		req.listener.SendSignalError(NewSignalError(ErrListenDenied, "Not every member of the sub-channel agreed in time"))
+	}
+}
+
+// startListening adds peer to sub's listeners, replacing any sub-channel it
+// listened to before, and sends it the members' audio.
+func (h *Hub) startListening(peer *Peer, sub *Room) {
+	peer.RLock()
+	stillHere := peer.MainRoomID == sub.ParentID && peer.RoomID != sub.ID
+	previous := peer.listeningTo
+	peer.RUnlock()
+	if !stillHere {
+		return
+	}
+	if previous != "" {
+		h.StopListening(peer)
+	}
+
+	sub.mu.Lock()
+	if sub.listeners == nil {
+		sub.listeners = make(map[string]*Peer)
+	}
+	sub.listeners[peer.ID] = peer
+	sub.mu.Unlock()
+
+	peer.Lock()
+	peer.listeningTo = sub.ID
+	peer.Unlock()
+
+	if h.addListenTracks(peer) {
+		go func() {
+			if err := h.NegotiateOffer(peer, false); err != nil {
+				signalingLog.Warn("listen-in offer failed", "peer_id", peer.ID, "room_id", sub.ID, "err", err)
+			}
+		}()
+	}
+
+	hubLog.Info("listen-in started", "peer_id", peer.ID, "room_id", sub.ID)
+	h.broadcastRoomUpdate(h.mainRoomOf(sub))
+}
+
+// StopListening ends peer's listen-in and removes the members' audio from
+// its PeerConnection.
+func (h *Hub) StopListening(peer *Peer) {
+	if sub := h.endListening(peer); sub != nil {
+		h.removeListenTracks(peer, sub)
+		hubLog.Info("listen-in stopped", "peer_id", peer.ID, "room_id", sub.ID)
+		h.broadcastRoomUpdate(h.mainRoomOf(sub))
+	}
+}
+
+// endListening clears peer's listen-in state and returns the sub-channel it
+// listened to, if that still exists. It leaves the senders alone.
+func (h *Hub) endListening(peer *Peer) *Room {
+	peer.Lock()
+	subID := peer.listeningTo
+	peer.listeningTo = ""
+	peer.Unlock()
+	if subID == "" {
+		return nil
+	}
+
+	sub := h.findRoom(subID)
+	if sub == nil {
+		return nil
+	}
+	sub.mu.Lock()
+	delete(sub.listeners, peer.ID)
+	sub.mu.Unlock()
+	return sub
+}
+
+// listenTracks returns the audio tracks of the sub-channel peer listens to.
+func (h *Hub) listenTracks(peer *Peer) []*ForwardTrack {
+	peer.RLock()
+	subID := peer.listeningTo
+	peer.RUnlock()
+	if subID == "" {
+		return nil
+	}
+	sub := h.findRoom(subID)
+	if sub == nil {
+		return nil
+	}
+
+	var tracks []*ForwardTrack
+	for _, m := range sub.membersExcept(peer.ID) {
+		m.RLock()
+		if m.Track != nil {
+			tracks = append(tracks, m.Track)
+		}
+		m.RUnlock()
+	}
+	return tracks
+}
+
+// addListenTracks gives a listener a sender for each member's audio in the
+// sub-channel it listens to. Like AddRoomTracksToPeer it does not
+// renegotiate.
+func (h *Hub) addListenTracks(listener *Peer) bool {
+	listener.RLock()
+	pc := listener.PC
+	listener.RUnlock()
+	if pc == nil {
+		return false
+	}
+
+	addedAny := false
+	for _, track := range h.listenTracks(listener) {
+		if hasSenderForTrack(pc, track) {
+			continue
+		}
+		transceiver, err := pc.AddTransceiverFromTrack(track, webrtc.RTPTransceiverInit{
+			Direction: webrtc.RTPTransceiverDirectionSendonly,
+		})
+		if err != nil {
+			mediaLog.Warn("add listen-in track failed", "peer_id", listener.ID, "track_id", track.ID(), "err", err)
+			continue
+		}
+		if transceiver != nil && transceiver.Sender() != nil {
+			h.readSenderRTCP(transceiver.Sender())
+		}
+		addedAny = true
+	}
+	return addedAny
+}
+
+// removeListenTracks removes the senders of sub's member audio from a
+// former listener and renegotiates it. The audio of a running all-call is
+// kept, even if the announcer is one of sub's members.
+func (h *Hub) removeListenTracks(listener *Peer, sub *Room) {
+	listener.RLock()
+	pc := listener.PC
+	listener.RUnlock()
+	if pc == nil {
+		return
+	}
+
+	remove := make(map[webrtc.TrackLocal]bool)
+	for _, m := range sub.membersExcept(listener.ID) {
+		m.RLock()
+		if m.Track != nil {
+			remove[m.Track] = true
+		}
+		m.RUnlock()
+	}
+	// A sub-channel member running an all-call keeps reaching the listener.
+	if track := h.allCallTrack(listener); track != nil {
+		delete(remove, track)
+	}
+
+	removed := false
+	for _, sender := range pc.GetSenders() {
+		if remove[sender.Track()] {
+			if err := pc.RemoveTrack(sender); err != nil {
+				mediaLog.Warn("remove listen-in track failed", "peer_id", listener.ID, "err", err)
+				continue
+			}
+			removed = true
+		}
+	}
+	if removed {
+		go func() {
+			if err := h.NegotiateOffer(listener, false); err != nil {
+				signalingLog.Warn("renegotiation after listen-in failed", "peer_id", listener.ID, "err", err)
+			}
+		}()
+	}
+}
+
+// stopListeners ends every listen-in on room.
+func (h *Hub) stopListeners(room *Room) {
+	room.mu.RLock()
+	listeners := make([]*Peer, 0, len(room.listeners))
+	for _, p := range room.listeners {
+		listeners = append(listeners, p)
+	}
+	room.mu.RUnlock()
+
+	for _, p := range listeners {
+		h.StopListening(p)
+	}
+}
+
+// endListenIns ends every listen-in on sub and denies its pending listen
+// requests. It runs before sub is deleted, while the listeners can still
+// find it to drop the members' audio.
+func (h *Hub) endListenIns(sub *Room) {
+	sub.mu.Lock()
+	requests := sub.listenRequests
+	sub.listenRequests = nil
+	for _, req := range requests {
+		req.timer.Stop()
+	}
+	sub.mu.Unlock()
+
+	for _, req := range requests {
+		req.listener.SendSignalError(NewSignalError(ErrListenDenied, "The sub-channel was closed"))
+	}
+	h.stopListeners(sub)
+}
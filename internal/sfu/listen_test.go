@@ -0,0 +1,136 @@
+package sfu
+
+import (
+	"testing"
+	"time"
+)
+
+// senderFor reports whether peer's PeerConnection has a sender for track.
+func senderFor(peer *Peer, track *ForwardTrack) bool {
+	peer.RLock()
+	pc := peer.PC
+	peer.RUnlock()
+	return pc != nil && track != nil && hasSenderForTrack(pc, track)
+}
+
+func TestStopListeningKeepsAllCallTrack(t *testing.T) {
+	h, _ := newTestHub(t)
+	main, peers := newTestRoom(t, h, "alice", "bob", "carol")
+	alice, bob, carol := peers[0], peers[1], peers[2]
+	for _, p := range peers {
+		h.SetupPeerMedia(p, main)
+	}
+	sub := openSubChannel(t, h, alice, bob)
+
+	if err := h.StartAllCall(alice); err != nil {
+		t.Fatalf("StartAllCall: %v", err)
+	}
+	h.startListening(carol, sub)
+	if !senderFor(carol, alice.Track) || !senderFor(carol, bob.Track) {
+		t.Fatal("listener is missing the sub-channel's audio")
+	}
+
+	h.StopListening(carol)
+	if senderFor(carol, bob.Track) {
+		t.Error("listen-in audio kept after StopListening")
+	}
+	if !senderFor(carol, alice.Track) {
+		t.Error("all-call audio removed with the listen-in")
+	}
+}
+
+func TestGCEndsListenInsOnExpiredSubChannel(t *testing.T) {
+	h, clock := newTestHub(t)
+	main, peers := newTestRoom(t, h, "alice", "bob", "carol")
+	alice, bob, carol := peers[0], peers[1], peers[2]
+	for _, p := range peers {
+		h.SetupPeerMedia(p, main)
+	}
+
+	// As in TestGCForceMovesPeerFromExpiredSubChannel, alice is alone in a
+	// sub-channel whose countdown never ran. Bob listens in on her and carol
+	// still waits for her consent when GC force-moves her out.
+	sub := NewRoom("stale-sub", "stale", main.FullName, "", main.PasswordHash, clock)
+	sub.ParentID = main.ID
+	main.mu.Lock()
+	main.RemovePeer(alice.ID)
+	main.SubChannels[sub.ID] = sub
+	main.mu.Unlock()
+	alice.Lock()
+	alice.RoomID = sub.ID
+	alice.Unlock()
+	sub.mu.Lock()
+	sub.AddPeer(alice)
+	sub.Expiry = clock.Now()
+	sub.mu.Unlock()
+
+	h.startListening(bob, sub)
+	if !senderFor(bob, alice.Track) {
+		t.Fatal("listener is missing the sub-channel's audio")
+	}
+
+	// GC deletes the sub-channel at the six minute mark, before carol's
+	// request would time out.
+	clock.Advance(6*time.Minute - listenRequestTimeout/2)
+	if err := h.StartListening(carol, sub.ID); err != nil {
+		t.Fatalf("StartListening: %v", err)
+	}
+	clock.Advance(listenRequestTimeout / 2)
+	if hasSubChannel(main, sub.ID) {
+		t.Fatal("GC kept the expired sub-channel")
+	}
+	bob.RLock()
+	listeningTo := bob.listeningTo
+	bob.RUnlock()
+	if listeningTo != "" {
+		t.Errorf("bob still listens in on %s", listeningTo)
+	}
+	sub.mu.RLock()
+	defer sub.mu.RUnlock()
+	if len(sub.listeners) != 0 || len(sub.listenRequests) != 0 {
+		t.Errorf("%d listeners and %d listen requests left", len(sub.listeners), len(sub.listenRequests))
+	}
+}
+
+func TestListenInsEndWhenSubChannelEmpties(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		leave func(h *Hub, p *Peer)
+	}{
+		{"move to main", func(h *Hub, p *Peer) { h.HandleMoveToMain(p) }},
+		{"disconnect", func(h *Hub, p *Peer) { h.RemovePeer(p, true) }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			h, _ := newTestHub(t)
+			main, peers := newTestRoom(t, h, "alice", "bob", "carol", "dave")
+			alice, bob, carol, dave := peers[0], peers[1], peers[2], peers[3]
+			for _, p := range peers {
+				h.SetupPeerMedia(p, main)
+			}
+			sub := openSubChannel(t, h, alice, bob)
+
+			// Carol listens in; dave still waits for the members' consent.
+			h.startListening(carol, sub)
+			if err := h.StartListening(dave, sub.ID); err != nil {
+				t.Fatalf("StartListening: %v", err)
+			}
+
+			tc.leave(h, bob)
+			tc.leave(h, alice)
+			if hasSubChannel(main, sub.ID) {
+				t.Fatal("empty sub-channel kept")
+			}
+			carol.RLock()
+			listeningTo := carol.listeningTo
+			carol.RUnlock()
+			if listeningTo != "" {
+				t.Errorf("carol still listens in on %s", listeningTo)
+			}
+			sub.mu.RLock()
+			defer sub.mu.RUnlock()
+			if len(sub.listeners) != 0 || len(sub.listenRequests) != 0 {
+				t.Errorf("%d listeners and %d listen requests left", len(sub.listeners), len(sub.listenRequests))
+			}
+		})
+	}
+}
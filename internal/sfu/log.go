@@ -0,0 +1,11 @@
+package sfu
+
+import "github.com/jo-sobo/qvoch/internal/logging"
+
+// Subsystem loggers. Records carry peer_id, room_id and, for negotiation,
+// epoch and seq attributes so a single peer's trace can be filtered.
+var (
+	hubLog       = logging.For(logging.Hub)
+	mediaLog     = logging.For(logging.Media)
+	signalingLog = logging.For(logging.Signaling)
+)
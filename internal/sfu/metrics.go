@@ -0,0 +1,125 @@
+package sfu
+
+import (
+	"github.com/jo-sobo/qvoch/internal/metrics"
+)
+
+type hubMetrics struct {
+	rtpReceived      *metrics.CounterVec
+	rtpForwarded     *metrics.CounterVec
+	rtpForwardError  *metrics.CounterVec
+	rtpMutedDropped  *metrics.CounterVec
+	iceRestarts      *metrics.Counter
+	answerTimeouts   *metrics.Counter
+	joinToConnected  *metrics.Histogram
+	selectedPairs    *metrics.CounterVec
+	nackRequests     *metrics.Counter
+	peerMoves        *metrics.CounterVec
+	keyframeRequests *metrics.Counter
+	redActivations   *metrics.Counter
+	whispers         *metrics.Counter
+}
+
+func newHubMetrics() *hubMetrics {
+	return &hubMetrics{
+		rtpReceived: metrics.NewCounterVec("qvoch_rtp_packets_received_total",
+			"RTP packets received from publishers.", "room_id"),
+		rtpForwarded: metrics.NewCounterVec("qvoch_rtp_packets_forwarded_total",
+			"RTP packets written to the forwarding track.", "room_id"),
+		rtpForwardError: metrics.NewCounterVec("qvoch_rtp_forward_errors_total",
+			"RTP packets that failed to forward to at least one receiver.", "room_id"),
+		rtpMutedDropped: metrics.NewCounterVec("qvoch_rtp_packets_muted_dropped_total",
+			"RTP packets dropped because the publisher is muted.", "room_id"),
+		iceRestarts: metrics.NewCounter("qvoch_ice_restarts_total",
+			"ICE restart offers sent to clients."),
+		answerTimeouts: metrics.NewCounter("qvoch_answer_timeouts_total",
+			"Offers that received no answer within the negotiation timeout."),
+		joinToConnected: metrics.NewHistogram("qvoch_join_to_connected_seconds",
+			"Time from a successful create/join to the first connected PeerConnection.",
+			[]float64{0.25, 0.5, 1, 2, 3, 5, 8, 13, 21}),
+		selectedPairs: metrics.NewCounterVec("qvoch_ice_selected_pairs_total",
+			"Connected PeerConnections by selected candidate pair transport and remote candidate type.",
+			"protocol", "remote_type"),
+		nackRequests: metrics.NewCounter("qvoch_rtcp_nack_packets_total",
+			"RTP packets receivers asked to be retransmitted via RTCP NACK."),
+		peerMoves: metrics.NewCounterVec("qvoch_peer_moves_total",
+			"Channel moves by whether the PeerConnection was reused or rebuilt.", "pc"),
+		keyframeRequests: metrics.NewCounter("qvoch_keyframe_requests_total",
+			"Keyframe requests relayed to video publishers as RTCP PLI."),
+		redActivations: metrics.NewCounter("qvoch_red_activations_total",
+			"Listeners switched to RED because of high downlink loss."),
+		whispers: metrics.NewCounter("qvoch_whispers_total",
+			"Whispers started."),
+	}
+}
+
+// forgetRoom drops per-room series once a main room is deleted.
+func (m *hubMetrics) forgetRoom(roomID string) {
+	m.rtpReceived.Delete(roomID)
+	m.rtpForwarded.Delete(roomID)
+	m.rtpForwardError.Delete(roomID)
+	m.rtpMutedDropped.Delete(roomID)
+}
+
+type hubCounts struct {
+	rooms          int
+	subChannels    int
+	peers          int
+	sessions       int
+	pendingInvites int
+}
+
+func (h *Hub) counts() hubCounts {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	c := hubCounts{
+		sessions:       len(h.SessionMap),
+		pendingInvites: len(h.PendingInvites),
+	}
+	for _, room := range h.Rooms {
+		if room.ParentID != "" {
+			continue
+		}
+		c.rooms++
+		room.mu.RLock()
+		c.subChannels += len(room.SubChannels)
+		c.peers += len(room.AllPeersInMainAndSubs())
+		room.mu.RUnlock()
+	}
+	return c
+}
+
+// RegisterMetrics exposes the hub's gauges, counters and histograms on reg.
+func (h *Hub) RegisterMetrics(reg *metrics.Registry) {
+	reg.MustRegister(
+		metrics.NewGaugeFunc("qvoch_rooms", "Active main rooms.", func() float64 {
+			return float64(h.counts().rooms)
+		}),
+		metrics.NewGaugeFunc("qvoch_subchannels", "Active sub-channels.", func() float64 {
+			return float64(h.counts().subChannels)
+		}),
+		metrics.NewGaugeFunc("qvoch_peers", "Peers in a main room or sub-channel.", func() float64 {
+			return float64(h.counts().peers)
+		}),
+		metrics.NewGaugeFunc("qvoch_sessions", "Session tokens available for reconnect.", func() float64 {
+			return float64(h.counts().sessions)
+		}),
+		metrics.NewGaugeFunc("qvoch_pending_invites", "Sub-channel invites awaiting a response.", func() float64 {
+			return float64(h.counts().pendingInvites)
+		}),
+		h.metrics.rtpReceived,
+		h.metrics.rtpForwarded,
+		h.metrics.rtpForwardError,
+		h.metrics.rtpMutedDropped,
+		h.metrics.iceRestarts,
+		h.metrics.answerTimeouts,
+		h.metrics.joinToConnected,
+		h.metrics.selectedPairs,
+		h.metrics.nackRequests,
+		h.metrics.peerMoves,
+		h.metrics.keyframeRequests,
+		h.metrics.redActivations,
+		h.metrics.whispers,
+	)
+}
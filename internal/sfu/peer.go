@@ -2,11 +2,12 @@ package sfu
 
 import (
 	"encoding/json"
-	"log"
+	"errors"
 	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/pion/interceptor/pkg/stats"
 	"github.com/pion/webrtc/v3"
 )
 
@@ -17,15 +18,26 @@ type Peer struct {
 	Name             string
 	Conn             *websocket.Conn
 	PC               *webrtc.PeerConnection
-	Track            *webrtc.TrackLocalStaticRTP
+	Track            *ForwardTrack
 	RoomID           string // Current room (main or sub-channel ID)
 	MainRoomID       string // Always the main channel ID
 	Muted            bool
+	ForceMuted       bool // imposed by a moderator; the peer cannot clear it
 	OfferSeq         uint64
 	Epoch            uint64
 	pendingRenego    bool
 	signalingReady   chan struct{}
 	iceRestartQueued bool
+	joinedAt         time.Time // join time on the hub's clock, cleared once connected
+	stats            stats.Getter
+	slots            []*slotTrack            // last-N outbound tracks, see slotTracks
+	video            map[string]*videoSource // published video by source
+	quality          qualitySample           // latest link sample, see sampleQuality
+	redLossy         bool                    // downlink loss is high enough for RED, see applyRED
+	whisperTo        map[string]*slotTrack   // recipients of the current whisper; replaced, never modified
+	whisperTracks    map[string]*slotTrack   // whisper track per recipient, see StartWhisper
+	listeningTo      string                  // sub-channel the peer listens in on, see StartListening
+	announcing       bool                    // the peer's audio reaches every channel, see StartAllCall
 	mu               sync.RWMutex
 	writeMu          sync.Mutex
 	negoMu           sync.Mutex
@@ -39,7 +51,7 @@ func (p *Peer) Unlock()  { p.mu.Unlock() }
 func (p *Peer) SendJSON(msgType string, payload interface{}) {
 	data, err := json.Marshal(payload)
 	if err != nil {
-		log.Printf("peer %s: marshal error: %v", p.ID, err)
+		signalingLog.Error("marshal failed", "peer_id", p.ID, "type", msgType, "err", err)
 		return
 	}
 
@@ -55,7 +67,7 @@ func (p *Peer) SendJSON(msgType string, payload interface{}) {
 		return
 	}
 	if err := p.Conn.WriteJSON(env); err != nil {
-		log.Printf("peer %s: write error: %v", p.ID, err)
+		signalingLog.Warn("websocket write failed", "peer_id", p.ID, "type", msgType, "err", err)
 	}
 }
 
@@ -63,6 +75,27 @@ func (p *Peer) SendError(code, message string) {
 	p.SendJSON("error", ErrorPayload{Code: code, Message: message})
 }
 
+// SendSignalError reports err to the client. Errors that are not a
+// SignalError are logged and sent as a generic ErrInternalError.
+func (p *Peer) SendSignalError(err error) {
+	var sigErr *SignalError
+	if !errors.As(err, &sigErr) {
+		signalingLog.Error("internal error", "peer_id", p.ID, "err", err)
+	}
+	p.SendJSON("error", AsSignalError(err).Payload())
+}
+
+// WriteClose sends a WebSocket close frame. The read loop owning the
+// connection is expected to observe the close and tear the peer down.
+func (p *Peer) WriteClose(code int, reason string, deadline time.Time) error {
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+	if p.Conn == nil {
+		return nil
+	}
+	return p.Conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), deadline)
+}
+
 func (p *Peer) WritePing(deadline time.Time) error {
 	p.writeMu.Lock()
 	defer p.writeMu.Unlock()
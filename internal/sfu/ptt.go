@@ -0,0 +1,219 @@
+package sfu
+
+import (
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Push-to-talk modes of a channel. In both PTT modes the forwarding loop
+// drops a peer's audio unless it currently holds talk; in floor mode only
+// one peer can hold it at a time.
+const (
+	PTTModeOff   = "off"
+	PTTModeOpen  = "open"
+	PTTModeFloor = "floor"
+)
+
+// PTTConfig controls push-to-talk. Mode is applied to new main rooms;
+// owners and operators can change it per channel. Talk is released after
+// MaxHold so a stuck key cannot hold the floor.
+type PTTConfig struct {
+	Mode    string
+	MaxHold time.Duration
+}
+
+func loadPTTConfig() PTTConfig {
+	cfg := PTTConfig{
+		Mode:    PTTModeOff,
+		MaxHold: getEnvDuration("PTT_MAX_HOLD", time.Minute),
+	}
+	if cfg.MaxHold <= 0 {
+		cfg.MaxHold = time.Minute
+	}
+	if mode := strings.TrimSpace(strings.ToLower(os.Getenv("PTT_MODE"))); mode != "" {
+		if validPTTMode(mode) {
+			cfg.Mode = mode
+		} else {
+			hubLog.Warn("PTT_MODE: unknown mode, push-to-talk disabled", "mode", mode)
+		}
+	}
+	return cfg
+}
+
+func validPTTMode(mode string) bool {
+	return mode == PTTModeOff || mode == PTTModeOpen || mode == PTTModeFloor
+}
+
+// pttTalk is a peer's current hold of talk. timer releases it after
+// MaxHold.
+type pttTalk struct {
+	since time.Time
+	timer Timer
+}
+
+// mayTalk reports whether peerID's audio is forwarded under the channel's
+// push-to-talk mode.
+func (r *Room) mayTalk(peerID string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.pttMode == "" || r.pttMode == PTTModeOff {
+		return true
+	}
+	_, ok := r.talkers[peerID]
+	return ok
+}
+
+// pttInfoLocked describes the channel's push-to-talk state for room
+// updates, or returns nil when it is off. r.mu must be held.
+func (r *Room) pttInfoLocked() *PTTInfo {
+	if r.pttMode == "" || r.pttMode == PTTModeOff {
+		return nil
+	}
+	info := &PTTInfo{Mode: r.pttMode, Talkers: make([]string, 0, len(r.talkers))}
+	for id := range r.talkers {
+		info.Talkers = append(info.Talkers, id)
+	}
+	sort.Slice(info.Talkers, func(i, j int) bool {
+		return r.talkers[info.Talkers[i]].since.Before(r.talkers[info.Talkers[j]].since)
+	})
+	return info
+}
+
+// releaseTalkLocked ends peerID's hold of talk and reports whether it held
+// it. r.mu must be held.
+func (r *Room) releaseTalkLocked(peerID string) bool {
+	talk, ok := r.talkers[peerID]
+	if !ok {
+		return false
+	}
+	talk.timer.Stop()
+	delete(r.talkers, peerID)
+	return true
+}
+
+// mainRoomOf returns the main room of a sub-channel, or room itself.
+func (h *Hub) mainRoomOf(room *Room) *Room {
+	if room.ParentID == "" {
+		return room
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if parent := h.Rooms[room.ParentID]; parent != nil {
+		return parent
+	}
+	return room
+}
+
+// StartTalk gives peer talk in its current channel. In floor mode it fails
+// while someone else holds it.
+func (h *Hub) StartTalk(peer *Peer) error {
+	room := h.currentRoom(peer)
+	if room == nil {
+		return NewSignalError(ErrChannelNotFound, "Room not found")
+	}
+
+	room.mu.Lock()
+	switch {
+	case room.pttMode == "" || room.pttMode == PTTModeOff:
+		room.mu.Unlock()
+		return NewSignalError(ErrInvalidMessage, "Push-to-talk is not enabled in this channel")
+	case room.talkers[peer.ID] != nil:
+		room.mu.Unlock()
+		return nil
+	case room.pttMode == PTTModeFloor && len(room.talkers) > 0:
+		room.mu.Unlock()
+		return NewSignalError(ErrFloorTaken, "Someone else is talking")
+	}
+	talk := &pttTalk{since: room.clock.Now()}
+	talk.timer = room.clock.AfterFunc(h.cfg.PTT.MaxHold, func() {
+		h.expireTalk(room, peer.ID, talk)
+	})
+	if room.talkers == nil {
+		room.talkers = make(map[string]*pttTalk)
+	}
+	room.talkers[peer.ID] = talk
+	room.mu.Unlock()
+
+	h.broadcastRoomUpdate(h.mainRoomOf(room))
+	return nil
+}
+
+// StopTalk releases peer's talk in its current channel.
+func (h *Hub) StopTalk(peer *Peer) {
+	room := h.currentRoom(peer)
+	if room == nil {
+		return
+	}
+
+	room.mu.Lock()
+	released := room.releaseTalkLocked(peer.ID)
+	room.mu.Unlock()
+
+	if released {
+		h.broadcastRoomUpdate(h.mainRoomOf(room))
+	}
+}
+
+// expireTalk releases talk once it has been held for MaxHold, unless it was
+// released and taken again since.
+func (h *Hub) expireTalk(room *Room, peerID string, talk *pttTalk) {
+	room.mu.Lock()
+	if room.talkers[peerID] != talk {
+		room.mu.Unlock()
+		return
+	}
+	delete(room.talkers, peerID)
+	room.mu.Unlock()
+
+	hubLog.Info("push-to-talk hold expired", "peer_id", peerID, "room_id", room.ID, "max_hold", h.cfg.PTT.MaxHold)
+	h.broadcastRoomUpdate(h.mainRoomOf(room))
+}
+
+// setPTTMode switches room to mode and clears every hold of talk.
+func (h *Hub) setPTTMode(room *Room, mode string) {
+	room.mu.Lock()
+	for id := range room.talkers {
+		room.releaseTalkLocked(id)
+	}
+	room.pttMode = mode
+	room.mu.Unlock()
+
+	h.broadcastRoomUpdate(h.mainRoomOf(room))
+}
+
+// HandlePTTMode changes the push-to-talk mode of channelID, the peer's main
+// room when empty, on behalf of its owner.
+func (h *Hub) HandlePTTMode(peer *Peer, channelID, mode string) error {
+	if !validPTTMode(mode) {
+		return NewSignalError(ErrInvalidMessage, "Mode must be off, open or floor")
+	}
+	mainRoom, channel, err := h.channelForPeer(peer, channelID)
+	if err != nil {
+		return err
+	}
+	if !canManage(peer, mainRoom, channel) {
+		return NewSignalError(ErrNotOwner, "Only the room or channel owner can change push-to-talk")
+	}
+
+	h.setPTTMode(channel, mode)
+	hubLog.Info("push-to-talk mode changed", "peer_id", peer.ID, "room_id", channel.ID, "mode", mode)
+	return nil
+}
+
+// SetPTTMode changes the push-to-talk mode of a main room or sub-channel.
+func (h *Hub) SetPTTMode(roomID, mode string) (*Room, error) {
+	if !validPTTMode(mode) {
+		return nil, NewSignalError(ErrInvalidMessage, "Mode must be off, open or floor")
+	}
+	room := h.findRoom(roomID)
+	if room == nil {
+		return nil, NewSignalError(ErrChannelNotFound, "Room not found")
+	}
+
+	h.setPTTMode(room, mode)
+	hubLog.Info("admin: push-to-talk mode changed", "room_id", roomID, "mode", mode)
+	return room, nil
+}
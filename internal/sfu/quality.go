@@ -0,0 +1,325 @@
+package sfu
+
+import (
+	"time"
+
+	"github.com/pion/interceptor/pkg/stats"
+	"github.com/pion/rtcp"
+	"github.com/pion/webrtc/v3"
+)
+
+// Quality scores published for each peer.
+const (
+	QualityGood = "good"
+	QualityFair = "fair"
+	QualityPoor = "poor"
+)
+
+// qualityInterval is how often every peer's link is sampled, changed
+// scores are published and RED is re-evaluated.
+const qualityInterval = 2 * time.Second
+
+// PeerQuality summarizes the RTCP-derived link statistics of one peer.
+// Uplink figures describe the peer's own media as received by the server;
+// downlink figures are the worst the peer reported in its receiver reports
+// for the streams the server forwards to it.
+type PeerQuality struct {
+	RTT            time.Duration
+	UplinkJitter   time.Duration
+	UplinkLoss     float64 // fraction of packets lost, 0..1; cumulative unless sampled
+	UplinkBitrate  int     // bits per second, only set in samples
+	DownlinkJitter time.Duration
+	DownlinkLoss   float64 // fraction lost in the latest receiver report, 0..1
+
+	// Cumulative counters of the inbound streams, from which samples
+	// derive loss and bitrate over the last interval.
+	packetsReceived uint64
+	packetsLost     int64
+	bytesReceived   uint64
+}
+
+// qualitySample is the latest periodic sample of a peer's link.
+type qualitySample struct {
+	at      time.Time
+	quality PeerQuality
+	score   string
+}
+
+// ConnectionStats is the detailed view of one peer's connection sent in
+// answer to its "stats" request and shown in the admin API.
+type ConnectionStats struct {
+	Quality          string         `json:"quality"`
+	RTTMs            float64        `json:"rttMs"`
+	UplinkLoss       float64        `json:"uplinkLoss"`
+	UplinkJitterMs   float64        `json:"uplinkJitterMs"`
+	UplinkBitrate    int            `json:"uplinkBitrate"`
+	DownlinkLoss     float64        `json:"downlinkLoss"`
+	DownlinkJitterMs float64        `json:"downlinkJitterMs"`
+	CandidatePair    *CandidatePair `json:"candidatePair,omitempty"`
+}
+
+// onStatsGetter receives the stats interceptor of each new PeerConnection.
+// It runs synchronously inside api.NewPeerConnection, which
+// CreatePeerConnection serializes with pcCreateMu.
+func (h *Hub) onStatsGetter(_ string, getter stats.Getter) {
+	h.pendingStats = getter
+}
+
+// PeerQuality reports the current link statistics of peer. It returns false
+// while the peer has no PeerConnection.
+func (h *Hub) PeerQuality(peer *Peer) (PeerQuality, bool) {
+	peer.RLock()
+	pc := peer.PC
+	getter := peer.stats
+	peer.RUnlock()
+
+	if pc == nil || getter == nil {
+		return PeerQuality{}, false
+	}
+
+	var q PeerQuality
+	for _, receiver := range pc.GetReceivers() {
+		track := receiver.Track()
+		if track == nil {
+			continue
+		}
+		s := getter.Get(uint32(track.SSRC()))
+		if s == nil {
+			continue
+		}
+		in := s.InboundRTPStreamStats
+		if clockRate := track.Codec().ClockRate; clockRate > 0 {
+			if jitter := time.Duration(in.Jitter / float64(clockRate) * float64(time.Second)); jitter > q.UplinkJitter {
+				q.UplinkJitter = jitter
+			}
+		}
+		q.packetsReceived += in.PacketsReceived
+		q.bytesReceived += in.BytesReceived
+		if in.PacketsLost > 0 {
+			q.packetsLost += in.PacketsLost
+		}
+	}
+	if q.packetsLost > 0 {
+		q.UplinkLoss = float64(q.packetsLost) / float64(q.packetsReceived+uint64(q.packetsLost))
+	}
+
+	for _, sender := range pc.GetSenders() {
+		for _, enc := range sender.GetParameters().Encodings {
+			s := getter.Get(uint32(enc.SSRC))
+			if s == nil {
+				continue
+			}
+			remote := s.RemoteInboundRTPStreamStats
+			if remote.RoundTripTime > q.RTT {
+				q.RTT = remote.RoundTripTime
+			}
+			if jitter := time.Duration(remote.Jitter * float64(time.Second)); jitter > q.DownlinkJitter {
+				q.DownlinkJitter = jitter
+			}
+			if remote.FractionLost > q.DownlinkLoss {
+				q.DownlinkLoss = remote.FractionLost
+			}
+		}
+	}
+	return q, true
+}
+
+// qualityScore rates a peer's link: poor when loss, round trip or jitter
+// are bad enough to make voice break up, fair when they are noticeable.
+func qualityScore(q PeerQuality) string {
+	loss := max(q.UplinkLoss, q.DownlinkLoss)
+	jitter := max(q.UplinkJitter, q.DownlinkJitter)
+	switch {
+	case loss >= 0.08 || q.RTT >= 500*time.Millisecond || jitter >= 60*time.Millisecond:
+		return QualityPoor
+	case loss >= 0.02 || q.RTT >= 250*time.Millisecond || jitter >= 30*time.Millisecond:
+		return QualityFair
+	}
+	return QualityGood
+}
+
+// sampleQuality takes a new sample of peer's link, with uplink loss and
+// bitrate over the time since the previous one, and reports whether its
+// score changed. Peers without a PeerConnection have no score.
+func (h *Hub) sampleQuality(peer *Peer, now time.Time) (string, bool) {
+	q, ok := h.PeerQuality(peer)
+
+	peer.Lock()
+	defer peer.Unlock()
+
+	prev := peer.quality
+	if !ok {
+		peer.quality = qualitySample{}
+		return "", prev.score != ""
+	}
+
+	// Counters restart with a new PeerConnection.
+	last := prev.quality
+	if !prev.at.IsZero() && q.packetsReceived >= last.packetsReceived && q.bytesReceived >= last.bytesReceived {
+		received := q.packetsReceived - last.packetsReceived
+		lost := max(q.packetsLost-last.packetsLost, 0)
+		q.UplinkLoss = 0
+		if lost > 0 {
+			q.UplinkLoss = float64(lost) / float64(received+uint64(lost))
+		}
+		if elapsed := now.Sub(prev.at).Seconds(); elapsed > 0 {
+			q.UplinkBitrate = int(float64(q.bytesReceived-last.bytesReceived) * 8 / elapsed)
+		}
+	}
+
+	score := qualityScore(q)
+	peer.quality = qualitySample{at: now, quality: q, score: score}
+	return score, score != prev.score
+}
+
+func (h *Hub) scheduleQualityCheck() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.stopped {
+		return
+	}
+	h.qualityTimer = h.clock.AfterFunc(qualityInterval, func() {
+		h.checkQuality()
+		h.scheduleQualityCheck()
+	})
+}
+
+// checkQuality samples every peer in a channel, sends changed scores to
+// their main rooms as a "quality" event and updates RED.
+func (h *Hub) checkQuality() {
+	now := h.clock.Now()
+
+	h.mu.RLock()
+	rooms := make([]*Room, 0, len(h.Rooms))
+	for _, room := range h.Rooms {
+		rooms = append(rooms, room)
+	}
+	h.mu.RUnlock()
+
+	changed := make(map[string]map[string]string)
+	for _, room := range rooms {
+		room.mu.RLock()
+		peers := make([]*Peer, 0, len(room.Peers))
+		for _, p := range room.Peers {
+			peers = append(peers, p)
+		}
+		room.mu.RUnlock()
+
+		mainRoomID := room.ID
+		if room.ParentID != "" {
+			mainRoomID = room.ParentID
+		}
+		for _, p := range peers {
+			if score, ok := h.sampleQuality(p, now); ok {
+				if changed[mainRoomID] == nil {
+					changed[mainRoomID] = make(map[string]string)
+				}
+				changed[mainRoomID][p.ID] = score
+			}
+			if h.cfg.RED.Enabled {
+				h.applyRED(p, room)
+			}
+		}
+	}
+
+	for mainRoomID, scores := range changed {
+		h.mu.RLock()
+		mainRoom, ok := h.Rooms[mainRoomID]
+		h.mu.RUnlock()
+		if !ok {
+			continue
+		}
+		mainRoom.mu.RLock()
+		allPeers := mainRoom.AllPeersInMainAndSubs()
+		mainRoom.mu.RUnlock()
+
+		payload := QualityPayload{Peers: scores}
+		for _, p := range allPeers {
+			p.SendJSON("quality", payload)
+		}
+	}
+}
+
+// ConnectionStats returns the latest sample of peer's connection together
+// with its selected ICE candidate pair. Before the first sample it reports
+// the current statistics. It returns false while the peer has no
+// PeerConnection.
+func (h *Hub) ConnectionStats(peer *Peer) (ConnectionStats, bool) {
+	peer.RLock()
+	sample := peer.quality
+	pc := peer.PC
+	peer.RUnlock()
+
+	if pc == nil {
+		return ConnectionStats{}, false
+	}
+	if sample.at.IsZero() {
+		q, ok := h.PeerQuality(peer)
+		if !ok {
+			return ConnectionStats{}, false
+		}
+		sample = qualitySample{quality: q, score: qualityScore(q)}
+	}
+	return newConnectionStats(sample, pc), true
+}
+
+func newConnectionStats(sample qualitySample, pc *webrtc.PeerConnection) ConnectionStats {
+	q := sample.quality
+	cs := ConnectionStats{
+		Quality:          sample.score,
+		RTTMs:            milliseconds(q.RTT),
+		UplinkLoss:       q.UplinkLoss,
+		UplinkJitterMs:   milliseconds(q.UplinkJitter),
+		UplinkBitrate:    q.UplinkBitrate,
+		DownlinkLoss:     q.DownlinkLoss,
+		DownlinkJitterMs: milliseconds(q.DownlinkJitter),
+	}
+	if pair, ok := selectedCandidatePair(pc); ok {
+		cs.CandidatePair = &pair
+	}
+	return cs
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// readSenderRTCP reads RTCP for an outbound track so the interceptor chain
+// sees receiver feedback: NACKs are answered from the retransmission buffer
+// and receiver reports feed the stats interceptor. PLI and FIR for a video
+// track are relayed to its publisher.
+func (h *Hub) readSenderRTCP(sender *webrtc.RTPSender) {
+	go func() {
+		for {
+			pkts, _, err := sender.ReadRTCP()
+			if err != nil {
+				return
+			}
+			for _, pkt := range pkts {
+				switch pkt := pkt.(type) {
+				case *rtcp.TransportLayerNack:
+					for _, pair := range pkt.Nacks {
+						h.metrics.nackRequests.Add(uint64(len(pair.PacketList())))
+					}
+				case *rtcp.PictureLossIndication, *rtcp.FullIntraRequest:
+					if track, ok := sender.Track().(*ForwardTrack); ok {
+						track.requestKeyframe()
+					}
+				}
+			}
+		}
+	}()
+}
+
+// readReceiverRTCP reads the publisher's sender reports so receiver reports
+// can carry round-trip timing back to it.
+func readReceiverRTCP(receiver *webrtc.RTPReceiver) {
+	go func() {
+		for {
+			if _, _, err := receiver.ReadRTCP(); err != nil {
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,575 @@
+package sfu
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3/pkg/media/oggwriter"
+)
+
+// RecordingConfig enables channel recording. Each recording is written to
+// its own directory under Dir; an empty Dir disables the feature.
+type RecordingConfig struct {
+	Dir string
+}
+
+func loadRecordingConfig() RecordingConfig {
+	return RecordingConfig{
+		Dir: strings.TrimSpace(os.Getenv("RECORDING_DIR")),
+	}
+}
+
+const recordingManifestFile = "manifest.json"
+
+// recordingDownloadTTL is how long a download link sent to an owner stays
+// valid. Each link can be used once.
+const recordingDownloadTTL = 15 * time.Minute
+
+// recordingDownload is an issued download link. It is bound to the session
+// of the owner it was sent to, so a revoked session cannot use it.
+type recordingDownload struct {
+	recordingID  string
+	sessionToken string
+	expiresAt    time.Time
+}
+
+// RecordingManifest describes a recording on disk. Every participant gets
+// one Ogg/Opus file per stay in the channel; OffsetMs places the file's first
+// sample on the recording's timeline so tracks can be mixed back in sync.
+type RecordingManifest struct {
+	ID          string           `json:"id"`
+	RoomID      string           `json:"roomId"`
+	ChannelID   string           `json:"channelId"`
+	ChannelName string           `json:"channelName"`
+	StartedBy   string           `json:"startedBy"`
+	StartedAt   time.Time        `json:"startedAt"`
+	StoppedAt   *time.Time       `json:"stoppedAt,omitempty"`
+	Tracks      []RecordingTrack `json:"tracks"`
+}
+
+type RecordingTrack struct {
+	File     string `json:"file"`
+	UserID   string `json:"userId"`
+	UserName string `json:"userName"`
+	OffsetMs int64  `json:"offsetMs"`
+}
+
+// Recording captures the audio of one channel. Participants are only
+// captured after they consented; leaving the channel closes their file and
+// withdraws their consent, so they are asked again when they come back.
+type Recording struct {
+	dir string
+
+	mu        sync.Mutex
+	manifest  RecordingManifest
+	consented map[string]bool
+	writers   map[string]*oggwriter.OggWriter
+	finished  bool
+}
+
+func newRecording(baseDir string, mainRoom, channel *Room, startedBy string, startedAt time.Time) (*Recording, error) {
+	id := uuid.New().String()
+	dir := filepath.Join(baseDir, id)
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("create recording dir: %w", err)
+	}
+	rec := &Recording{
+		dir: dir,
+		manifest: RecordingManifest{
+			ID:          id,
+			RoomID:      mainRoom.ID,
+			ChannelID:   channel.ID,
+			ChannelName: channel.Name,
+			StartedBy:   startedBy,
+			StartedAt:   startedAt,
+			Tracks:      make([]RecordingTrack, 0),
+		},
+		consented: make(map[string]bool),
+		writers:   make(map[string]*oggwriter.OggWriter),
+	}
+	if err := rec.writeManifestLocked(); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	return rec, nil
+}
+
+func (r *Recording) ID() string {
+	return r.manifest.ID
+}
+
+func (r *Recording) info() *RecordingInfo {
+	return &RecordingInfo{
+		ID:        r.manifest.ID,
+		StartedBy: r.manifest.StartedBy,
+		StartedAt: r.manifest.StartedAt.UnixMilli(),
+	}
+}
+
+func (r *Recording) consent(peerID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.finished {
+		r.consented[peerID] = true
+	}
+}
+
+// writeRTP appends pkt to peer's file, opening it on the first packet after
+// consent.
+func (r *Recording) writeRTP(peer *Peer, pkt *rtp.Packet, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.finished || !r.consented[peer.ID] {
+		return nil
+	}
+	w, ok := r.writers[peer.ID]
+	if !ok {
+		peer.RLock()
+		name := peer.Name
+		peer.RUnlock()
+
+		file := fmt.Sprintf("%02d-%s.ogg", len(r.manifest.Tracks)+1, sanitizeFileName(name))
+		var err error
+		w, err = oggwriter.New(filepath.Join(r.dir, file), opusClockRate, 2)
+		if err != nil {
+			r.consented[peer.ID] = false
+			return fmt.Errorf("create recording track: %w", err)
+		}
+		r.writers[peer.ID] = w
+		r.manifest.Tracks = append(r.manifest.Tracks, RecordingTrack{
+			File:     file,
+			UserID:   peer.ID,
+			UserName: name,
+			OffsetMs: now.Sub(r.manifest.StartedAt).Milliseconds(),
+		})
+	}
+	return w.WriteRTP(pkt)
+}
+
+// leave closes peerID's file and withdraws its consent.
+func (r *Recording) leave(peerID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.consented, peerID)
+	if w, ok := r.writers[peerID]; ok {
+		if err := w.Close(); err != nil {
+			mediaLog.Warn("close recording track failed", "recording_id", r.manifest.ID, "peer_id", peerID, "err", err)
+		}
+		delete(r.writers, peerID)
+	}
+}
+
+// finish closes all files and writes the final manifest. It is idempotent.
+func (r *Recording) finish(stoppedAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.finished {
+		return nil
+	}
+	r.finished = true
+	var errs []error
+	for peerID, w := range r.writers {
+		if err := w.Close(); err != nil {
+			errs = append(errs, err)
+		}
+		delete(r.writers, peerID)
+	}
+	r.manifest.StoppedAt = &stoppedAt
+	errs = append(errs, r.writeManifestLocked())
+	return errors.Join(errs...)
+}
+
+func (r *Recording) writeManifestLocked() error {
+	data, err := json.MarshalIndent(r.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(r.dir, recordingManifestFile), data, 0o640)
+}
+
+// Manifest returns a copy of the recording's manifest.
+func (r *Recording) Manifest() RecordingManifest {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	m := r.manifest
+	m.Tracks = append([]RecordingTrack(nil), r.manifest.Tracks...)
+	return m
+}
+
+// Dir returns the directory holding the recording's files.
+func (r *Recording) Dir() string {
+	return r.dir
+}
+
+func (r *Recording) Finished() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.finished
+}
+
+func sanitizeFileName(name string) string {
+	var b strings.Builder
+	for _, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_':
+			b.WriteRune(c)
+		default:
+			b.WriteRune('_')
+		}
+	}
+	if b.Len() == 0 {
+		return "user"
+	}
+	return b.String()
+}
+
+// activeRecording returns the recording running in the channel, or nil.
+func (r *Room) activeRecording() *Recording {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.recording
+}
+
+// channelForPeer resolves channelID to the main room or one of its
+// sub-channels in peer's main room.
+func (h *Hub) channelForPeer(peer *Peer, channelID string) (mainRoom, channel *Room, err error) {
+	peer.RLock()
+	mainRoomID := peer.MainRoomID
+	peer.RUnlock()
+
+	h.mu.RLock()
+	mainRoom, ok := h.Rooms[mainRoomID]
+	h.mu.RUnlock()
+	if !ok {
+		return nil, nil, NewSignalError(ErrChannelNotFound, "Room not found")
+	}
+	if channelID == "" || channelID == mainRoomID {
+		return mainRoom, mainRoom, nil
+	}
+
+	mainRoom.mu.RLock()
+	sub, ok := mainRoom.SubChannels[channelID]
+	mainRoom.mu.RUnlock()
+	if !ok {
+		return nil, nil, NewSignalError(ErrChannelNotFound, "Sub-channel not found")
+	}
+	return mainRoom, sub, nil
+}
+
+// canManage reports whether peer may record channel, change its
+// push-to-talk mode or force-mute its members: the room owner can manage any
+// of its channels, a sub-channel's creator only that sub-channel.
+func canManage(peer *Peer, mainRoom, channel *Room) bool {
+	mainRoom.mu.RLock()
+	roomOwner := mainRoom.OwnerID
+	mainRoom.mu.RUnlock()
+	if roomOwner == peer.ID {
+		return true
+	}
+	channel.mu.RLock()
+	defer channel.mu.RUnlock()
+	return channel.OwnerID == peer.ID
+}
+
+// StartRecording starts recording channelID on behalf of an owner, who is
+// captured right away; everyone else once they consent.
+func (h *Hub) StartRecording(peer *Peer, channelID string) error {
+	if h.cfg.Recording.Dir == "" {
+		return NewSignalError(ErrRecordingOff, "Recording is not enabled on this server")
+	}
+	mainRoom, channel, err := h.channelForPeer(peer, channelID)
+	if err != nil {
+		return err
+	}
+	if !canManage(peer, mainRoom, channel) {
+		return NewSignalError(ErrNotOwner, "Only the room or channel owner can record")
+	}
+
+	channel.mu.Lock()
+	if channel.recording != nil {
+		channel.mu.Unlock()
+		return nil
+	}
+	rec, err := newRecording(h.cfg.Recording.Dir, mainRoom, channel, peer.ID, h.clock.Now())
+	if err != nil {
+		channel.mu.Unlock()
+		mediaLog.Error("start recording failed", "room_id", channel.ID, "err", err)
+		return err
+	}
+	rec.consent(peer.ID)
+	channel.recording = rec
+	channel.mu.Unlock()
+
+	h.mu.Lock()
+	h.recordings[rec.ID()] = rec
+	h.mu.Unlock()
+
+	mediaLog.Info("recording started", "recording_id", rec.ID(), "room_id", channel.ID, "main_room_id", mainRoom.ID)
+	h.broadcastRoomUpdate(mainRoom)
+	return nil
+}
+
+// StopRecording stops the recording of channelID on behalf of an owner.
+func (h *Hub) StopRecording(peer *Peer, channelID string) error {
+	mainRoom, channel, err := h.channelForPeer(peer, channelID)
+	if err != nil {
+		return err
+	}
+	if !canManage(peer, mainRoom, channel) {
+		return NewSignalError(ErrNotOwner, "Only the room or channel owner can stop the recording")
+	}
+
+	channel.mu.Lock()
+	rec := channel.recording
+	channel.recording = nil
+	channel.mu.Unlock()
+
+	if rec == nil {
+		return nil
+	}
+	h.finishRecording(rec)
+	h.sendRecordingStopped(rec, mainRoom)
+	h.broadcastRoomUpdate(mainRoom)
+	return nil
+}
+
+// ConsentRecording lets peer's audio be captured by recordingID, which must
+// be running in the peer's current channel.
+func (h *Hub) ConsentRecording(peer *Peer, recordingID string) error {
+	room := h.currentRoom(peer)
+	if room == nil {
+		return NewSignalError(ErrChannelNotFound, "Room not found")
+	}
+	rec := room.activeRecording()
+	if rec == nil || rec.ID() != recordingID {
+		return NewSignalError(ErrInvalidMessage, "Recording is not running in this channel")
+	}
+	rec.consent(peer.ID)
+	mediaLog.Info("recording consent", "recording_id", recordingID, "peer_id", peer.ID)
+	return nil
+}
+
+func (h *Hub) finishRecording(rec *Recording) {
+	if err := rec.finish(h.clock.Now()); err != nil {
+		mediaLog.Warn("finish recording failed", "recording_id", rec.ID(), "err", err)
+	}
+	mediaLog.Info("recording stopped", "recording_id", rec.ID())
+}
+
+// finishIdleRecordings stops recordings whose channel has been deleted or
+// has nobody left in it. It runs from GC.
+func (h *Hub) finishIdleRecordings() {
+	h.mu.RLock()
+	mainRooms := make(map[string]*Room)
+	for id, room := range h.Rooms {
+		if room.ParentID == "" {
+			mainRooms[id] = room
+		}
+	}
+	recs := make([]*Recording, 0, len(h.recordings))
+	for _, rec := range h.recordings {
+		recs = append(recs, rec)
+	}
+	h.mu.RUnlock()
+
+	for _, rec := range recs {
+		if rec.Finished() {
+			continue
+		}
+		m := rec.Manifest()
+		mainRoom, ok := mainRooms[m.RoomID]
+		if !ok {
+			h.finishRecording(rec)
+			continue
+		}
+
+		channel := mainRoom
+		if m.ChannelID != m.RoomID {
+			mainRoom.mu.RLock()
+			channel = mainRoom.SubChannels[m.ChannelID]
+			mainRoom.mu.RUnlock()
+		}
+		if channel != nil {
+			channel.mu.Lock()
+			if len(channel.Peers) > 0 {
+				channel.mu.Unlock()
+				continue
+			}
+			if channel.recording == rec {
+				channel.recording = nil
+			}
+			channel.mu.Unlock()
+		}
+		h.finishRecording(rec)
+		h.sendRecordingStopped(rec, mainRoom)
+		h.broadcastRoomUpdate(mainRoom)
+	}
+}
+
+// sendRecordingStopped sends the owners of a finished recording, the user
+// who started it and the room owner, a "recording-stopped" event with a
+// download link of their own. An owner whose link could not be created gets
+// an error instead.
+func (h *Hub) sendRecordingStopped(rec *Recording, mainRoom *Room) {
+	m := rec.Manifest()
+	mainRoom.mu.RLock()
+	owner := mainRoom.OwnerID
+	all := mainRoom.AllPeersInMainAndSubs()
+	mainRoom.mu.RUnlock()
+
+	for _, p := range all {
+		if p.ID != m.StartedBy && p.ID != owner {
+			continue
+		}
+		p.RLock()
+		sessionToken := p.SessionToken
+		p.RUnlock()
+		token, err := h.issueRecordingDownload(rec.ID(), sessionToken)
+		if err != nil {
+			mediaLog.Error("issue recording download failed", "recording_id", rec.ID(), "peer_id", p.ID, "err", err)
+			p.SendSignalError(NewSignalError(ErrInternalError, "Could not create a download link for the recording"))
+			continue
+		}
+		p.SendJSON("recording-stopped", RecordingStoppedPayload{
+			RecordingID: rec.ID(),
+			ChannelID:   m.ChannelID,
+			ChannelName: m.ChannelName,
+			DownloadURL: "/recordings/" + rec.ID() + "?token=" + token,
+		})
+	}
+}
+
+// issueRecordingDownload creates a one-time download token for recordingID
+// bound to sessionToken.
+func (h *Hub) issueRecordingDownload(recordingID, sessionToken string) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generate download token: %w", err)
+	}
+	token := hex.EncodeToString(buf)
+
+	h.mu.Lock()
+	h.recordingDownloads[token] = recordingDownload{
+		recordingID:  recordingID,
+		sessionToken: sessionToken,
+		expiresAt:    h.clock.Now().Add(recordingDownloadTTL),
+	}
+	h.mu.Unlock()
+	return token, nil
+}
+
+// RedeemRecordingDownload returns the finished recording id for a download
+// link sent to an owner. The token is used up even when the check fails.
+func (h *Hub) RedeemRecordingDownload(id, token string) (*Recording, error) {
+	h.mu.Lock()
+	dl, ok := h.recordingDownloads[token]
+	delete(h.recordingDownloads, token)
+	if ok {
+		_, ok = h.SessionMap[dl.sessionToken]
+	}
+	h.mu.Unlock()
+
+	if !ok || dl.recordingID != id || !h.clock.Now().Before(dl.expiresAt) {
+		return nil, NewSignalError(ErrRecordingMissing, "Download link is invalid or has expired")
+	}
+	return h.FinishedRecording(id)
+}
+
+// pruneRecordingDownloadsLocked forgets expired download links. h.mu must be
+// held.
+func (h *Hub) pruneRecordingDownloadsLocked(now time.Time) {
+	for token, dl := range h.recordingDownloads {
+		if !now.Before(dl.expiresAt) {
+			delete(h.recordingDownloads, token)
+		}
+	}
+}
+
+// deleteRecordings finishes and removes every recording of a main room and
+// its sub-channels once the room is gone.
+func (h *Hub) deleteRecordings(roomID string) {
+	h.mu.Lock()
+	recs := make([]*Recording, 0)
+	for id, rec := range h.recordings {
+		if rec.Manifest().RoomID == roomID {
+			recs = append(recs, rec)
+			delete(h.recordings, id)
+		}
+	}
+	h.mu.Unlock()
+
+	for _, rec := range recs {
+		rec.finish(h.clock.Now())
+		if err := os.RemoveAll(rec.Dir()); err != nil {
+			mediaLog.Warn("delete recording failed", "recording_id", rec.ID(), "err", err)
+			continue
+		}
+		mediaLog.Info("recording deleted", "recording_id", rec.ID(), "room_id", roomID)
+	}
+}
+
+// finishAllRecordings closes every running recording. It runs on shutdown so
+// the Ogg files and manifests on disk are complete.
+func (h *Hub) finishAllRecordings() {
+	h.mu.RLock()
+	recs := make([]*Recording, 0, len(h.recordings))
+	for _, rec := range h.recordings {
+		recs = append(recs, rec)
+	}
+	h.mu.RUnlock()
+
+	for _, rec := range recs {
+		if !rec.Finished() {
+			h.finishRecording(rec)
+		}
+	}
+}
+
+// Recordings returns the manifests of all recordings kept by the hub, oldest
+// first.
+func (h *Hub) Recordings() []RecordingManifest {
+	h.mu.RLock()
+	recs := make([]*Recording, 0, len(h.recordings))
+	for _, rec := range h.recordings {
+		recs = append(recs, rec)
+	}
+	h.mu.RUnlock()
+
+	manifests := make([]RecordingManifest, 0, len(recs))
+	for _, rec := range recs {
+		manifests = append(manifests, rec.Manifest())
+	}
+	sort.Slice(manifests, func(i, j int) bool {
+		return manifests[i].StartedAt.Before(manifests[j].StartedAt)
+	})
+	return manifests
+}
+
+// FinishedRecording returns a recording that can be downloaded.
+func (h *Hub) FinishedRecording(id string) (*Recording, error) {
+	h.mu.RLock()
+	rec, ok := h.recordings[id]
+	h.mu.RUnlock()
+	if !ok {
+		return nil, NewSignalError(ErrRecordingMissing, "Recording not found")
+	}
+	if !rec.Finished() {
+		return nil, NewSignalError(ErrInvalidMessage, "Recording is still running")
+	}
+	return rec, nil
+}
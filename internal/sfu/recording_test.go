@@ -0,0 +1,70 @@
+package sfu
+
+import (
+	"testing"
+	"time"
+)
+
+// newFinishedRecording adds a finished recording of a new room to h, owned
+// by a peer with a valid session.
+func newFinishedRecording(t *testing.T, h *Hub) (*Recording, *Peer) {
+	t.Helper()
+	main, peers := newTestRoom(t, h, "alice")
+	rec, err := newRecording(t.TempDir(), main, main, peers[0].ID, h.clock.Now())
+	if err != nil {
+		t.Fatalf("new recording: %v", err)
+	}
+	if err := rec.finish(h.clock.Now()); err != nil {
+		t.Fatalf("finish recording: %v", err)
+	}
+	h.mu.Lock()
+	h.recordings[rec.ID()] = rec
+	h.mu.Unlock()
+	return rec, peers[0]
+}
+
+func TestRecordingDownloadIsOneTime(t *testing.T) {
+	h, _ := newTestHub(t)
+	rec, owner := newFinishedRecording(t, h)
+
+	token, err := h.issueRecordingDownload(rec.ID(), owner.SessionToken)
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	if _, err := h.RedeemRecordingDownload("other-id", token); err == nil {
+		t.Fatal("token redeemed for another recording")
+	}
+
+	token, _ = h.issueRecordingDownload(rec.ID(), owner.SessionToken)
+	got, err := h.RedeemRecordingDownload(rec.ID(), token)
+	if err != nil || got != rec {
+		t.Fatalf("redeem: %v, %v", got, err)
+	}
+	if _, err := h.RedeemRecordingDownload(rec.ID(), token); err == nil {
+		t.Fatal("token redeemed twice")
+	}
+}
+
+func TestRecordingDownloadExpiresWithLinkAndSession(t *testing.T) {
+	h, clock := newTestHub(t)
+	rec, owner := newFinishedRecording(t, h)
+
+	token, _ := h.issueRecordingDownload(rec.ID(), owner.SessionToken)
+	clock.Advance(recordingDownloadTTL)
+	if _, err := h.RedeemRecordingDownload(rec.ID(), token); err == nil {
+		t.Fatal("expired token redeemed")
+	}
+	h.mu.RLock()
+	pending := len(h.recordingDownloads)
+	h.mu.RUnlock()
+	if pending != 0 {
+		t.Fatalf("%d download links kept", pending)
+	}
+
+	token, _ = h.issueRecordingDownload(rec.ID(), owner.SessionToken)
+	h.RemovePeer(owner, false)
+	clock.Advance(time.Second)
+	if _, err := h.RedeemRecordingDownload(rec.ID(), token); err == nil {
+		t.Fatal("token redeemed after the owner's session ended")
+	}
+}
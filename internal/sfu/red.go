@@ -0,0 +1,227 @@
+package sfu
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// RED (RFC 2198) lets each audio packet carry copies of the frames before
+// it, so a listener on a lossy link can fill gaps without a NACK round trip.
+// The SFU unwraps RED from publishers and builds it again per listener from
+// the frames it forwarded last; listeners that did not negotiate RED, or do
+// not need it, get plain Opus.
+
+const mimeTypeRED = "audio/red"
+
+// Payload types offered for Opus and RED. Browsers answer with the offerer's
+// payload types, so publishers send RED as redPayloadType.
+const (
+	opusPayloadType = 111
+	redPayloadType  = 63
+)
+
+// redDistance is the number of earlier frames carried in each RED packet.
+const redDistance = 2
+
+// Limits of the 14-bit timestamp offset and 10-bit length in a RED block
+// header.
+const (
+	redMaxOffset   = 1<<14 - 1
+	redMaxBlockLen = 1<<10 - 1
+)
+
+var errShortRED = errors.New("truncated RED payload")
+
+// REDConfig controls Opus redundancy. Enabled negotiates audio/red with
+// clients at all. Always sends RED to every capable listener in new rooms;
+// operators can change it per room through the admin API. AutoLoss is the
+// downlink loss fraction at which a listener gets RED in any room; 0 turns
+// the automatic switch off.
+type REDConfig struct {
+	Enabled  bool
+	Always   bool
+	AutoLoss float64
+}
+
+func loadREDConfig() REDConfig {
+	return REDConfig{
+		Enabled:  getEnvBool("RED_ENABLED", true),
+		Always:   getEnvBool("RED_ALWAYS", false),
+		AutoLoss: float64(getEnvIntBounded("RED_AUTO_LOSS_PERCENT", 5, 0, 100)) / 100,
+	}
+}
+
+// redCodec is registered after Opus so publishers keep sending plain Opus
+// by default while receivers can still be sent RED.
+var redCodec = webrtc.RTPCodecParameters{
+	RTPCodecCapability: webrtc.RTPCodecCapability{
+		MimeType:    mimeTypeRED,
+		ClockRate:   opusClockRate,
+		Channels:    2,
+		SDPFmtpLine: fmt.Sprintf("%d/%d", opusPayloadType, opusPayloadType),
+	},
+	PayloadType: redPayloadType,
+}
+
+// redBlock is one Opus frame carried in a RED payload.
+type redBlock struct {
+	timestamp uint32
+	payload   []byte
+}
+
+// redPrimary returns the primary block of a RED payload, which is the
+// frame the packet's own timestamp refers to.
+func redPrimary(payload []byte) ([]byte, error) {
+	i := 0
+	skip := 0
+	for {
+		if i >= len(payload) {
+			return nil, errShortRED
+		}
+		if payload[i]&0x80 == 0 {
+			i++
+			break
+		}
+		if i+4 > len(payload) {
+			return nil, errShortRED
+		}
+		skip += int(payload[i+2]&0x03)<<8 | int(payload[i+3])
+		i += 4
+	}
+	if i+skip > len(payload) {
+		return nil, errShortRED
+	}
+	return payload[i+skip:], nil
+}
+
+// encodeRED builds a RED payload from the redundant blocks, oldest first,
+// and the primary frame at timestamp ts, all with Opus payload type pt.
+// Blocks that do not fit a RED header are left out.
+func encodeRED(pt uint8, redundant []redBlock, ts uint32, primary []byte) []byte {
+	size := 1 + len(primary)
+	used := make([]redBlock, 0, len(redundant))
+	for _, b := range redundant {
+		offset := ts - b.timestamp
+		if offset == 0 || offset > redMaxOffset || len(b.payload) > redMaxBlockLen {
+			continue
+		}
+		used = append(used, b)
+		size += 4 + len(b.payload)
+	}
+
+	buf := make([]byte, 0, size)
+	for _, b := range used {
+		offset := ts - b.timestamp
+		length := len(b.payload)
+		buf = append(buf, 0x80|pt&0x7f, byte(offset>>6), byte(offset<<2)|byte(length>>8), byte(length))
+	}
+	buf = append(buf, pt&0x7f)
+	for _, b := range used {
+		buf = append(buf, b.payload...)
+	}
+	return append(buf, primary...)
+}
+
+// redPayloadTypeFor returns the payload type of the RED codec among codecs
+// whose primary encoding is opusPT, or 0 if none was negotiated.
+func redPayloadTypeFor(codecs []webrtc.RTPCodecParameters, opusPT webrtc.PayloadType) webrtc.PayloadType {
+	for _, codec := range codecs {
+		if !strings.EqualFold(codec.MimeType, mimeTypeRED) {
+			continue
+		}
+		primary, _, _ := strings.Cut(codec.SDPFmtpLine, "/")
+		if primary == strconv.Itoa(int(opusPT)) {
+			return codec.PayloadType
+		}
+	}
+	return 0
+}
+
+// redTrack is implemented by the outbound audio tracks, including last-N
+// slot tracks.
+type redTrack interface {
+	setRED(ssrc webrtc.SSRC, enabled bool)
+}
+
+// redEnabled reports whether every capable listener in the room is sent RED.
+func (r *Room) redEnabled() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.red
+}
+
+// applyRED updates whether peer is sent RED: always in a room with RED on,
+// otherwise while the downlink loss of its latest quality sample is high.
+// Loss has to fall to half the threshold before RED is switched off again.
+// checkQuality calls it every qualityInterval, which also covers senders
+// added since.
+func (h *Hub) applyRED(peer *Peer, room *Room) {
+	peer.Lock()
+	sample := peer.quality
+	q := sample.quality
+	lossy := peer.redLossy
+	if !sample.at.IsZero() && h.cfg.RED.AutoLoss > 0 {
+		switch {
+		case q.DownlinkLoss >= h.cfg.RED.AutoLoss:
+			lossy = true
+		case q.DownlinkLoss < h.cfg.RED.AutoLoss/2:
+			lossy = false
+		}
+	}
+	changed := lossy != peer.redLossy
+	peer.redLossy = lossy
+	pc := peer.PC
+	peer.Unlock()
+
+	if changed {
+		mediaLog.Info("RED for lossy listener changed", "peer_id", peer.ID, "room_id", room.ID, "enabled", lossy, "downlink_loss", q.DownlinkLoss)
+		if lossy {
+			h.metrics.redActivations.Inc()
+		}
+	}
+	if pc == nil {
+		return
+	}
+
+	enabled := lossy || room.redEnabled()
+	for _, sender := range pc.GetSenders() {
+		track, ok := sender.Track().(redTrack)
+		if !ok {
+			continue
+		}
+		for _, enc := range sender.GetParameters().Encodings {
+			track.setRED(enc.SSRC, enabled)
+		}
+	}
+}
+
+// SetRED turns RED on or off for every capable listener of a main room or
+// sub-channel. Listeners with high loss keep getting RED either way.
+func (h *Hub) SetRED(roomID string, enabled bool) (*Room, error) {
+	if !h.cfg.RED.Enabled {
+		return nil, NewSignalError(ErrInvalidMessage, "RED is not enabled on this server")
+	}
+	room := h.findRoom(roomID)
+	if room == nil {
+		return nil, NewSignalError(ErrChannelNotFound, "Room not found")
+	}
+
+	room.mu.Lock()
+	room.red = enabled
+	peers := make([]*Peer, 0, len(room.Peers))
+	for _, p := range room.Peers {
+		peers = append(peers, p)
+	}
+	room.mu.Unlock()
+
+	for _, p := range peers {
+		h.applyRED(p, room)
+	}
+
+	hubLog.Info("admin: RED forwarding changed", "room_id", roomID, "enabled", enabled)
+	return room, nil
+}
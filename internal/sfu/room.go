@@ -14,32 +14,68 @@ type ChatMessage struct {
 }
 
 type Room struct {
-	ID           string
-	Name         string
-	FullName     string
-	InviteToken  string
-	ParentID     string
-	PasswordHash string
-	CreatedAt    time.Time
-	Peers        map[string]*Peer
-	SubChannels  map[string]*Room
+	ID                 string
+	Name               string
+	FullName           string
+	InviteToken        string
+	ParentID           string
+	OwnerID            string // creator of the room or sub-channel
+	AudioProfile       string // AudioProfileVoice or AudioProfileMusic, fixed at creation
+	PasswordHash       string
+	CreatedAt          time.Time
+	Peers              map[string]*Peer
+	SubChannels        map[string]*Room
 	ChatHistory        []ChatMessage
 	Expiry             time.Time
 	CountdownExpiresAt int64
+	clock              Clock
 	mu                 sync.RWMutex
+
+	// Active speakers and the throttle state of the "speaking" event.
+	speakers       map[string]bool
+	speakingTimer  Timer
+	speakingSentAt time.Time
+
+	// lastN is set when only the loudest speakers are forwarded.
+	lastN *lastNSelector
+
+	// red sends RED to every listener that negotiated it, see applyRED.
+	red bool
+
+	// pttMode is the channel's push-to-talk mode and talkers the peers
+	// currently holding talk, see mayTalk.
+	pttMode string
+	talkers map[string]*pttTalk
+
+	// recording is the channel's running recording, if any.
+	recording *Recording
+
+	// listeners are the peers listening in on this sub-channel and
+	// listenRequests the listen-ins waiting for the members' consent.
+	listeners      map[string]*Peer
+	listenRequests map[string]*listenRequest
+
+	// allCall is the peer whose audio currently reaches every channel of
+	// this main room, see StartAllCall.
+	allCall *Peer
 }
 
-func NewRoom(id, name, fullName, inviteToken, passwordHash string) *Room {
+func NewRoom(id, name, fullName, inviteToken, passwordHash string, clock Clock) *Room {
+	if clock == nil {
+		clock = RealClock()
+	}
 	return &Room{
 		ID:           id,
 		Name:         name,
 		FullName:     fullName,
 		InviteToken:  inviteToken,
 		PasswordHash: passwordHash,
-		CreatedAt:    time.Now(),
+		CreatedAt:    clock.Now(),
 		Peers:        make(map[string]*Peer),
 		SubChannels:  make(map[string]*Room),
 		ChatHistory:  make([]ChatMessage, 0),
+		clock:        clock,
+		speakers:     make(map[string]bool),
 	}
 }
 
@@ -51,7 +87,7 @@ func (r *Room) AddPeer(p *Peer) {
 func (r *Room) RemovePeer(peerID string) {
 	delete(r.Peers, peerID)
 	if len(r.Peers) == 0 {
-		r.Expiry = time.Now()
+		r.Expiry = r.clock.Now()
 	}
 }
 
@@ -67,9 +103,12 @@ func (r *Room) GetUserInfos() []UserInfo {
 	for _, p := range r.Peers {
 		p.mu.RLock()
 		u := UserInfo{
-			ID:    p.ID,
-			Name:  p.Name,
-			Muted: p.Muted,
+			ID:         p.ID,
+			Name:       p.Name,
+			Muted:      p.Muted,
+			ForceMuted: p.ForceMuted,
+			Publishing: p.publishingLocked(),
+			Quality:    p.quality.score,
 		}
 		p.mu.RUnlock()
 		users = append(users, u)
@@ -84,6 +123,9 @@ func (r *Room) GetUserInfos() []UserInfo {
 				ID:           p.ID,
 				Name:         p.Name,
 				Muted:        p.Muted,
+				ForceMuted:   p.ForceMuted,
+				Publishing:   p.publishingLocked(),
+				Quality:      p.quality.score,
 				InSubChannel: &subIDCopy,
 			}
 			p.mu.RUnlock()
@@ -102,15 +144,24 @@ func (r *Room) GetSubChannelInfos() []SubChannelInfo {
 		sci := SubChannelInfo{
 			ID:        sub.ID,
 			Name:      sub.Name,
+			OwnerID:   sub.OwnerID,
 			Users:     make([]UserInfo, 0, len(sub.Peers)),
 			ExpiresAt: sub.CountdownExpiresAt,
 		}
+		if sub.recording != nil {
+			sci.Recording = sub.recording.info()
+		}
+		sci.PTT = sub.pttInfoLocked()
+		sci.Listeners = sub.listenerIDsLocked()
 		for _, p := range sub.Peers {
 			p.mu.RLock()
 			sci.Users = append(sci.Users, UserInfo{
-				ID:    p.ID,
-				Name:  p.Name,
-				Muted: p.Muted,
+				ID:         p.ID,
+				Name:       p.Name,
+				Muted:      p.Muted,
+				ForceMuted: p.ForceMuted,
+				Publishing: p.publishingLocked(),
+				Quality:    p.quality.score,
 			})
 			p.mu.RUnlock()
 		}
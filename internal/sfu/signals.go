@@ -8,9 +8,10 @@ type Envelope struct {
 }
 
 type CreatePayload struct {
-	Username    string `json:"username"`
-	ChannelName string `json:"channelName"`
-	Password    string `json:"password"`
+	Username     string `json:"username"`
+	ChannelName  string `json:"channelName"`
+	Password     string `json:"password"`
+	AudioProfile string `json:"audioProfile,omitempty"` // AudioProfileVoice (default) or AudioProfileMusic
 }
 
 type JoinPayload struct {
@@ -43,6 +44,11 @@ type MutePayload struct {
 	Muted bool `json:"muted"`
 }
 
+type PublishVideoPayload struct {
+	Source  string `json:"source"` // VideoSourceScreen or VideoSourceCamera
+	Enabled bool   `json:"enabled"`
+}
+
 type SubInvitePayload struct {
 	TargetUserID string `json:"targetUserId"`
 	ChannelName  string `json:"channelName"`
@@ -61,18 +67,87 @@ type MoveToSubPayload struct {
 
 type LeavePayload struct{}
 
+// ForceMuteRequestPayload asks to set or clear a moderator mute on a user of
+// the sender's room.
+type ForceMuteRequestPayload struct {
+	TargetUserID string `json:"targetUserId"`
+	Muted        bool   `json:"muted"`
+}
+
+// PTTModePayload changes a channel's push-to-talk mode; an empty ChannelID
+// means the main room.
+type PTTModePayload struct {
+	ChannelID string `json:"channelId"`
+	Mode      string `json:"mode"` // PTTModeOff, PTTModeOpen or PTTModeFloor
+}
+
+// WhisperStartPayload starts or retargets a whisper to the given users.
+type WhisperStartPayload struct {
+	Targets []string `json:"targets"`
+}
+
+// ListenPayload starts listening in on a sub-channel.
+type ListenPayload struct {
+	ChannelID string `json:"channelId"`
+}
+
+type ListenResponsePayload struct {
+	RequestID string `json:"requestId"`
+	Accepted  bool   `json:"accepted"`
+}
+
+type RecordingControlPayload struct {
+	ChannelID string `json:"channelId"`
+}
+
+type RecordingConsentPayload struct {
+	RecordingID string `json:"recordingId"`
+}
+
+// RecordingStoppedPayload tells an owner that a recording finished.
+// DownloadURL can be fetched once, within a few minutes, while the owner's
+// session is valid.
+type RecordingStoppedPayload struct {
+	RecordingID string `json:"recordingId"`
+	ChannelID   string `json:"channelId"`
+	ChannelName string `json:"channelName"`
+	DownloadURL string `json:"downloadUrl"`
+}
+
 type UserInfo struct {
-	ID           string  `json:"id"`
-	Name         string  `json:"name"`
-	Muted        bool    `json:"muted"`
-	InSubChannel *string `json:"inSubChannel"`
+	ID           string   `json:"id"`
+	Name         string   `json:"name"`
+	Muted        bool     `json:"muted"`
+	ForceMuted   bool     `json:"forceMuted,omitempty"`
+	Publishing   []string `json:"publishing,omitempty"` // video sources, see VideoSourceScreen
+	Quality      string   `json:"quality,omitempty"`    // QualityGood, QualityFair or QualityPoor
+	InSubChannel *string  `json:"inSubChannel"`
+}
+
+// PTTInfo announces a channel's push-to-talk mode and the users holding
+// talk, in the order they took it.
+type PTTInfo struct {
+	Mode    string   `json:"mode"` // PTTModeOpen or PTTModeFloor
+	Talkers []string `json:"talkers"`
+}
+
+// RecordingInfo announces a running recording. Clients must consent with
+// its ID before their audio is captured.
+type RecordingInfo struct {
+	ID        string `json:"id"`
+	StartedBy string `json:"startedBy"`
+	StartedAt int64  `json:"startedAt"`
 }
 
 type SubChannelInfo struct {
-	ID        string     `json:"id"`
-	Name      string     `json:"name"`
-	Users     []UserInfo `json:"users"`
-	ExpiresAt int64      `json:"expiresAt,omitempty"`
+	ID        string         `json:"id"`
+	Name      string         `json:"name"`
+	OwnerID   string         `json:"ownerId,omitempty"`
+	Users     []UserInfo     `json:"users"`
+	ExpiresAt int64          `json:"expiresAt,omitempty"`
+	Recording *RecordingInfo `json:"recording,omitempty"`
+	PTT       *PTTInfo       `json:"ptt,omitempty"`
+	Listeners []string       `json:"listeners,omitempty"` // users listening in without being members
 }
 
 type RoomStatePayload struct {
@@ -80,34 +155,52 @@ type RoomStatePayload struct {
 	Name             string           `json:"name"`
 	FullName         string           `json:"fullName"`
 	CurrentChannelID string           `json:"currentChannelId"`
+	OwnerID          string           `json:"ownerId"`
+	AudioProfile     string           `json:"audioProfile"`
 	Users            []UserInfo       `json:"users"`
 	SubChannels      []SubChannelInfo `json:"subChannels"`
 	ChatHistory      []ChatMessageOut `json:"chatHistory"`
+	Recording        *RecordingInfo   `json:"recording,omitempty"`
+	PTT              *PTTInfo         `json:"ptt,omitempty"`
+	AllCall          string           `json:"allCall,omitempty"` // user making an all-call
+}
+
+// ICEServer mirrors the browser's RTCIceServer.
+type ICEServer struct {
+	URLs       []string `json:"urls"`
+	Username   string   `json:"username,omitempty"`
+	Credential string   `json:"credential,omitempty"`
 }
 
 type WelcomePayload struct {
 	UserID          string           `json:"userId"`
 	SessionToken    string           `json:"sessionToken"`
 	InviteToken     string           `json:"inviteToken"`
+	ICEServers      []ICEServer      `json:"iceServers"`
 	RoomState       RoomStatePayload `json:"roomState"`
 	ReconnectNotice string           `json:"reconnectNotice,omitempty"`
 }
 
 type ErrorPayload struct {
-	Code    string `json:"code"`
-	Message string `json:"message"`
+	Code         string                 `json:"code"`
+	Message      string                 `json:"message"`
+	RetryAfterMs int64                  `json:"retryAfterMs,omitempty"`
+	Details      map[string]interface{} `json:"details,omitempty"`
 }
 
 type RoomUpdatePayload struct {
 	Users       []UserInfo       `json:"users"`
 	SubChannels []SubChannelInfo `json:"subChannels"`
+	Recording   *RecordingInfo   `json:"recording,omitempty"`
+	PTT         *PTTInfo         `json:"ptt,omitempty"`
 }
 
 type OfferPayload struct {
-	SDP   string `json:"sdp"`
-	Reset bool   `json:"reset,omitempty"`
-	Seq   uint64 `json:"seq"`
-	Epoch uint64 `json:"epoch"`
+	SDP   string            `json:"sdp"`
+	Reset bool              `json:"reset,omitempty"`
+	Seq   uint64            `json:"seq"`
+	Epoch uint64            `json:"epoch"`
+	Video map[string]string `json:"video,omitempty"` // mid to video source to attach
 }
 
 type ChatMessageOut struct {
@@ -126,6 +219,14 @@ type InviteReqPayload struct {
 	ChannelName string `json:"channelName"`
 }
 
+// ListenRequestPayload asks a sub-channel member to consent to a listen-in.
+type ListenRequestPayload struct {
+	RequestID  string `json:"requestId"`
+	FromUserID string `json:"fromUserId"`
+	FromName   string `json:"fromName"`
+	ChannelID  string `json:"channelId"`
+}
+
 type SubCountdownPayload struct {
 	SubChannelID string `json:"subChannelId"`
 	ExpiresAt    int64  `json:"expiresAt"`
@@ -136,6 +237,65 @@ type InviteExpiredPayload struct {
 	Reason   string `json:"reason"`
 }
 
+type ServerShutdownPayload struct {
+	Reason           string `json:"reason"`
+	ReconnectAfterMs int64  `json:"reconnectAfterMs"`
+}
+
+// RemovedPayload tells a client it was removed by an operator. For
+// "channel-closed" the client stays connected and is moved to the main room.
+type RemovedPayload struct {
+	Reason  string `json:"reason"`
+	Message string `json:"message,omitempty"`
+}
+
+// SpeakingPayload lists the peers currently speaking in a channel, as
+// detected by the server from RTP audio levels.
+// LastNPayload maps a last-N channel's forwarding slots to the users they
+// currently carry; "" marks a free slot. Slots is empty when the channel
+// forwards every participant.
+type LastNPayload struct {
+	ChannelID string   `json:"channelId"`
+	Slots     []string `json:"slots"`
+}
+
+// QualityPayload carries the quality scores that changed since the last
+// sample, by user ID; "" means the user no longer has a connection.
+type QualityPayload struct {
+	Peers map[string]string `json:"peers"`
+}
+
+// WhisperPayload tells a recipient that a user started or stopped
+// whispering to it. Whispered audio arrives on a "whisper-<userId>" stream.
+type WhisperPayload struct {
+	From   string `json:"from"`
+	Active bool   `json:"active"`
+}
+
+// WhisperEndedPayload tells a whisperer that its whisper ended because
+// none of its recipients is left in the room; its audio reaches its channel
+// again.
+type WhisperEndedPayload struct{}
+
+// AllCallPayload tells every member of a room that a user started or ended
+// an all-call, which reaches all channels.
+type AllCallPayload struct {
+	From   string `json:"from"`
+	Active bool   `json:"active"`
+}
+
+type SpeakingPayload struct {
+	ChannelID string   `json:"channelId"`
+	Speakers  []string `json:"speakers"`
+}
+
+// ForceMutePayload tells a client a moderator muted or unmuted it. While
+// muted the server drops its audio regardless of the client's own state.
+type ForceMutePayload struct {
+	Muted   bool   `json:"muted"`
+	Message string `json:"message,omitempty"`
+}
+
 type ChatHistoryPayload struct {
 	ChannelID string           `json:"channelId"`
 	Messages  []ChatMessageOut `json:"messages"`
@@ -151,6 +311,14 @@ const (
 	ErrChannelNotFound  = "CHANNEL_NOT_FOUND"
 	ErrAlreadyInSub     = "ALREADY_IN_SUB"
 	ErrInviteExpired    = "INVITE_EXPIRED"
+	ErrUserNotFound     = "USER_NOT_FOUND"
+	ErrRateLimited      = "RATE_LIMITED"
 	ErrInvalidMessage   = "INVALID_MESSAGE"
+	ErrNotOwner         = "NOT_OWNER"
+	ErrRecordingOff     = "RECORDING_DISABLED"
+	ErrVideoOff         = "VIDEO_DISABLED"
+	ErrFloorTaken       = "FLOOR_TAKEN"
+	ErrListenDenied     = "LISTEN_DENIED"
+	ErrRecordingMissing = "RECORDING_NOT_FOUND"
 	ErrInternalError    = "INTERNAL_ERROR"
 )
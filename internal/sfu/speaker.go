@@ -0,0 +1,139 @@
+package sfu
+
+import (
+	"sort"
+	"time"
+
+	"github.com/pion/rtp"
+)
+
+// audioLevelURI is the RFC 6464 client-to-mixer audio level extension.
+const audioLevelURI = "urn:ietf:params:rtp-hdrext:ssrc-audio-level"
+
+// speechSmoothing is the weight of a new audio level sample in the moving
+// average. At 50 packets per second it settles within roughly 100ms.
+const speechSmoothing = 0.3
+
+// SpeakingConfig tunes server-side active speaker detection. Threshold is an
+// RFC 6464 audio level in -dBov (0 is loudest, 127 silence); a peer speaks
+// while its smoothed level is at or below it and stops after Hold of quieter
+// audio. Interval is the minimum gap between speaking events per channel.
+type SpeakingConfig struct {
+	Threshold uint8
+	Hold      time.Duration
+	Interval  time.Duration
+}
+
+func loadSpeakingConfig() SpeakingConfig {
+	return SpeakingConfig{
+		Threshold: uint8(getEnvIntBounded("SPEAKING_LEVEL_THRESHOLD", 50, 0, 127)),
+		Hold:      getEnvDuration("SPEAKING_HOLD", 400*time.Millisecond),
+		Interval:  getEnvDuration("SPEAKING_EVENT_INTERVAL", 200*time.Millisecond),
+	}
+}
+
+// speechDetector keeps the smoothed speaking state of one inbound audio
+// track. It is owned by the track's forwarding goroutine.
+type speechDetector struct {
+	cfg      SpeakingConfig
+	extID    uint8
+	smoothed float64
+	speaking bool
+	lastLoud time.Time
+}
+
+// newSpeechDetector returns a detector for the audio level extension in the
+// publisher's negotiated extensions, or nil when the client does not send it.
+func newSpeechDetector(cfg SpeakingConfig, extURIs map[uint8]string) *speechDetector {
+	for id, uri := range extURIs {
+		if uri == audioLevelURI {
+			return &speechDetector{cfg: cfg, extID: id, smoothed: 127}
+		}
+	}
+	return nil
+}
+
+// observe feeds the audio level of pkt into the moving average and reports
+// whether the speaking state changed. Packets without the extension are
+// ignored; muted peers are treated as silent.
+func (d *speechDetector) observe(pkt *rtp.Packet, muted bool, now time.Time) bool {
+	level := uint8(127)
+	if !muted {
+		raw := pkt.GetExtension(d.extID)
+		if raw == nil {
+			return false
+		}
+		var ext rtp.AudioLevelExtension
+		if err := ext.Unmarshal(raw); err != nil {
+			return false
+		}
+		level = ext.Level
+	}
+
+	d.smoothed += speechSmoothing * (float64(level) - d.smoothed)
+	if !muted && d.smoothed <= float64(d.cfg.Threshold) {
+		d.lastLoud = now
+		if !d.speaking {
+			d.speaking = true
+			return true
+		}
+		return false
+	}
+	if d.speaking && (muted || now.Sub(d.lastLoud) >= d.cfg.Hold) {
+		d.speaking = false
+		return true
+	}
+	return false
+}
+
+// setSpeaking records a peer's speaking state in room and schedules a
+// speaking event. Events are coalesced so each channel gets at most one per
+// SpeakingConfig.Interval, always carrying the latest set of speakers.
+func (h *Hub) setSpeaking(room *Room, peerID string, speaking bool) {
+	room.mu.Lock()
+	if room.speakers[peerID] == speaking {
+		room.mu.Unlock()
+		return
+	}
+	if speaking {
+		room.speakers[peerID] = true
+	} else {
+		delete(room.speakers, peerID)
+	}
+
+	if room.speakingTimer != nil {
+		room.mu.Unlock()
+		return
+	}
+	wait := h.cfg.Speaking.Interval - room.clock.Now().Sub(room.speakingSentAt)
+	if wait > 0 {
+		room.speakingTimer = room.clock.AfterFunc(wait, func() {
+			h.broadcastSpeakers(room)
+		})
+		room.mu.Unlock()
+		return
+	}
+	room.mu.Unlock()
+
+	h.broadcastSpeakers(room)
+}
+
+func (h *Hub) broadcastSpeakers(room *Room) {
+	room.mu.Lock()
+	room.speakingTimer = nil
+	room.speakingSentAt = room.clock.Now()
+	speakers := make([]string, 0, len(room.speakers))
+	for id := range room.speakers {
+		if _, ok := room.Peers[id]; ok {
+			speakers = append(speakers, id)
+		}
+	}
+	roomID := room.ID
+	room.mu.Unlock()
+
+	sort.Strings(speakers)
+	room.BroadcastToChannel("speaking", SpeakingPayload{
+		ChannelID: roomID,
+		Speakers:  speakers,
+	}, "")
+}
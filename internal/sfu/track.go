@@ -0,0 +1,287 @@
+package sfu
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+)
+
+const absSendTimeURI = "http://www.webrtc.org/experiments/rtp-hdrext/abs-send-time"
+
+// forwardedHeaderExtensions are registered with the MediaEngine so both
+// publishers and receivers negotiate them. ForwardTrack carries them across
+// under each receiver's own IDs.
+var forwardedHeaderExtensions = []string{audioLevelURI, absSendTimeURI}
+
+// transportHeaderExtensions identify a stream on one transport and must not
+// be copied from the publisher's session into a receiver's.
+var transportHeaderExtensions = map[string]bool{
+	"urn:ietf:params:rtp-hdrext:sdes:mid":                    true,
+	"urn:ietf:params:rtp-hdrext:sdes:rtp-stream-id":          true,
+	"urn:ietf:params:rtp-hdrext:sdes:repaired-rtp-stream-id": true,
+}
+
+// RFC 8285 extension profiles.
+const (
+	extensionProfileOneByte = 0xBEDE
+	extensionProfileTwoByte = 0x1000
+)
+
+// ForwardTrack is the outbound copy of a peer's audio or video. Unlike
+// TrackLocalStaticRTP it remembers the header extension IDs each receiving
+// PeerConnection negotiated, so Chrome and Firefox receivers both get
+// extensions under the IDs they expect.
+type ForwardTrack struct {
+	id       string
+	streamID string
+	codec    webrtc.RTPCodecCapability
+
+	mu       sync.RWMutex
+	bindings []*trackBinding
+
+	// keyframe asks the publisher of a video track for a keyframe; see
+	// requestKeyframe.
+	keyframe     func()
+	lastKeyframe time.Time
+
+	// history holds the last audio frames written, the redundant blocks of
+	// the RED packets sent to bindings with red set.
+	historyMu sync.Mutex
+	history   []redBlock
+}
+
+type trackBinding struct {
+	id             string
+	ssrc           webrtc.SSRC
+	payloadType    webrtc.PayloadType
+	redPayloadType webrtc.PayloadType // 0 when the receiver did not negotiate RED
+	red            bool               // send RED instead of plain Opus
+	writeStream    webrtc.TrackLocalWriter
+	extIDs         map[string]uint8
+}
+
+func NewForwardTrack(codec webrtc.RTPCodecCapability, id, streamID string) *ForwardTrack {
+	return &ForwardTrack{
+		id:       id,
+		streamID: streamID,
+		codec:    codec,
+	}
+}
+
+// Bind is called by the PeerConnection when a sender for the track is
+// negotiated. It picks the receiver's payload type for our codec, preferring
+// an exact fmtp match so H264 profiles line up, and records the receiver's
+// extension IDs. For audio it also notes the receiver's RED payload type.
+func (t *ForwardTrack) Bind(ctx webrtc.TrackLocalContext) (webrtc.RTPCodecParameters, error) {
+	codecs := ctx.CodecParameters()
+	match := -1
+	for i, codec := range codecs {
+		if !strings.EqualFold(codec.MimeType, t.codec.MimeType) {
+			continue
+		}
+		if match < 0 || (codec.SDPFmtpLine == t.codec.SDPFmtpLine && codecs[match].SDPFmtpLine != t.codec.SDPFmtpLine) {
+			match = i
+		}
+	}
+	if match < 0 {
+		return webrtc.RTPCodecParameters{}, webrtc.ErrUnsupportedCodec
+	}
+	codec := codecs[match]
+
+	extIDs := make(map[string]uint8)
+	for _, ext := range ctx.HeaderExtensions() {
+		if ext.ID > 0 && ext.ID < 256 {
+			extIDs[ext.URI] = uint8(ext.ID)
+		}
+	}
+
+	var redPT webrtc.PayloadType
+	if t.Kind() == webrtc.RTPCodecTypeAudio {
+		redPT = redPayloadTypeFor(codecs, codec.PayloadType)
+	}
+
+	t.mu.Lock()
+	t.bindings = append(t.bindings, &trackBinding{
+		id:             ctx.ID(),
+		ssrc:           ctx.SSRC(),
+		payloadType:    codec.PayloadType,
+		redPayloadType: redPT,
+		writeStream:    ctx.WriteStream(),
+		extIDs:         extIDs,
+	})
+	t.mu.Unlock()
+	return codec, nil
+}
+
+func (t *ForwardTrack) Unbind(ctx webrtc.TrackLocalContext) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for i, b := range t.bindings {
+		if b.id == ctx.ID() {
+			t.bindings = append(t.bindings[:i], t.bindings[i+1:]...)
+			return nil
+		}
+	}
+	return errors.New("binding not found")
+}
+
+func (t *ForwardTrack) ID() string       { return t.id }
+func (t *ForwardTrack) RID() string      { return "" }
+func (t *ForwardTrack) StreamID() string { return t.streamID }
+
+func (t *ForwardTrack) Kind() webrtc.RTPCodecType {
+	if strings.HasPrefix(strings.ToLower(t.codec.MimeType), "video/") {
+		return webrtc.RTPCodecTypeVideo
+	}
+	return webrtc.RTPCodecTypeAudio
+}
+
+// WriteRTP forwards pkt to every binding. srcExtensions maps the publisher's
+// negotiated extension IDs to URIs; extensions are rewritten to each
+// receiver's IDs and dropped when the receiver did not negotiate them. Like
+// TrackLocalStaticRTP it keeps writing after a failed binding and returns the
+// joined errors. Audio payloads must be plain Opus; bindings with RED turned
+// on get them wrapped with the frames written before.
+func (t *ForwardTrack) WriteRTP(pkt *rtp.Packet, srcExtensions map[uint8]string) error {
+	var history []redBlock
+	audio := t.Kind() == webrtc.RTPCodecTypeAudio
+	if audio {
+		history = t.recordFrame(pkt)
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	var errs []error
+	var red []byte
+	var redPT webrtc.PayloadType
+	for _, b := range t.bindings {
+		hdr := pkt.Header
+		hdr.SSRC = uint32(b.ssrc)
+		hdr.PayloadType = uint8(b.payloadType)
+		payload := pkt.Payload
+		if b.red && b.redPayloadType != 0 {
+			if red == nil || redPT != b.payloadType {
+				red = encodeRED(uint8(b.payloadType), history, pkt.Timestamp, pkt.Payload)
+				redPT = b.payloadType
+			}
+			hdr.PayloadType = uint8(b.redPayloadType)
+			payload = red
+		}
+		if err := rewriteHeaderExtensions(&hdr, &pkt.Header, srcExtensions, b.extIDs); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if _, err := b.writeStream.WriteRTP(&hdr, payload); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// recordFrame returns the frames written before pkt, oldest first, and adds
+// pkt to them. Late packets are not recorded.
+func (t *ForwardTrack) recordFrame(pkt *rtp.Packet) []redBlock {
+	t.historyMu.Lock()
+	defer t.historyMu.Unlock()
+
+	history := t.history
+	if n := len(history); n > 0 && int32(pkt.Timestamp-history[n-1].timestamp) <= 0 {
+		return history
+	}
+	frame := redBlock{timestamp: pkt.Timestamp, payload: append([]byte(nil), pkt.Payload...)}
+	start := 0
+	if len(history) == redDistance {
+		start = 1
+	}
+	next := make([]redBlock, 0, redDistance)
+	next = append(next, history[start:]...)
+	t.history = append(next, frame)
+	return history
+}
+
+// resetHistory forgets the frames written so far, so the next RED packets
+// carry no redundancy from before.
+func (t *ForwardTrack) resetHistory() {
+	t.historyMu.Lock()
+	t.history = nil
+	t.historyMu.Unlock()
+}
+
+// setRED switches the binding with ssrc between RED and plain Opus. It has
+// no effect when the receiver did not negotiate RED.
+func (t *ForwardTrack) setRED(ssrc webrtc.SSRC, enabled bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, b := range t.bindings {
+		if b.ssrc == ssrc {
+			b.red = enabled && b.redPayloadType != 0
+		}
+	}
+}
+
+// rewriteHeaderExtensions replaces dst's extensions with those of src,
+// translated from the source session's IDs (srcURIs, ID to URI) to the
+// destination session's (dstIDs, URI to ID). Extensions unknown to either
+// side and transport-scoped ones are dropped. The two-byte profile is used
+// when a mapped ID or payload does not fit the one-byte form.
+func rewriteHeaderExtensions(dst, src *rtp.Header, srcURIs map[uint8]string, dstIDs map[string]uint8) error {
+	dst.Extension = false
+	dst.ExtensionProfile = 0
+	dst.Extensions = nil
+
+	type mappedExtension struct {
+		id      uint8
+		payload []byte
+	}
+	var mapped []mappedExtension
+	profile := uint16(extensionProfileOneByte)
+	for _, id := range src.GetExtensionIDs() {
+		uri, ok := srcURIs[id]
+		if !ok || transportHeaderExtensions[uri] {
+			continue
+		}
+		dstID, ok := dstIDs[uri]
+		if !ok {
+			continue
+		}
+		payload := src.GetExtension(id)
+		if dstID > 14 || len(payload) == 0 || len(payload) > 16 {
+			profile = extensionProfileTwoByte
+		}
+		mapped = append(mapped, mappedExtension{id: dstID, payload: payload})
+	}
+	if len(mapped) == 0 {
+		return nil
+	}
+
+	dst.Extension = true
+	dst.ExtensionProfile = profile
+	for _, ext := range mapped {
+		if err := dst.SetExtension(ext.id, ext.payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// headerExtensionURIs returns the extension IDs negotiated on receiver,
+// keyed by ID.
+func headerExtensionURIs(receiver *webrtc.RTPReceiver) map[uint8]string {
+	uris := make(map[uint8]string)
+	if receiver == nil {
+		return uris
+	}
+	for _, ext := range receiver.GetParameters().HeaderExtensions {
+		if ext.ID > 0 && ext.ID < 256 {
+			uris[uint8(ext.ID)] = ext.URI
+		}
+	}
+	return uris
+}
@@ -0,0 +1,274 @@
+package sfu
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+)
+
+const midURI = "urn:ietf:params:rtp-hdrext:sdes:mid"
+
+// capturedPacket is one packet written to a testTrackContext.
+type capturedPacket struct {
+	header  rtp.Header
+	payload []byte
+}
+
+// testTrackContext stands in for the TrackLocalContext of one negotiated
+// receiver session and records what the track writes to it.
+type testTrackContext struct {
+	id          string
+	ssrc        webrtc.SSRC
+	payloadType webrtc.PayloadType
+	redPT       webrtc.PayloadType // RED is negotiated when set
+	extIDs      map[string]int
+	written     []capturedPacket
+}
+
+func (c *testTrackContext) CodecParameters() []webrtc.RTPCodecParameters {
+	codecs := []webrtc.RTPCodecParameters{{
+		RTPCodecCapability: webrtc.RTPCodecCapability{
+			MimeType:    webrtc.MimeTypeOpus,
+			ClockRate:   48000,
+			Channels:    2,
+			SDPFmtpLine: "minptime=10;useinbandfec=1",
+		},
+		PayloadType: c.payloadType,
+	}}
+	if c.redPT != 0 {
+		pt := strconv.Itoa(int(c.payloadType))
+		codecs = append(codecs, webrtc.RTPCodecParameters{
+			RTPCodecCapability: webrtc.RTPCodecCapability{
+				MimeType:    mimeTypeRED,
+				ClockRate:   48000,
+				Channels:    2,
+				SDPFmtpLine: pt + "/" + pt,
+			},
+			PayloadType: c.redPT,
+		})
+	}
+	return codecs
+}
+
+func (c *testTrackContext) HeaderExtensions() []webrtc.RTPHeaderExtensionParameter {
+	exts := make([]webrtc.RTPHeaderExtensionParameter, 0, len(c.extIDs))
+	for uri, id := range c.extIDs {
+		exts = append(exts, webrtc.RTPHeaderExtensionParameter{URI: uri, ID: id})
+	}
+	return exts
+}
+
+func (c *testTrackContext) SSRC() webrtc.SSRC                    { return c.ssrc }
+func (c *testTrackContext) WriteStream() webrtc.TrackLocalWriter { return c }
+func (c *testTrackContext) ID() string                           { return c.id }
+func (c *testTrackContext) RTCPReader() interceptor.RTCPReader   { return nil }
+func (c *testTrackContext) Write(b []byte) (int, error)          { return len(b), nil }
+
+func (c *testTrackContext) WriteRTP(header *rtp.Header, payload []byte) (int, error) {
+	hdr := header.Clone()
+	c.written = append(c.written, capturedPacket{header: hdr, payload: append([]byte(nil), payload...)})
+	return len(payload), nil
+}
+
+// last returns the packet written most recently.
+func (c *testTrackContext) last(t *testing.T) capturedPacket {
+	t.Helper()
+	if len(c.written) == 0 {
+		t.Fatalf("%s: nothing written", c.id)
+	}
+	return c.written[len(c.written)-1]
+}
+
+// bindTestTrack binds a new audio ForwardTrack to a Chrome-like session that
+// negotiated ssrc-audio-level as 1 and a Firefox-like one that negotiated it
+// as 3.
+func bindTestTrack(t *testing.T) (*ForwardTrack, *testTrackContext, *testTrackContext) {
+	t.Helper()
+	track := NewForwardTrack(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus}, "audio-test", "stream-test")
+	chrome := &testTrackContext{
+		id:          "chrome",
+		ssrc:        1111,
+		payloadType: 111,
+		extIDs:      map[string]int{audioLevelURI: 1, absSendTimeURI: 2, midURI: 4},
+	}
+	firefox := &testTrackContext{
+		id:          "firefox",
+		ssrc:        2222,
+		payloadType: 109,
+		extIDs:      map[string]int{audioLevelURI: 3, midURI: 5},
+	}
+	for _, ctx := range []*testTrackContext{chrome, firefox} {
+		codec, err := track.Bind(ctx)
+		if err != nil {
+			t.Fatalf("bind %s: %v", ctx.id, err)
+		}
+		if codec.PayloadType != ctx.payloadType {
+			t.Fatalf("bind %s: payload type %d, want %d", ctx.id, codec.PayloadType, ctx.payloadType)
+		}
+	}
+	return track, chrome, firefox
+}
+
+// publisherPacket builds a packet from a publisher session that negotiated
+// ssrc-audio-level as 1, abs-send-time as 2 and mid as 4.
+func publisherPacket(t *testing.T, exts map[uint8][]byte) *rtp.Packet {
+	t.Helper()
+	pkt := &rtp.Packet{
+		Header: rtp.Header{
+			Version:        2,
+			PayloadType:    111,
+			SequenceNumber: 4242,
+			Timestamp:      960000,
+			SSRC:           9999,
+		},
+		Payload: []byte{0xfc, 0x01, 0x02, 0x03},
+	}
+	for id, payload := range exts {
+		pkt.Header.Extension = true
+		pkt.Header.ExtensionProfile = extensionProfileOneByte
+		if err := pkt.Header.SetExtension(id, payload); err != nil {
+			t.Fatalf("set extension %d: %v", id, err)
+		}
+	}
+	return pkt
+}
+
+var publisherExtensions = map[uint8]string{1: audioLevelURI, 2: absSendTimeURI, 4: midURI}
+
+func assertForwarded(t *testing.T, ctx *testTrackContext, pkt *rtp.Packet) capturedPacket {
+	t.Helper()
+	got := ctx.last(t)
+	if got.header.SequenceNumber != pkt.SequenceNumber {
+		t.Errorf("%s: seq %d, want %d", ctx.id, got.header.SequenceNumber, pkt.SequenceNumber)
+	}
+	if got.header.Timestamp != pkt.Timestamp {
+		t.Errorf("%s: timestamp %d, want %d", ctx.id, got.header.Timestamp, pkt.Timestamp)
+	}
+	if got.header.SSRC != uint32(ctx.ssrc) {
+		t.Errorf("%s: ssrc %d, want %d", ctx.id, got.header.SSRC, ctx.ssrc)
+	}
+	if got.header.PayloadType != uint8(ctx.payloadType) {
+		t.Errorf("%s: payload type %d, want %d", ctx.id, got.header.PayloadType, ctx.payloadType)
+	}
+	if !bytes.Equal(got.payload, pkt.Payload) {
+		t.Errorf("%s: payload %x, want %x", ctx.id, got.payload, pkt.Payload)
+	}
+	return got
+}
+
+func TestForwardTrackRemapsExtensionIDsPerBinding(t *testing.T) {
+	track, chrome, firefox := bindTestTrack(t)
+	level := []byte{0x80 | 30}
+	sendTime := []byte{0x01, 0x02, 0x03}
+	pkt := publisherPacket(t, map[uint8][]byte{1: level, 2: sendTime, 4: []byte("0")})
+
+	if err := track.WriteRTP(pkt, publisherExtensions); err != nil {
+		t.Fatalf("WriteRTP: %v", err)
+	}
+
+	got := assertForwarded(t, chrome, pkt)
+	if ext := got.header.GetExtension(1); !bytes.Equal(ext, level) {
+		t.Errorf("chrome: audio level on 1 = %x, want %x", ext, level)
+	}
+	if ext := got.header.GetExtension(2); !bytes.Equal(ext, sendTime) {
+		t.Errorf("chrome: abs-send-time on 2 = %x, want %x", ext, sendTime)
+	}
+	if ext := got.header.GetExtension(4); ext != nil {
+		t.Errorf("chrome: publisher's mid forwarded: %x", ext)
+	}
+
+	got = assertForwarded(t, firefox, pkt)
+	if ext := got.header.GetExtension(3); !bytes.Equal(ext, level) {
+		t.Errorf("firefox: audio level on 3 = %x, want %x", ext, level)
+	}
+	if ids := got.header.GetExtensionIDs(); len(ids) != 1 || ids[0] != 3 {
+		t.Errorf("firefox: extension IDs %v, want [3]", ids)
+	}
+
+	// The publisher's packet is left as it was.
+	if ext := pkt.Header.GetExtension(1); !bytes.Equal(ext, level) {
+		t.Errorf("source packet modified: audio level on 1 = %x", ext)
+	}
+}
+
+func TestForwardTrackMissingExtension(t *testing.T) {
+	track, chrome, firefox := bindTestTrack(t)
+	sendTime := []byte{0x0a, 0x0b, 0x0c}
+	pkt := publisherPacket(t, map[uint8][]byte{2: sendTime})
+
+	if err := track.WriteRTP(pkt, publisherExtensions); err != nil {
+		t.Fatalf("WriteRTP: %v", err)
+	}
+
+	got := assertForwarded(t, chrome, pkt)
+	if ids := got.header.GetExtensionIDs(); len(ids) != 1 || ids[0] != 2 {
+		t.Errorf("chrome: extension IDs %v, want [2]", ids)
+	}
+
+	// Firefox negotiated neither extension the packet carries.
+	got = assertForwarded(t, firefox, pkt)
+	if got.header.Extension || len(got.header.Extensions) != 0 {
+		t.Errorf("firefox: extensions %v, want none", got.header.Extensions)
+	}
+}
+
+func TestForwardTrackUnknownExtensionID(t *testing.T) {
+	track, chrome, firefox := bindTestTrack(t)
+	level := []byte{0x80 | 10}
+	pkt := publisherPacket(t, map[uint8][]byte{1: level, 7: {0xff}})
+
+	if err := track.WriteRTP(pkt, publisherExtensions); err != nil {
+		t.Fatalf("WriteRTP: %v", err)
+	}
+
+	for _, tc := range []struct {
+		ctx *testTrackContext
+		id  uint8
+	}{{chrome, 1}, {firefox, 3}} {
+		got := assertForwarded(t, tc.ctx, pkt)
+		if ids := got.header.GetExtensionIDs(); len(ids) != 1 || ids[0] != tc.id {
+			t.Errorf("%s: extension IDs %v, want [%d]", tc.ctx.id, ids, tc.id)
+		}
+		if ext := got.header.GetExtension(tc.id); !bytes.Equal(ext, level) {
+			t.Errorf("%s: audio level %x, want %x", tc.ctx.id, ext, level)
+		}
+	}
+}
+
+func TestRewriteHeaderExtensionsTwoByteProfile(t *testing.T) {
+	src := publisherPacket(t, map[uint8][]byte{1: {0x80 | 5}}).Header
+	var dst rtp.Header
+
+	if err := rewriteHeaderExtensions(&dst, &src, publisherExtensions, map[string]uint8{audioLevelURI: 20}); err != nil {
+		t.Fatalf("rewriteHeaderExtensions: %v", err)
+	}
+	if dst.ExtensionProfile != extensionProfileTwoByte {
+		t.Errorf("profile %#x, want %#x", dst.ExtensionProfile, extensionProfileTwoByte)
+	}
+	if ext := dst.GetExtension(20); !bytes.Equal(ext, []byte{0x80 | 5}) {
+		t.Errorf("audio level on 20 = %x", ext)
+	}
+}
+
+func TestForwardTrackUnbind(t *testing.T) {
+	track, chrome, firefox := bindTestTrack(t)
+	if err := track.Unbind(firefox); err != nil {
+		t.Fatalf("Unbind: %v", err)
+	}
+	if err := track.Unbind(firefox); err == nil {
+		t.Error("second Unbind succeeded")
+	}
+
+	pkt := publisherPacket(t, nil)
+	if err := track.WriteRTP(pkt, publisherExtensions); err != nil {
+		t.Fatalf("WriteRTP: %v", err)
+	}
+	assertForwarded(t, chrome, pkt)
+	if len(firefox.written) != 0 {
+		t.Errorf("firefox: %d packets after Unbind", len(firefox.written))
+	}
+}
@@ -0,0 +1,186 @@
+package sfu
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pion/turn/v2"
+)
+
+// TURNConfig configures the optional embedded TURN server. It listens on the
+// same port for UDP and TCP and relays through RelayMin..RelayMax on RelayIP.
+type TURNConfig struct {
+	Enabled bool
+	Port    int
+	Realm   string
+	// Secret signs the time-limited credentials handed to clients. A random
+	// secret is generated at start when empty.
+	Secret string
+	// Host is advertised in turn: URLs; it defaults to PUBLIC_IP.
+	Host          string
+	RelayIP       string
+	RelayMin      uint16
+	RelayMax      uint16
+	CredentialTTL time.Duration
+}
+
+func loadTURNConfig(publicIPSource, publicIP string) TURNConfig {
+	cfg := TURNConfig{
+		Enabled:       getEnvBool("TURN_ENABLED", false),
+		Port:          getEnvIntBounded("TURN_PORT", 3478, 1, 65535),
+		Realm:         strings.TrimSpace(os.Getenv("TURN_REALM")),
+		Secret:        os.Getenv("TURN_SECRET"),
+		Host:          strings.TrimSpace(os.Getenv("TURN_HOST")),
+		RelayIP:       strings.TrimSpace(os.Getenv("TURN_RELAY_IP")),
+		RelayMin:      getEnvUint16("TURN_RELAY_MIN", 49160),
+		RelayMax:      getEnvUint16("TURN_RELAY_MAX", 49200),
+		CredentialTTL: getEnvDuration("TURN_CREDENTIAL_TTL", 6*time.Hour),
+	}
+	if cfg.Realm == "" {
+		cfg.Realm = "qvoch"
+	}
+	if cfg.Host == "" {
+		cfg.Host = publicIPSource
+	}
+	if cfg.RelayIP == "" {
+		cfg.RelayIP = publicIP
+	}
+	if cfg.RelayMin > cfg.RelayMax {
+		cfg.RelayMin, cfg.RelayMax = cfg.RelayMax, cfg.RelayMin
+	}
+	return cfg
+}
+
+// startTURN starts the embedded TURN server if enabled. Failures are logged
+// and leave the hub running without a relay.
+func (h *Hub) startTURN() {
+	cfg := h.cfg.TURN
+	if !cfg.Enabled {
+		return
+	}
+
+	secret := cfg.Secret
+	if secret == "" {
+		buf := make([]byte, 32)
+		if _, err := rand.Read(buf); err != nil {
+			mediaLog.Error("TURN: generate secret failed", "err", err)
+			return
+		}
+		secret = hex.EncodeToString(buf)
+	}
+
+	relayIP := net.ParseIP(cfg.RelayIP)
+	if relayIP == nil {
+		mediaLog.Warn("TURN: no valid relay IP (set PUBLIC_IP or TURN_RELAY_IP), using 127.0.0.1", "relay_ip", cfg.RelayIP)
+		relayIP = net.IPv4(127, 0, 0, 1)
+	}
+	host := cfg.Host
+	if host == "" {
+		host = relayIP.String()
+	}
+
+	listenAddr := fmt.Sprintf("0.0.0.0:%d", cfg.Port)
+	udpConn, err := net.ListenPacket("udp4", listenAddr)
+	if err != nil {
+		mediaLog.Error("TURN: listen udp failed", "addr", listenAddr, "err", err)
+		return
+	}
+	tcpListener, err := net.Listen("tcp4", listenAddr)
+	if err != nil {
+		udpConn.Close()
+		mediaLog.Error("TURN: listen tcp failed", "addr", listenAddr, "err", err)
+		return
+	}
+
+	newRelayGen := func() turn.RelayAddressGenerator {
+		return &turn.RelayAddressGeneratorPortRange{
+			RelayAddress: relayIP,
+			Address:      "0.0.0.0",
+			MinPort:      cfg.RelayMin,
+			MaxPort:      cfg.RelayMax,
+		}
+	}
+
+	server, err := turn.NewServer(turn.ServerConfig{
+		Realm:       cfg.Realm,
+		AuthHandler: turnAuthHandler(secret),
+		PacketConnConfigs: []turn.PacketConnConfig{{
+			PacketConn:            udpConn,
+			RelayAddressGenerator: newRelayGen(),
+		}},
+		ListenerConfigs: []turn.ListenerConfig{{
+			Listener:              tcpListener,
+			RelayAddressGenerator: newRelayGen(),
+		}},
+	})
+	if err != nil {
+		udpConn.Close()
+		tcpListener.Close()
+		mediaLog.Error("TURN: start failed", "err", err)
+		return
+	}
+
+	h.mu.Lock()
+	h.turnServer = server
+	h.turnSecret = secret
+	h.turnURLs = []string{
+		fmt.Sprintf("turn:%s:%d?transport=udp", host, cfg.Port),
+		fmt.Sprintf("turn:%s:%d?transport=tcp", host, cfg.Port),
+	}
+	h.mu.Unlock()
+
+	mediaLog.Info("TURN server started",
+		"addr", listenAddr, "host", host, "relay_ip", relayIP.String(),
+		"relay_min", cfg.RelayMin, "relay_max", cfg.RelayMax)
+}
+
+func (h *Hub) stopTURN() {
+	h.mu.Lock()
+	server := h.turnServer
+	h.turnServer = nil
+	h.turnURLs = nil
+	h.mu.Unlock()
+
+	if server != nil {
+		if err := server.Close(); err != nil {
+			mediaLog.Warn("TURN: close failed", "err", err)
+		}
+	}
+}
+
+// turnCredentials builds TURN REST API style credentials: the username is
+// "<unix expiry>:<id>" and the password is base64(HMAC-SHA1(secret, username)).
+func turnCredentials(secret, id string, expiresAt time.Time) (string, string) {
+	username := strconv.FormatInt(expiresAt.Unix(), 10)
+	if id != "" {
+		username += ":" + id
+	}
+	return username, turnPassword(secret, username)
+}
+
+func turnPassword(secret, username string) string {
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write([]byte(username))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func turnAuthHandler(secret string) turn.AuthHandler {
+	return func(username, realm string, srcAddr net.Addr) ([]byte, bool) {
+		expiry, _, _ := strings.Cut(username, ":")
+		ts, err := strconv.ParseInt(expiry, 10, 64)
+		if err != nil || time.Now().Unix() > ts {
+			mediaLog.Debug("TURN: rejected credentials", "remote", srcAddr.String())
+			return nil, false
+		}
+		return turn.GenerateAuthKey(username, realm, turnPassword(secret, username)), true
+	}
+}
@@ -0,0 +1,199 @@
+//go:build integration
+
+package sfu
+
+import (
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+	"github.com/pion/webrtc/v3/pkg/media"
+)
+
+// freeUDPPort returns a loopback UDP port that was free a moment ago.
+func freeUDPPort(t *testing.T) int {
+	t.Helper()
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+// startTURNHub starts a hub whose only ICE server is its embedded TURN
+// server on the loopback interface.
+func startTURNHub(t *testing.T) *Hub {
+	t.Helper()
+	cfg := DefaultConfig()
+	cfg.ICE.Servers = nil
+	cfg.TURN.Enabled = true
+	cfg.TURN.Port = freeUDPPort(t)
+	cfg.TURN.Secret = "integration-secret"
+	cfg.TURN.Host = "127.0.0.1"
+	cfg.TURN.RelayIP = "127.0.0.1"
+	cfg.TURN.RelayMin = 51000
+	cfg.TURN.RelayMax = 51100
+
+	h := NewHub(cfg, nil)
+	h.Start()
+	t.Cleanup(h.Stop)
+	if h.turnServer == nil {
+		t.Fatal("embedded TURN server did not start")
+	}
+	return h
+}
+
+// newRelayPeerConnection creates a PeerConnection that only gathers relay
+// candidates from the hub's TURN server, with REST credentials for peerID.
+func newRelayPeerConnection(t *testing.T, h *Hub, peerID string) *webrtc.PeerConnection {
+	t.Helper()
+	servers := h.ICEServers(peerID)
+	if len(servers) != 1 {
+		t.Fatalf("ICEServers: got %d servers, want the embedded TURN server only", len(servers))
+	}
+	if !strings.HasSuffix(servers[0].Username, ":"+peerID) || servers[0].Credential == "" {
+		t.Fatalf("ICEServers: not REST credentials: %q", servers[0].Username)
+	}
+
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{
+		ICEServers:         toWebRTCICEServers(servers),
+		ICETransportPolicy: webrtc.ICETransportPolicyRelay,
+	})
+	if err != nil {
+		t.Fatalf("new PeerConnection: %v", err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	return pc
+}
+
+// signal runs a full offer/answer between offerer and answerer, waiting for
+// ICE gathering so no trickle is needed.
+func signal(t *testing.T, offerer, answerer *webrtc.PeerConnection) {
+	t.Helper()
+	offer, err := offerer.CreateOffer(nil)
+	if err != nil {
+		t.Fatalf("create offer: %v", err)
+	}
+	gathered := webrtc.GatheringCompletePromise(offerer)
+	if err := offerer.SetLocalDescription(offer); err != nil {
+		t.Fatalf("set offer: %v", err)
+	}
+	<-gathered
+	if err := answerer.SetRemoteDescription(*offerer.LocalDescription()); err != nil {
+		t.Fatalf("apply offer: %v", err)
+	}
+
+	answer, err := answerer.CreateAnswer(nil)
+	if err != nil {
+		t.Fatalf("create answer: %v", err)
+	}
+	gathered = webrtc.GatheringCompletePromise(answerer)
+	if err := answerer.SetLocalDescription(answer); err != nil {
+		t.Fatalf("set answer: %v", err)
+	}
+	<-gathered
+	if err := offerer.SetRemoteDescription(*answerer.LocalDescription()); err != nil {
+		t.Fatalf("apply answer: %v", err)
+	}
+}
+
+// TestTURNRelayOnlyMedia connects two relay-only pion clients through the
+// embedded TURN server. It opens real sockets on the loopback interface, so
+// it only runs with
+//
+//	go test -tags integration -run TURN ./internal/sfu
+func TestTURNRelayOnlyMedia(t *testing.T) {
+	h := startTURNHub(t)
+	sender := newRelayPeerConnection(t, h, "peer-a")
+	receiver := newRelayPeerConnection(t, h, "peer-b")
+
+	track, err := webrtc.NewTrackLocalStaticSample(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus}, "audio", "stream-peer-a")
+	if err != nil {
+		t.Fatalf("new track: %v", err)
+	}
+	rtpSender, err := sender.AddTrack(track)
+	if err != nil {
+		t.Fatalf("add track: %v", err)
+	}
+
+	received := make(chan struct{})
+	receiver.OnTrack(func(remote *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		if _, _, err := remote.ReadRTP(); err == nil {
+			close(received)
+		}
+	})
+
+	signal(t, sender, receiver)
+
+	deadline := time.After(20 * time.Second)
+	ticker := time.NewTicker(20 * time.Millisecond)
+	defer ticker.Stop()
+	frame := make([]byte, 40)
+wait:
+	for {
+		select {
+		case <-received:
+			break wait
+		case <-ticker.C:
+			if err := track.WriteSample(media.Sample{Data: frame, Duration: 20 * time.Millisecond}); err != nil {
+				t.Fatalf("write sample: %v", err)
+			}
+		case <-deadline:
+			t.Fatalf("no media over the relay (sender ICE %s, receiver ICE %s)",
+				sender.ICEConnectionState(), receiver.ICEConnectionState())
+		}
+	}
+
+	pair, err := rtpSender.Transport().ICETransport().GetSelectedCandidatePair()
+	if err != nil || pair == nil {
+		t.Fatalf("selected candidate pair: %v, %v", pair, err)
+	}
+	if pair.Local.Typ != webrtc.ICECandidateTypeRelay || pair.Remote.Typ != webrtc.ICECandidateTypeRelay {
+		t.Fatalf("selected pair %s -> %s, want relay on both ends", pair.Local.Typ, pair.Remote.Typ)
+	}
+}
+
+func TestTURNRejectsExpiredCredentials(t *testing.T) {
+	h := startTURNHub(t)
+	username, password := turnCredentials(h.turnSecret, "peer-a", time.Now().Add(-time.Minute))
+
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{
+		ICEServers: []webrtc.ICEServer{{
+			URLs:           h.turnURLs[:1],
+			Username:       username,
+			Credential:     password,
+			CredentialType: webrtc.ICECredentialTypePassword,
+		}},
+		ICETransportPolicy: webrtc.ICETransportPolicyRelay,
+	})
+	if err != nil {
+		t.Fatalf("new PeerConnection: %v", err)
+	}
+	defer pc.Close()
+
+	var relays atomic.Int32
+	pc.OnICECandidate(func(c *webrtc.ICECandidate) {
+		if c != nil && c.Typ == webrtc.ICECandidateTypeRelay {
+			relays.Add(1)
+		}
+	})
+	if _, err := pc.CreateDataChannel("probe", nil); err != nil {
+		t.Fatalf("create data channel: %v", err)
+	}
+	offer, err := pc.CreateOffer(nil)
+	if err != nil {
+		t.Fatalf("create offer: %v", err)
+	}
+	gathered := webrtc.GatheringCompletePromise(pc)
+	if err := pc.SetLocalDescription(offer); err != nil {
+		t.Fatalf("set offer: %v", err)
+	}
+	<-gathered
+	if n := relays.Load(); n != 0 {
+		t.Fatalf("got %d relay candidates with expired credentials", n)
+	}
+}
@@ -0,0 +1,264 @@
+package sfu
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+)
+
+// Video sources a peer can publish next to its microphone.
+const (
+	VideoSourceScreen = "screen"
+	VideoSourceCamera = "camera"
+)
+
+// videoSources lists the sources in the order they are reported to clients.
+var videoSources = []string{VideoSourceScreen, VideoSourceCamera}
+
+// keyframeInterval is the minimum gap between keyframe requests relayed to a
+// publisher. Every receiver that joins or loses packets asks on its own.
+const keyframeInterval = 500 * time.Millisecond
+
+// videoSource is one of a peer's video publications. The transceiver and
+// track belong to the current PeerConnection and are dropped with it.
+type videoSource struct {
+	publishing  bool
+	transceiver *webrtc.RTPTransceiver
+	track       *ForwardTrack
+}
+
+// forwardedTracks returns the tracks peer publishes to its channel: its
+// audio unless withAudio is false, then each video source it is publishing.
+func (p *Peer) forwardedTracks(withAudio bool) []*ForwardTrack {
+	p.RLock()
+	defer p.RUnlock()
+
+	tracks := make([]*ForwardTrack, 0, 1+len(p.video))
+	if withAudio && p.Track != nil {
+		tracks = append(tracks, p.Track)
+	}
+	for _, source := range videoSources {
+		if vs := p.video[source]; vs != nil && vs.publishing && vs.track != nil {
+			tracks = append(tracks, vs.track)
+		}
+	}
+	return tracks
+}
+
+// publishingLocked lists the video sources peer publishes. p.mu must be held.
+func (p *Peer) publishingLocked() []string {
+	var sources []string
+	for _, source := range videoSources {
+		if vs := p.video[source]; vs != nil && vs.publishing {
+			sources = append(sources, source)
+		}
+	}
+	return sources
+}
+
+// videoMidsLocked maps the mid of each negotiated video transceiver to its
+// source so the client knows where to attach its capture tracks. p.mu must
+// be held.
+func (p *Peer) videoMidsLocked() map[string]string {
+	var mids map[string]string
+	for source, vs := range p.video {
+		if vs.transceiver == nil || vs.transceiver.Mid() == "" {
+			continue
+		}
+		if mids == nil {
+			mids = make(map[string]string)
+		}
+		mids[vs.transceiver.Mid()] = source
+	}
+	return mids
+}
+
+// requestKeyframe relays a receiver's keyframe request to the publisher of a
+// video track, at most once per keyframeInterval. It reports whether a
+// request was sent.
+func (t *ForwardTrack) requestKeyframe() bool {
+	t.mu.Lock()
+	if t.keyframe == nil || time.Since(t.lastKeyframe) < keyframeInterval {
+		t.mu.Unlock()
+		return false
+	}
+	t.lastKeyframe = time.Now()
+	keyframe := t.keyframe
+	t.mu.Unlock()
+
+	keyframe()
+	return true
+}
+
+// HandlePublishVideo starts or stops forwarding peer's screen share or
+// camera. The first start adds a recvonly video transceiver and renegotiates;
+// the offer names its mid so the client can attach its capture track.
+// Stopping detaches the track from the channel but keeps the transceiver, so
+// a later share only needs the forwarded track re-attached.
+func (h *Hub) HandlePublishVideo(peer *Peer, source string, enabled bool) error {
+	if source != VideoSourceScreen && source != VideoSourceCamera {
+		return NewSignalError(ErrInvalidMessage, "Unknown video source")
+	}
+	if enabled && len(h.cfg.Codecs.Video) == 0 {
+		return NewSignalError(ErrVideoOff, "Video is not enabled on this server")
+	}
+	room := h.currentRoom(peer)
+	if room == nil {
+		return NewSignalError(ErrChannelNotFound, "Room not found")
+	}
+
+	peer.negoMu.Lock()
+	peer.Lock()
+	pc := peer.PC
+	if pc == nil {
+		peer.Unlock()
+		peer.negoMu.Unlock()
+		return NewSignalError(ErrInvalidMessage, "No media connection")
+	}
+	if peer.video == nil {
+		peer.video = make(map[string]*videoSource)
+	}
+	vs := peer.video[source]
+	if vs == nil {
+		vs = &videoSource{}
+		peer.video[source] = vs
+	}
+	if vs.publishing == enabled {
+		peer.Unlock()
+		peer.negoMu.Unlock()
+		return nil
+	}
+	vs.publishing = enabled
+	track := vs.track
+	needsTransceiver := enabled && vs.transceiver == nil
+	peer.Unlock()
+
+	if needsTransceiver {
+		transceiver, err := pc.AddTransceiverFromKind(webrtc.RTPCodecTypeVideo, webrtc.RTPTransceiverInit{
+			Direction: webrtc.RTPTransceiverDirectionRecvonly,
+		})
+		peer.Lock()
+		if err != nil {
+			vs.publishing = false
+		} else {
+			vs.transceiver = transceiver
+		}
+		peer.Unlock()
+		if err != nil {
+			peer.negoMu.Unlock()
+			return fmt.Errorf("add video transceiver: %w", err)
+		}
+	}
+	peer.negoMu.Unlock()
+
+	switch {
+	case needsTransceiver:
+		go func() {
+			if err := h.NegotiateOffer(peer, false); err != nil {
+				signalingLog.Warn("video publish offer failed", "peer_id", peer.ID, "source", source, "err", err)
+			}
+		}()
+	case !enabled && track != nil:
+		h.removeTracksFromRoomPeers(peer, room, []*ForwardTrack{track})
+	case enabled && track != nil:
+		h.AddTrackToPeers(peer, room)
+		track.requestKeyframe()
+	}
+
+	mediaLog.Info("video publishing changed", "peer_id", peer.ID, "room_id", room.ID, "source", source, "enabled", enabled)
+
+	peer.RLock()
+	mainRoomID := peer.MainRoomID
+	peer.RUnlock()
+
+	h.mu.RLock()
+	mainRoom, ok := h.Rooms[mainRoomID]
+	h.mu.RUnlock()
+
+	if ok {
+		h.broadcastRoomUpdate(mainRoom)
+	}
+	return nil
+}
+
+// forwardVideo handles a video track published by peer: it creates the
+// forwarded copy, attaches it to the channel while the source is published
+// and relays receivers' keyframe requests to the publisher as PLI.
+func (h *Hub) forwardVideo(peer *Peer, pc *webrtc.PeerConnection, remoteTrack *webrtc.TrackRemote, receiver *webrtc.RTPReceiver, metricsRoomID string) {
+	peer.RLock()
+	var source string
+	var vs *videoSource
+	for s, v := range peer.video {
+		if v.transceiver != nil && v.transceiver.Receiver() == receiver {
+			source, vs = s, v
+		}
+	}
+	peer.RUnlock()
+	if vs == nil {
+		mediaLog.Warn("video track without publication", "peer_id", peer.ID, "codec", remoteTrack.Codec().MimeType)
+		return
+	}
+
+	ssrc := uint32(remoteTrack.SSRC())
+	track := NewForwardTrack(
+		remoteTrack.Codec().RTPCodecCapability,
+		fmt.Sprintf("video-%s-%s", source, peer.ID),
+		fmt.Sprintf("%s-%s", source, peer.ID),
+	)
+	track.keyframe = func() {
+		if err := pc.WriteRTCP([]rtcp.Packet{&rtcp.PictureLossIndication{MediaSSRC: ssrc}}); err != nil {
+			mediaLog.Debug("keyframe request failed", "peer_id", peer.ID, "source", source, "err", err)
+			return
+		}
+		h.metrics.keyframeRequests.Inc()
+	}
+
+	peer.Lock()
+	vs.track = track
+	publishing := vs.publishing
+	peer.Unlock()
+
+	if publishing {
+		if room := h.currentRoom(peer); room != nil {
+			h.AddTrackToPeers(peer, room)
+		}
+	}
+
+	extURIs := headerExtensionURIs(receiver)
+	go func() {
+		buf := make([]byte, 1500)
+		pkt := &rtp.Packet{}
+		rxCounter := h.metrics.rtpReceived.WithLabelValues(metricsRoomID)
+		forwardedCounter := h.metrics.rtpForwarded.WithLabelValues(metricsRoomID)
+		forwardErrorCounter := h.metrics.rtpForwardError.WithLabelValues(metricsRoomID)
+		for {
+			n, _, err := remoteTrack.Read(buf)
+			if err != nil {
+				return
+			}
+			rxCounter.Inc()
+
+			if err := pkt.Unmarshal(buf[:n]); err != nil {
+				mediaLog.Debug("unmarshal video packet failed", "peer_id", peer.ID, "err", err)
+				continue
+			}
+
+			peer.RLock()
+			publishing := vs.publishing
+			peer.RUnlock()
+			if !publishing {
+				continue
+			}
+
+			if err := track.WriteRTP(pkt, extURIs); err != nil {
+				mediaLog.Debug("video forward failed", "peer_id", peer.ID, "source", source, "err", err)
+				forwardErrorCounter.Inc()
+			} else {
+				forwardedCounter.Inc()
+			}
+		}
+	}()
+}
@@ -2,42 +2,37 @@ package sfu
 
 import (
 	"fmt"
-	"log"
 	"net"
 	"os"
-	"strconv"
 	"strings"
 	"time"
 
+	"github.com/pion/ice/v2"
+	"github.com/pion/interceptor"
+	"github.com/pion/interceptor/pkg/stats"
 	"github.com/pion/rtp"
 	"github.com/pion/webrtc/v3"
 )
 
+// WebRTCConfig selects how ICE binds UDP. With UDPMuxPort set, every
+// PeerConnection shares one UDP socket; otherwise each gets an ephemeral port
+// from UDPMin..UDPMax. TCPMuxPort additionally enables ICE-TCP passive
+// candidates on one shared TCP port.
 type WebRTCConfig struct {
-	PublicIP string
-	UDPMin   uint16
-	UDPMax   uint16
+	PublicIP   string
+	UDPMin     uint16
+	UDPMax     uint16
+	UDPMuxPort uint16
+	TCPMuxPort uint16
 }
 
-func loadWebRTCConfig() WebRTCConfig {
-	udpMin := getEnvUint16("UDP_MIN", 40000)
-	udpMax := getEnvUint16("UDP_MAX", 40100)
-	publicIP := resolvePublicIP(os.Getenv("PUBLIC_IP"))
+func loadWebRTCConfig(publicIPSource string) WebRTCConfig {
 	return WebRTCConfig{
-		PublicIP: publicIP,
-		UDPMin:   udpMin,
-		UDPMax:   udpMax,
-	}
-}
-
-func loadWebRTCConfigQuiet() WebRTCConfig {
-	udpMin := getEnvUint16("UDP_MIN", 40000)
-	udpMax := getEnvUint16("UDP_MAX", 40100)
-	publicIP := resolvePublicIPQuiet(os.Getenv("PUBLIC_IP"))
-	return WebRTCConfig{
-		PublicIP: publicIP,
-		UDPMin:   udpMin,
-		UDPMax:   udpMax,
+		PublicIP:   resolvePublicIP(publicIPSource),
+		UDPMin:     getEnvUint16("UDP_MIN", 40000),
+		UDPMax:     getEnvUint16("UDP_MAX", 40100),
+		UDPMuxPort: getEnvUint16("UDP_MUX_PORT", 0),
+		TCPMuxPort: getEnvUint16("ICE_TCP_PORT", 0),
 	}
 }
 
@@ -55,14 +50,14 @@ func resolvePublicIPInternal(raw string, verbose bool) string {
 	}
 	if ip := net.ParseIP(raw); ip != nil {
 		if verbose {
-			log.Printf("PUBLIC_IP: using %s", raw)
+			hubLog.Info("PUBLIC_IP: using configured IP", "public_ip", raw)
 		}
 		return raw
 	}
 	ips, err := net.LookupIP(raw)
 	if err != nil || len(ips) == 0 {
 		if verbose {
-			log.Printf("WARNING: PUBLIC_IP=%q is not a valid IP and could not be resolved — NAT1To1 disabled", raw)
+			hubLog.Warn("PUBLIC_IP is not a valid IP and could not be resolved, NAT1To1 disabled", "public_ip", raw)
 		}
 		return ""
 	}
@@ -73,7 +68,7 @@ func resolvePublicIPInternal(raw string, verbose bool) string {
 		if ipv4 := ip.To4(); ipv4 != nil {
 			resolved := ipv4.String()
 			if verbose {
-				log.Printf("PUBLIC_IP: resolved %s → %s (preferred IPv4)", raw, resolved)
+				hubLog.Info("PUBLIC_IP: resolved (preferred IPv4)", "host", raw, "public_ip", resolved)
 			}
 			return resolved
 		}
@@ -81,105 +76,102 @@ func resolvePublicIPInternal(raw string, verbose bool) string {
 
 	resolved := ips[0].String()
 	if verbose {
-		log.Printf("PUBLIC_IP: resolved %s → %s", raw, resolved)
+		hubLog.Info("PUBLIC_IP: resolved", "host", raw, "public_ip", resolved)
 	}
 	return resolved
 }
 
-func getEnvUint16(key string, defaultVal uint16) uint16 {
-	val := os.Getenv(key)
-	if val == "" {
-		return defaultVal
-	}
-	n, err := strconv.Atoi(val)
-	if err != nil || n < 0 || n > 65535 {
-		return defaultVal
-	}
-	return uint16(n)
-}
-
-func getEnvDuration(key string, defaultVal time.Duration) time.Duration {
-	val := strings.TrimSpace(os.Getenv(key))
-	if val == "" {
-		return defaultVal
-	}
-
-	if d, err := time.ParseDuration(val); err == nil {
-		return d
-	}
-
-	if n, err := strconv.Atoi(val); err == nil && n >= 0 {
-		return time.Duration(n) * time.Second
-	}
-
-	return defaultVal
-}
-
-func getEnvBool(key string, defaultVal bool) bool {
-	val := strings.TrimSpace(strings.ToLower(os.Getenv(key)))
-	if val == "" {
-		return defaultVal
-	}
-	switch val {
-	case "1", "true", "yes", "on":
-		return true
-	case "0", "false", "no", "off":
-		return false
-	default:
-		return defaultVal
-	}
-}
-
-func NewWebRTCAPI() (*webrtc.API, WebRTCConfig) {
-	cfg := loadWebRTCConfig()
-	return buildWebRTCAPI(cfg), cfg
-}
-
-func buildWebRTCAPI(cfg WebRTCConfig) *webrtc.API {
+func buildWebRTCAPI(cfg WebRTCConfig, codecs CodecConfig, red bool, audioProfile string, udpMux ice.UDPMux, tcpMux ice.TCPMux, onStats stats.NewPeerConnectionCallback) *webrtc.API {
 	se := webrtc.SettingEngine{}
-	se.SetEphemeralUDPPortRange(cfg.UDPMin, cfg.UDPMax)
+	if udpMux != nil {
+		se.SetICEUDPMux(udpMux)
+	} else {
+		se.SetEphemeralUDPPortRange(cfg.UDPMin, cfg.UDPMax)
+	}
+	if tcpMux != nil {
+		se.SetICETCPMux(tcpMux)
+		se.SetNetworkTypes([]webrtc.NetworkType{
+			webrtc.NetworkTypeUDP4,
+			webrtc.NetworkTypeUDP6,
+			webrtc.NetworkTypeTCP4,
+			webrtc.NetworkTypeTCP6,
+		})
+	}
 
 	if cfg.PublicIP != "" {
 		se.SetNAT1To1IPs([]string{cfg.PublicIP}, webrtc.ICECandidateTypeHost)
 	}
 
 	me := &webrtc.MediaEngine{}
-	if err := me.RegisterDefaultCodecs(); err != nil {
-		log.Fatalf("failed to register codecs: %v", err)
+	if err := registerCodecs(me, codecs, audioProfile, red); err != nil {
+		mediaLog.Error("register codecs failed", "err", err)
+		os.Exit(1)
+	}
+	// Clients attach their microphone level to each packet so the server can
+	// detect active speakers without decoding audio; ForwardTrack passes it
+	// and abs-send-time on to receivers.
+	for _, uri := range forwardedHeaderExtensions {
+		if err := me.RegisterHeaderExtension(webrtc.RTPHeaderExtensionCapability{URI: uri}, webrtc.RTPCodecTypeAudio); err != nil {
+			mediaLog.Error("register header extension failed", "uri", uri, "err", err)
+			os.Exit(1)
+		}
+	}
+
+	// Default interceptors add NACK generation and retransmission, sender and
+	// receiver reports and TWCC feedback. Pion only enables NACK for video, so
+	// it is negotiated for Opus explicitly; the stats interceptor collects
+	// per-stream RTT, jitter and loss for PeerQuality.
+	ir := &interceptor.Registry{}
+	if err := webrtc.RegisterDefaultInterceptors(me, ir); err != nil {
+		mediaLog.Error("register interceptors failed", "err", err)
+		os.Exit(1)
+	}
+	me.RegisterFeedback(webrtc.RTCPFeedback{Type: "nack"}, webrtc.RTPCodecTypeAudio)
+	statsFactory, err := stats.NewInterceptor()
+	if err != nil {
+		mediaLog.Error("create stats interceptor failed", "err", err)
+		os.Exit(1)
 	}
+	statsFactory.OnNewPeerConnection(onStats)
+	ir.Add(statsFactory)
 
 	api := webrtc.NewAPI(
 		webrtc.WithSettingEngine(se),
 		webrtc.WithMediaEngine(me),
+		webrtc.WithInterceptorRegistry(ir),
 	)
 
 	return api
 }
 
 func (h *Hub) CreatePeerConnection(peer *Peer, room *Room) error {
-	api := h.getWebRTCAPI()
-	_ = room
+	api := h.getWebRTCAPI(room.AudioProfile)
+
+	// Per-room media counters are keyed by the main room so sub-channel
+	// traffic is attributed to the room that owns it.
+	metricsRoomID := room.ID
+	if room.ParentID != "" {
+		metricsRoomID = room.ParentID
+	}
 
 	config := webrtc.Configuration{
-		ICEServers: []webrtc.ICEServer{
-			{URLs: []string{"stun:stun.l.google.com:19302"}},
-		},
+		ICEServers: toWebRTCICEServers(h.ICEServers(peer.ID)),
 	}
 
+	h.pcCreateMu.Lock()
 	pc, err := api.NewPeerConnection(config)
+	statsGetter := h.pendingStats
+	h.pendingStats = nil
+	h.pcCreateMu.Unlock()
 	if err != nil {
 		return fmt.Errorf("create peer connection: %w", err)
 	}
 
-	track, err := webrtc.NewTrackLocalStaticRTP(
+	track := NewForwardTrack(
 		webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus},
 		fmt.Sprintf("audio-%s", peer.ID),
 		fmt.Sprintf("stream-%s", peer.ID),
 	)
-	if err != nil {
-		pc.Close()
-		return fmt.Errorf("create track: %w", err)
-	}
 
 	peer.negoMu.Lock()
 	peer.Lock()
@@ -189,6 +181,8 @@ func (h *Hub) CreatePeerConnection(peer *Peer, room *Room) error {
 	}
 	peer.PC = pc
 	peer.Track = track
+	peer.video = nil
+	peer.stats = statsGetter
 	peer.Epoch++
 	peer.OfferSeq = 0
 	peer.pendingRenego = false
@@ -196,51 +190,189 @@ func (h *Hub) CreatePeerConnection(peer *Peer, room *Room) error {
 	peer.Unlock()
 	peer.negoMu.Unlock()
 
-	pc.OnTrack(func(remoteTrack *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
-		log.Printf("peer %s: OnTrack, codec=%s", peer.ID, remoteTrack.Codec().MimeType)
+	pc.OnTrack(func(remoteTrack *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) {
+		mediaLog.Info("remote track", "peer_id", peer.ID, "room_id", room.ID, "codec", remoteTrack.Codec().MimeType)
+
+		readReceiverRTCP(receiver)
+
+		if remoteTrack.Kind() == webrtc.RTPCodecTypeVideo {
+			h.forwardVideo(peer, pc, remoteTrack, receiver, metricsRoomID)
+			return
+		}
+
+		extURIs := headerExtensionURIs(receiver)
+		redPT := redPayloadTypeFor(receiver.GetParameters().Codecs, opusPayloadType)
+		speech := newSpeechDetector(h.cfg.Speaking, extURIs)
+		if speech == nil {
+			mediaLog.Debug("audio level extension not negotiated, speaker detection disabled", "peer_id", peer.ID)
+		}
 
 		go func() {
+			// The PeerConnection outlives channel moves, so speaking state
+			// follows the peer's current room rather than the one it was
+			// created in.
+			speakingRoom := room
+			lastRoomID := room.ID
+			defer func() {
+				if speech != nil && speech.speaking {
+					h.setSpeaking(speakingRoom, peer.ID, false)
+				}
+			}()
+
 			buf := make([]byte, 1500)
 			rtpPkt := &rtp.Packet{}
 			lastStatsLog := time.Now()
 			var rxPackets uint64
 			var forwardedPackets uint64
 			var forwardErrors uint64
+			// Packets dropped while muted are cut out of the sequence number
+			// space so receivers don't see them as loss and NACK them.
+			var seqOffset uint16
+			rxCounter := h.metrics.rtpReceived.WithLabelValues(metricsRoomID)
+			forwardedCounter := h.metrics.rtpForwarded.WithLabelValues(metricsRoomID)
+			forwardErrorCounter := h.metrics.rtpForwardError.WithLabelValues(metricsRoomID)
+			mutedDropCounter := h.metrics.rtpMutedDropped.WithLabelValues(metricsRoomID)
 			for {
 				n, _, err := remoteTrack.Read(buf)
 				if err != nil {
 					return
 				}
 				rxPackets++
+				rxCounter.Inc()
 
 				if err := rtpPkt.Unmarshal(buf[:n]); err != nil {
-					log.Printf("peer %s: failed to unmarshal RTP packet: %v", peer.ID, err)
+					mediaLog.Debug("unmarshal RTP packet failed", "peer_id", peer.ID, "err", err)
 					continue
 				}
-
-				// Cross-browser peers may negotiate different RTP header extension IDs
-				// (e.g. Firefox vs Chrome). Forwarding extensions untouched can break
-				// decode on receivers, so strip them before re-writing.
-				rtpPkt.Extension = false
-				rtpPkt.Extensions = nil
+				// Forwarded tracks, speaker detection and recordings work on
+				// plain Opus; RED is added back per listener on the way out.
+				if redPT != 0 && rtpPkt.PayloadType == uint8(redPT) {
+					primary, err := redPrimary(rtpPkt.Payload)
+					if err != nil {
+						mediaLog.Debug("unwrap RED packet failed", "peer_id", peer.ID, "err", err)
+						continue
+					}
+					rtpPkt.Payload = primary
+					rtpPkt.PayloadType = opusPayloadType
+				}
+				now := h.clock.Now()
 
 				peer.RLock()
 				t := peer.Track
+				muted := peer.Muted || peer.ForceMuted
+				roomID := peer.RoomID
+				whisperTo := peer.whisperTo
+				announcing := peer.announcing
 				peer.RUnlock()
-				if t != nil {
-					if err := t.WriteRTP(rtpPkt); err != nil {
-						// TrackLocalStaticRTP may return aggregated write errors for one
-						// binding while still delivering to others. Don't stop forwarding.
-						log.Printf("peer %s: forward write error: %v", peer.ID, err)
+
+				if roomID != lastRoomID {
+					lastRoomID = roomID
+					if r := h.currentRoom(peer); r != nil {
+						if speech != nil && speech.speaking {
+							h.setSpeaking(speakingRoom, peer.ID, false)
+							h.setSpeaking(r, peer.ID, true)
+						}
+						speakingRoom = r
+					}
+				}
+
+				// In push-to-talk channels audio is only forwarded while the
+				// peer holds talk. The gate comes before the whisper dispatch,
+				// so whispering needs talk as well and cannot get around floor
+				// control; only an all-call, which the owner runs, is exempt.
+				if !muted && !announcing && !speakingRoom.mayTalk(peer.ID) {
+					muted = true
+				}
+
+				// A whisper goes to its recipients only; the channel, speaker
+				// detection and recordings treat the peer as silent.
+				whispering := !muted && len(whisperTo) > 0
+				if whispering {
+					if err := forwardWhisper(peer.ID, whisperTo, rtpPkt, extURIs, now); err != nil {
+						mediaLog.Debug("whisper forward failed", "peer_id", peer.ID, "err", err)
+						forwardErrors++
+						forwardErrorCounter.Inc()
+					} else {
+						forwardedPackets++
+						forwardedCounter.Inc()
+					}
+				}
+
+				silent := muted || whispering
+
+				if speech != nil && speech.observe(rtpPkt, silent, now) {
+					h.setSpeaking(speakingRoom, peer.ID, speech.speaking)
+				}
+
+				// In last-N rooms only slot holders are forwarded, on the
+				// slot tracks of each listener instead of the peer's own.
+				// An all-call goes out on the peer's own track everywhere.
+				sel := speakingRoom.selector()
+				if announcing {
+					sel = nil
+				}
+				slot := -1
+				if sel != nil {
+					var changed bool
+					slot, changed = sel.observe(peer.ID, speech, now)
+					if changed {
+						h.broadcastLastN(speakingRoom)
+					}
+				}
+
+				// Mute is enforced here, on the server, so a client is not
+				// heard even if it keeps sending audio. Muted is the peer's
+				// own mute, which it sets and clears with "mute"; ForceMuted
+				// is imposed by a channel owner or the admin API and only they
+				// can clear it, so unmuting itself does not make a force-muted
+				// peer audible. Either one drops the packet like a whisper
+				// does, and every dropped packet advances seqOffset so
+				// receivers see no sequence gap once forwarding resumes.
+				if silent {
+					seqOffset++
+					if muted {
+						mutedDropCounter.Inc()
+					}
+				} else if sel != nil {
+					if slot >= 0 {
+						rtpPkt.SequenceNumber -= seqOffset
+						if err := h.forwardLastN(speakingRoom, peer.ID, slot, rtpPkt, extURIs, now); err != nil {
+							mediaLog.Debug("last-N forward failed", "peer_id", peer.ID, "slot", slot, "err", err)
+							forwardErrors++
+							forwardErrorCounter.Inc()
+						} else {
+							forwardedPackets++
+							forwardedCounter.Inc()
+						}
+					}
+				} else if t != nil {
+					rtpPkt.SequenceNumber -= seqOffset
+					// Cross-browser peers may negotiate different RTP header extension IDs
+					// (e.g. Firefox vs Chrome), so the track rewrites them per receiver.
+					if err := t.WriteRTP(rtpPkt, extURIs); err != nil {
+						// ForwardTrack returns joined write errors for failed bindings
+						// while still delivering to others. Don't stop forwarding.
+						mediaLog.Debug("forward write failed", "peer_id", peer.ID, "err", err)
 						forwardErrors++
+						forwardErrorCounter.Inc()
 					} else {
 						forwardedPackets++
+						forwardedCounter.Inc()
+					}
+				}
+
+				if rec := speakingRoom.activeRecording(); rec != nil && !silent {
+					if err := rec.writeRTP(peer, rtpPkt, now); err != nil {
+						mediaLog.Warn("recording write failed", "peer_id", peer.ID, "recording_id", rec.ID(), "err", err)
 					}
 				}
 
 				if time.Since(lastStatsLog) >= 5*time.Second {
-					log.Printf("peer %s: RTP stats rx=%d forwarded=%d forwardErrors=%d",
-						peer.ID, rxPackets, forwardedPackets, forwardErrors)
+					q, _ := h.PeerQuality(peer)
+					mediaLog.Debug("RTP stats", "peer_id", peer.ID, "room_id", roomID,
+						"rx", rxPackets, "forwarded", forwardedPackets, "forward_errors", forwardErrors,
+						"rtt", q.RTT, "uplink_jitter", q.UplinkJitter, "uplink_loss", q.UplinkLoss,
+						"downlink_jitter", q.DownlinkJitter, "downlink_loss", q.DownlinkLoss)
 					lastStatsLog = time.Now()
 				}
 			}
@@ -266,12 +398,25 @@ func (h *Hub) CreatePeerConnection(peer *Peer, room *Room) error {
 	})
 
 	pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
-		log.Printf("peer %s: connection state: %s", peer.ID, state.String())
+		peer.RLock()
+		roomID := peer.RoomID
+		peer.RUnlock()
+		mediaLog.Info("connection state", "peer_id", peer.ID, "room_id", roomID, "state", state.String())
 		switch state {
 		case webrtc.PeerConnectionStateConnected:
 			peer.Lock()
 			peer.iceRestartQueued = false
+			joinedAt := peer.joinedAt
+			peer.joinedAt = time.Time{}
 			peer.Unlock()
+			if !joinedAt.IsZero() {
+				h.metrics.joinToConnected.Observe(h.clock.Now().Sub(joinedAt).Seconds())
+			}
+			if sp, ok := selectedCandidatePair(pc); ok {
+				mediaLog.Info("selected candidate pair", "peer_id", peer.ID, "room_id", roomID,
+					"protocol", sp.Protocol, "local_type", sp.LocalType, "remote_type", sp.RemoteType)
+				h.metrics.selectedPairs.WithLabelValues(sp.Protocol, sp.RemoteType).Inc()
+			}
 		case webrtc.PeerConnectionStateDisconnected:
 			h.queueICERestart(peer, 3*time.Second)
 		case webrtc.PeerConnectionStateFailed:
@@ -296,12 +441,17 @@ func (h *Hub) queueICERestart(peer *Peer, delay time.Duration) {
 		return
 	}
 
-	time.AfterFunc(delay, func() {
+	h.clock.AfterFunc(delay, func() {
 		h.attemptICERestart(peer)
 	})
 }
 
 func (h *Hub) attemptICERestart(peer *Peer) {
+	if !h.beginNegotiation() {
+		return
+	}
+	defer h.negotiations.Done()
+
 	peer.negoMu.Lock()
 
 	peer.RLock()
@@ -325,11 +475,11 @@ func (h *Hub) attemptICERestart(peer *Peer) {
 		return
 	}
 
-	log.Printf("peer %s: attempting ICE restart, connectionState=%s", peer.ID, state.String())
+	signalingLog.Info("attempting ICE restart", "peer_id", peer.ID, "state", state.String())
 
 	offer, err := pc.CreateOffer(&webrtc.OfferOptions{ICERestart: true})
 	if err != nil {
-		log.Printf("peer %s: ICE restart offer failed: %v", peer.ID, err)
+		signalingLog.Warn("ICE restart offer failed", "peer_id", peer.ID, "err", err)
 		peer.Lock()
 		peer.iceRestartQueued = false
 		peer.Unlock()
@@ -337,7 +487,7 @@ func (h *Hub) attemptICERestart(peer *Peer) {
 		return
 	}
 	if err := pc.SetLocalDescription(offer); err != nil {
-		log.Printf("peer %s: ICE restart set local description failed: %v", peer.ID, err)
+		signalingLog.Warn("ICE restart set local description failed", "peer_id", peer.ID, "err", err)
 		peer.Lock()
 		peer.iceRestartQueued = false
 		peer.Unlock()
@@ -363,21 +513,41 @@ func (h *Hub) attemptICERestart(peer *Peer) {
 		Seq:   seq,
 		Epoch: epoch,
 	})
+	h.metrics.iceRestarts.Inc()
 
 	peer.negoMu.Unlock()
 
 	select {
 	case <-sr:
-		log.Printf("peer %s: ICE restart completed", peer.ID)
+		signalingLog.Info("ICE restart completed", "peer_id", peer.ID, "epoch", epoch, "seq", seq)
 	case <-time.After(10 * time.Second):
-		log.Printf("peer %s: ICE restart answer timeout", peer.ID)
+		signalingLog.Warn("ICE restart answer timeout", "peer_id", peer.ID, "epoch", epoch, "seq", seq)
+		h.metrics.answerTimeouts.Inc()
 	}
 }
 
 func (h *Hub) NegotiateOffer(peer *Peer, isInitial bool) error {
+	if !h.beginNegotiation() {
+		return errHubDraining
+	}
+	defer h.negotiations.Done()
+
 	return h.negotiateOffer(peer, isInitial)
 }
 
+// beginNegotiation registers an in-flight negotiation so Shutdown can wait
+// for it. It refuses new work once the hub has started draining.
+func (h *Hub) beginNegotiation() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.draining {
+		return false
+	}
+	h.negotiations.Add(1)
+	return true
+}
+
 func (h *Hub) negotiateOffer(peer *Peer, isInitial bool) error {
 	for {
 		peer.negoMu.Lock()
@@ -403,7 +573,7 @@ func (h *Hub) negotiateOffer(peer *Peer, isInitial bool) error {
 		}
 
 		if pc.SignalingState() != webrtc.SignalingStateStable {
-			log.Printf("peer %s: deferring renegotiation, signaling state is %s", peer.ID, pc.SignalingState().String())
+			signalingLog.Debug("deferring renegotiation", "peer_id", peer.ID, "epoch", epoch, "signaling_state", pc.SignalingState().String())
 			peer.Lock()
 			peer.pendingRenego = true
 			peer.Unlock()
@@ -432,13 +602,18 @@ func (h *Hub) negotiateOffer(peer *Peer, isInitial bool) error {
 			return fmt.Errorf("set local description: %w", err)
 		}
 
-		log.Printf("peer %s: offer seq=%d epoch=%d initial=%t signalingState=%s transceivers=%s",
-			peer.ID, seq, epoch, seq == 1, pc.SignalingState().String(), summarizeTransceivers(pc))
+		peer.RLock()
+		videoMids := peer.videoMidsLocked()
+		peer.RUnlock()
+
+		signalingLog.Debug("offer", "peer_id", peer.ID, "epoch", epoch, "seq", seq, "initial", seq == 1,
+			"signaling_state", pc.SignalingState().String(), "transceivers", summarizeTransceivers(pc))
 		peer.SendJSON("offer", OfferPayload{
 			SDP:   offer.SDP,
 			Reset: seq == 1,
 			Seq:   seq,
 			Epoch: epoch,
+			Video: videoMids,
 		})
 
 		peer.negoMu.Unlock()
@@ -446,7 +621,8 @@ func (h *Hub) negotiateOffer(peer *Peer, isInitial bool) error {
 		select {
 		case <-sr:
 		case <-time.After(10 * time.Second):
-			log.Printf("peer %s: answer timeout seq=%d epoch=%d", peer.ID, seq, epoch)
+			signalingLog.Warn("answer timeout", "peer_id", peer.ID, "epoch", epoch, "seq", seq)
+			h.metrics.answerTimeouts.Inc()
 			return nil
 		}
 
@@ -458,7 +634,7 @@ func (h *Hub) negotiateOffer(peer *Peer, isInitial bool) error {
 		if !needsRenego {
 			return nil
 		}
-		log.Printf("peer %s: processing deferred renegotiation", peer.ID)
+		signalingLog.Debug("processing deferred renegotiation", "peer_id", peer.ID, "epoch", epoch)
 	}
 }
 
@@ -473,11 +649,11 @@ func (h *Hub) HandleAnswer(peer *Peer, sdp string, seq uint64, epoch uint64) err
 		return fmt.Errorf("no peer connection")
 	}
 	if epoch != currentEpoch {
-		log.Printf("peer %s: discarding stale answer epoch=%d (current=%d)", peer.ID, epoch, currentEpoch)
+		signalingLog.Debug("discarding stale answer", "peer_id", peer.ID, "epoch", epoch, "seq", seq, "current_epoch", currentEpoch)
 		return nil
 	}
 	if seq != currentSeq {
-		log.Printf("peer %s: discarding stale answer seq=%d (current=%d)", peer.ID, seq, currentSeq)
+		signalingLog.Debug("discarding stale answer", "peer_id", peer.ID, "epoch", epoch, "seq", seq, "current_seq", currentSeq)
 		return nil
 	}
 
@@ -486,8 +662,8 @@ func (h *Hub) HandleAnswer(peer *Peer, sdp string, seq uint64, epoch uint64) err
 		return fmt.Errorf("set remote description: %w", err)
 	}
 
-	log.Printf("peer %s: answer received seq=%d epoch=%d transceivers=%s",
-		peer.ID, seq, epoch, summarizeTransceivers(pc))
+	signalingLog.Debug("answer received", "peer_id", peer.ID, "epoch", epoch, "seq", seq,
+		"transceivers", summarizeTransceivers(pc))
 
 	peer.Lock()
 	if peer.signalingReady != nil {
@@ -510,15 +686,15 @@ func (h *Hub) HandleICECandidate(peer *Peer, candidate string, sdpMid string, sd
 		return fmt.Errorf("no peer connection")
 	}
 	if epoch != currentEpoch {
-		log.Printf("peer %s: discarding stale ICE candidate epoch=%d (current=%d)", peer.ID, epoch, currentEpoch)
+		signalingLog.Debug("discarding stale ICE candidate", "peer_id", peer.ID, "epoch", epoch, "seq", seq, "current_epoch", currentEpoch)
 		return nil
 	}
 	if seq > currentSeq {
-		log.Printf("peer %s: discarding future ICE candidate seq=%d (current=%d)", peer.ID, seq, currentSeq)
+		signalingLog.Debug("discarding future ICE candidate", "peer_id", peer.ID, "epoch", epoch, "seq", seq, "current_seq", currentSeq)
 		return nil
 	}
 	if seq < currentSeq {
-		log.Printf("peer %s: accepting late ICE candidate seq=%d (current=%d)", peer.ID, seq, currentSeq)
+		signalingLog.Debug("accepting late ICE candidate", "peer_id", peer.ID, "epoch", epoch, "seq", seq, "current_seq", currentSeq)
 	}
 
 	var sdpMLineIndexUint16 *uint16
@@ -546,12 +722,20 @@ func (h *Hub) HandleICECandidate(peer *Peer, candidate string, sdpMid string, sd
 }
 
 func (h *Hub) AddTrackToPeers(newPeer *Peer, room *Room) {
+	// Last-N rooms reach listeners through their slot tracks, so only video
+	// is attached directly.
+	tracks := newPeer.forwardedTracks(room.selector() == nil)
+	if len(tracks) == 0 {
+		return
+	}
+
+	// Peers listening in from another channel only get the audio.
 	newPeer.RLock()
-	track := newPeer.Track
+	audio := newPeer.Track
 	newPeer.RUnlock()
-
-	if track == nil {
-		return
+	var listenTracks []*ForwardTrack
+	if audio != nil && room.selector() == nil {
+		listenTracks = []*ForwardTrack{audio}
 	}
 
 	room.mu.RLock()
@@ -561,6 +745,13 @@ func (h *Hub) AddTrackToPeers(newPeer *Peer, room *Room) {
 			peers = append(peers, p)
 		}
 	}
+	listeners := make(map[*Peer]bool, len(room.listeners))
+	for _, p := range room.listeners {
+		if p.ID != newPeer.ID {
+			peers = append(peers, p)
+			listeners[p] = true
+		}
+	}
 	room.mu.RUnlock()
 
 	needsRenego := make([]*Peer, 0, len(peers))
@@ -572,29 +763,40 @@ func (h *Hub) AddTrackToPeers(newPeer *Peer, room *Room) {
 		if pc == nil {
 			continue
 		}
-		if hasSenderForTrack(pc, track) {
-			continue
-		}
 
-		transceiver, err := pc.AddTransceiverFromTrack(track, webrtc.RTPTransceiverInit{
-			Direction: webrtc.RTPTransceiverDirectionSendonly,
-		})
-		if err != nil {
-			log.Printf("failed to add track from %s to %s: %v", newPeer.ID, p.ID, err)
-			continue
+		targetTracks := tracks
+		if listeners[p] {
+			targetTracks = listenTracks
 		}
-		if transceiver != nil && transceiver.Sender() != nil {
-			h.drainSenderRTCP(transceiver.Sender())
+		attached := false
+		for _, track := range targetTracks {
+			if hasSenderForTrack(pc, track) {
+				continue
+			}
+
+			transceiver, err := pc.AddTransceiverFromTrack(track, webrtc.RTPTransceiverInit{
+				Direction: webrtc.RTPTransceiverDirectionSendonly,
+			})
+			if err != nil {
+				mediaLog.Warn("add track failed", "peer_id", p.ID, "source_peer_id", newPeer.ID, "room_id", room.ID, "track_id", track.ID(), "err", err)
+				continue
+			}
+			if transceiver != nil && transceiver.Sender() != nil {
+				h.readSenderRTCP(transceiver.Sender())
+			}
+			mediaLog.Debug("attached outbound track", "peer_id", p.ID, "source_peer_id", newPeer.ID, "room_id", room.ID, "track_id", track.ID())
+			attached = true
 		}
-		log.Printf("peer %s: attached outbound track from %s", p.ID, newPeer.ID)
 
-		needsRenego = append(needsRenego, p)
+		if attached {
+			needsRenego = append(needsRenego, p)
+		}
 	}
 
 	for _, p := range needsRenego {
 		go func(target *Peer) {
 			if err := h.NegotiateOffer(target, false); err != nil {
-				log.Printf("failed to renegotiate with %s: %v", target.ID, err)
+				signalingLog.Warn("renegotiation failed", "peer_id", target.ID, "err", err)
 			}
 		}(p)
 	}
@@ -612,6 +814,14 @@ func (h *Hub) AddRoomTracksToPeer(targetPeer *Peer, room *Room) bool {
 		return false
 	}
 
+	// In last-N rooms audio arrives on the peer's slot tracks; video is
+	// still forwarded per publisher.
+	sel := room.selector()
+	addedAny := false
+	if sel != nil {
+		addedAny = h.addSlotTracksToPeer(targetPeer, room, sel)
+	}
+
 	room.mu.RLock()
 	peers := make([]*Peer, 0, len(room.Peers))
 	for _, p := range room.Peers {
@@ -621,54 +831,82 @@ func (h *Hub) AddRoomTracksToPeer(targetPeer *Peer, room *Room) bool {
 	}
 	room.mu.RUnlock()
 
-	addedAny := false
 	addedCount := 0
 	for _, p := range peers {
-		p.RLock()
-		track := p.Track
-		p.RUnlock()
-		if track == nil {
-			continue
-		}
-		if hasSenderForTrack(targetPC, track) {
-			continue
-		}
+		for _, track := range p.forwardedTracks(sel == nil) {
+			if hasSenderForTrack(targetPC, track) {
+				continue
+			}
 
-		transceiver, err := targetPC.AddTransceiverFromTrack(track, webrtc.RTPTransceiverInit{
-			Direction: webrtc.RTPTransceiverDirectionSendonly,
-		})
-		if err != nil {
-			log.Printf("failed to add room track from %s to %s: %v", p.ID, targetPeerID, err)
-			continue
-		}
-		if transceiver != nil && transceiver.Sender() != nil {
-			h.drainSenderRTCP(transceiver.Sender())
+			transceiver, err := targetPC.AddTransceiverFromTrack(track, webrtc.RTPTransceiverInit{
+				Direction: webrtc.RTPTransceiverDirectionSendonly,
+			})
+			if err != nil {
+				mediaLog.Warn("add room track failed", "peer_id", targetPeerID, "source_peer_id", p.ID, "room_id", room.ID, "track_id", track.ID(), "err", err)
+				continue
+			}
+			if transceiver != nil && transceiver.Sender() != nil {
+				h.readSenderRTCP(transceiver.Sender())
+			}
+			addedAny = true
+			addedCount++
+			mediaLog.Debug("attached existing track", "peer_id", targetPeerID, "source_peer_id", p.ID, "room_id", room.ID, "track_id", track.ID())
 		}
+	}
+
+	if h.addListenTracks(targetPeer) {
+		addedAny = true
+	}
+	if h.addAllCallTrack(targetPeer) {
 		addedAny = true
-		addedCount++
-		log.Printf("peer %s: attached existing track from %s", targetPeerID, p.ID)
 	}
 
 	if addedAny {
-		log.Printf("peer %s: added %d existing room tracks", targetPeerID, addedCount)
+		mediaLog.Debug("added existing room tracks", "peer_id", targetPeerID, "room_id", room.ID, "count", addedCount)
 	}
 
 	return addedAny
 }
 
 func (h *Hub) RemoveTrackFromPeers(leavingPeer *Peer, room *Room) {
-	leavingPeer.RLock()
-	track := leavingPeer.Track
-	leavingPeer.RUnlock()
+	h.endAllCall(leavingPeer)
 
-	if track == nil {
+	if rec := room.activeRecording(); rec != nil {
+		rec.leave(leavingPeer.ID)
+	}
+
+	room.mu.Lock()
+	room.releaseTalkLocked(leavingPeer.ID)
+	room.mu.Unlock()
+
+	sel := room.selector()
+	if sel != nil && sel.release(leavingPeer.ID) {
+		h.broadcastLastN(room)
+	}
+
+	h.removeTracksFromRoomPeers(leavingPeer, room, leavingPeer.forwardedTracks(sel == nil))
+}
+
+// removeTracksFromRoomPeers removes the senders for tracks, published by
+// source, from every other peer in room and renegotiates those peers.
+func (h *Hub) removeTracksFromRoomPeers(source *Peer, room *Room, tracks []*ForwardTrack) {
+	if len(tracks) == 0 {
 		return
 	}
+	remove := make(map[webrtc.TrackLocal]bool, len(tracks))
+	for _, track := range tracks {
+		remove[track] = true
+	}
 
 	room.mu.RLock()
 	peers := make([]*Peer, 0)
 	for _, p := range room.Peers {
-		if p.ID != leavingPeer.ID {
+		if p.ID != source.ID {
+			peers = append(peers, p)
+		}
+	}
+	for _, p := range room.listeners {
+		if p.ID != source.ID {
 			peers = append(peers, p)
 		}
 	}
@@ -686,9 +924,9 @@ func (h *Hub) RemoveTrackFromPeers(leavingPeer *Peer, room *Room) {
 
 		removed := false
 		for _, sender := range pc.GetSenders() {
-			if sender.Track() == track {
+			if remove[sender.Track()] {
 				if err := pc.RemoveTrack(sender); err != nil {
-					log.Printf("failed to remove track from %s: %v", p.ID, err)
+					mediaLog.Warn("remove track failed", "peer_id", p.ID, "err", err)
 					continue
 				}
 				removed = true
@@ -703,7 +941,7 @@ func (h *Hub) RemoveTrackFromPeers(leavingPeer *Peer, room *Room) {
 	for _, p := range needsRenego {
 		go func(target *Peer) {
 			if err := h.NegotiateOffer(target, false); err != nil {
-				log.Printf("failed to renegotiate with %s after track removal: %v", target.ID, err)
+				signalingLog.Warn("renegotiation after track removal failed", "peer_id", target.ID, "err", err)
 			}
 		}(p)
 	}
@@ -715,6 +953,8 @@ func (h *Hub) ClosePeerConnection(peer *Peer) {
 	pc := peer.PC
 	peer.PC = nil
 	peer.Track = nil
+	peer.video = nil
+	peer.stats = nil
 	peer.OfferSeq = 0
 	peer.pendingRenego = false
 	peer.iceRestartQueued = false
@@ -730,119 +970,143 @@ func (h *Hub) ClosePeerConnection(peer *Peer) {
 	}
 }
 
-// removeTrackFromRoomPeers removes a specific track from all PeerConnections in the room
-// and renegotiates affected peers. Used when the track owner's PC has already been closed
-// (so RemoveTrackFromPeers can't read the track from the peer).
-func (h *Hub) removeTrackFromRoomPeers(track *webrtc.TrackLocalStaticRTP, room *Room) {
-	if track == nil {
-		return
+// getWebRTCAPI returns the API for audioProfile, building it on first use.
+// Each profile needs its own MediaEngine because the Opus fmtp line is part
+// of the codec registration.
+func (h *Hub) getWebRTCAPI(audioProfile string) *webrtc.API {
+	if !validAudioProfile(audioProfile) {
+		audioProfile = h.cfg.Codecs.AudioProfile
 	}
 
-	room.mu.RLock()
-	peers := make([]*Peer, 0, len(room.Peers))
-	for _, p := range room.Peers {
-		peers = append(peers, p)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.webrtcAPIs == nil {
+		h.webrtcAPIs = make(map[string]*webrtc.API)
 	}
-	room.mu.RUnlock()
+	api, ok := h.webrtcAPIs[audioProfile]
+	if !ok {
+		h.ensureICEMuxesLocked()
+		api = buildWebRTCAPI(h.webrtcCfg, h.cfg.Codecs, h.cfg.RED.Enabled, audioProfile, h.udpMux, h.tcpMux, h.onStatsGetter)
+		h.webrtcAPIs[audioProfile] = api
+	}
+	return api
+}
 
-	needsRenego := make([]*Peer, 0, len(peers))
-	for _, p := range peers {
-		p.RLock()
-		pc := p.PC
-		p.RUnlock()
-		if pc == nil {
-			continue
+// ensureICEMuxesLocked opens the shared ICE UDP socket in single-port mode
+// and the ICE-TCP listener when configured. The muxes outlive API rebuilds so
+// PeerConnections created before and after a PUBLIC_IP change share the same
+// ports. On failure the hub falls back to the UDP port range or UDP only.
+func (h *Hub) ensureICEMuxesLocked() {
+	if h.udpMux == nil && h.webrtcCfg.UDPMuxPort != 0 {
+		conn, err := net.ListenUDP("udp4", &net.UDPAddr{Port: int(h.webrtcCfg.UDPMuxPort)})
+		if err != nil {
+			mediaLog.Error("ICE UDP mux: listen failed, falling back to port range",
+				"port", h.webrtcCfg.UDPMuxPort, "err", err)
+		} else {
+			h.udpMux = webrtc.NewICEUDPMux(nil, conn)
+			mediaLog.Info("ICE UDP mux listening", "port", h.webrtcCfg.UDPMuxPort)
 		}
+	}
 
-		removed := false
-		for _, sender := range pc.GetSenders() {
-			if sender.Track() == track {
-				if err := pc.RemoveTrack(sender); err != nil {
-					log.Printf("failed to remove track from %s: %v", p.ID, err)
-					continue
-				}
-				removed = true
-			}
+	if h.tcpMux == nil && h.webrtcCfg.TCPMuxPort != 0 {
+		listener, err := net.ListenTCP("tcp4", &net.TCPAddr{Port: int(h.webrtcCfg.TCPMuxPort)})
+		if err != nil {
+			mediaLog.Error("ICE TCP mux: listen failed, ICE-TCP disabled",
+				"port", h.webrtcCfg.TCPMuxPort, "err", err)
+		} else {
+			h.tcpMux = webrtc.NewICETCPMux(nil, listener, 8)
+			mediaLog.Info("ICE TCP mux listening", "port", h.webrtcCfg.TCPMuxPort)
 		}
+	}
+}
 
-		if removed {
-			needsRenego = append(needsRenego, p)
-		}
+func (h *Hub) closeICEMuxes() {
+	h.mu.Lock()
+	udpMux := h.udpMux
+	tcpMux := h.tcpMux
+	h.udpMux = nil
+	h.tcpMux = nil
+	h.mu.Unlock()
+
+	if udpMux != nil {
+		udpMux.Close()
 	}
+	if tcpMux != nil {
+		tcpMux.Close()
+	}
+}
 
-	for _, p := range needsRenego {
-		go func(target *Peer) {
-			if err := h.NegotiateOffer(target, false); err != nil {
-				log.Printf("failed to renegotiate with %s: %v", target.ID, err)
-			}
-		}(p)
+// CandidatePair describes the nominated ICE candidate pair of a
+// PeerConnection.
+type CandidatePair struct {
+	Protocol   string `json:"protocol"`
+	LocalType  string `json:"localType"`
+	RemoteType string `json:"remoteType"`
+}
+
+func selectedCandidatePair(pc *webrtc.PeerConnection) (CandidatePair, bool) {
+	sctp := pc.SCTP()
+	if sctp == nil || sctp.Transport() == nil || sctp.Transport().ICETransport() == nil {
+		return CandidatePair{}, false
+	}
+	pair, err := sctp.Transport().ICETransport().GetSelectedCandidatePair()
+	if err != nil || pair == nil || pair.Local == nil || pair.Remote == nil {
+		return CandidatePair{}, false
 	}
+	return CandidatePair{
+		Protocol:   pair.Local.Protocol.String(),
+		LocalType:  pair.Local.Typ.String(),
+		RemoteType: pair.Remote.Typ.String(),
+	}, true
 }
 
-func (h *Hub) getWebRTCAPI() *webrtc.API {
+func (h *Hub) schedulePublicIPCheck() {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
-	if h.webrtcAPI == nil {
-		api, cfg := NewWebRTCAPI()
-		h.webrtcAPI = api
-		h.webrtcCfg = cfg
+	if h.stopped {
+		return
 	}
-	return h.webrtcAPI
+	h.publicIPTimer = h.clock.AfterFunc(h.cfg.PublicIPRecheckInterval, func() {
+		h.checkPublicIP()
+		h.schedulePublicIPCheck()
+	})
 }
 
-func (h *Hub) startPublicIPMonitor() {
-	source := strings.TrimSpace(os.Getenv("PUBLIC_IP"))
-	if source == "" {
-		return
-	}
+func (h *Hub) checkPublicIP() {
+	h.mu.RLock()
+	currentCfg := h.webrtcCfg
+	apiInitialized := len(h.webrtcAPIs) > 0
+	h.mu.RUnlock()
 
-	interval := getEnvDuration("PUBLIC_IP_RECHECK_INTERVAL", 0)
-	if interval <= 0 {
+	if !apiInitialized {
 		return
 	}
-	rebuildPeers := getEnvBool("PUBLIC_IP_RECHECK_REBUILD_PEERS", true)
-
-	log.Printf("PUBLIC_IP monitor enabled: source=%s interval=%s rebuildPeers=%t", source, interval, rebuildPeers)
-
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
-
-	for range ticker.C {
-		nextCfg := loadWebRTCConfigQuiet()
-
-		h.mu.RLock()
-		currentCfg := h.webrtcCfg
-		apiInitialized := h.webrtcAPI != nil
-		h.mu.RUnlock()
 
-		if !apiInitialized {
-			continue
-		}
-
-		if nextCfg.PublicIP == "" && currentCfg.PublicIP != "" {
-			log.Printf("PUBLIC_IP monitor: resolution temporarily failed, keeping previous IP %s", currentCfg.PublicIP)
-			continue
-		}
+	nextCfg := currentCfg
+	nextCfg.PublicIP = resolvePublicIPQuiet(h.cfg.PublicIPSource)
 
-		if nextCfg.PublicIP == currentCfg.PublicIP &&
-			nextCfg.UDPMin == currentCfg.UDPMin &&
-			nextCfg.UDPMax == currentCfg.UDPMax {
-			continue
-		}
+	if nextCfg.PublicIP == "" && currentCfg.PublicIP != "" {
+		hubLog.Warn("PUBLIC_IP monitor: resolution temporarily failed, keeping previous IP", "public_ip", currentCfg.PublicIP)
+		return
+	}
 
-		h.applyWebRTCConfig(nextCfg, rebuildPeers)
+	if nextCfg.PublicIP == currentCfg.PublicIP {
+		return
 	}
+
+	h.applyWebRTCConfig(nextCfg, h.cfg.PublicIPRecheckRebuildPeers)
 }
 
 func (h *Hub) applyWebRTCConfig(cfg WebRTCConfig, rebuildPeers bool) {
-	api := buildWebRTCAPI(cfg)
-
 	var targets []rebuildEntry
 	h.mu.Lock()
 	prevCfg := h.webrtcCfg
-	h.webrtcAPI = api
 	h.webrtcCfg = cfg
+	h.ensureICEMuxesLocked()
+	// APIs are rebuilt per audio profile on next use with the new config.
+	h.webrtcAPIs = nil
 	mainRooms := make([]*Room, 0, len(h.Rooms))
 	for _, room := range h.Rooms {
 		if room.ParentID == "" {
@@ -851,8 +1115,10 @@ func (h *Hub) applyWebRTCConfig(cfg WebRTCConfig, rebuildPeers bool) {
 	}
 	h.mu.Unlock()
 
-	log.Printf("WebRTC config updated: PUBLIC_IP %s -> %s, UDP range %d-%d -> %d-%d",
-		prevCfg.PublicIP, cfg.PublicIP, prevCfg.UDPMin, prevCfg.UDPMax, cfg.UDPMin, cfg.UDPMax)
+	hubLog.Info("WebRTC config updated",
+		"prev_public_ip", prevCfg.PublicIP, "public_ip", cfg.PublicIP,
+		"prev_udp_min", prevCfg.UDPMin, "prev_udp_max", prevCfg.UDPMax,
+		"udp_min", cfg.UDPMin, "udp_max", cfg.UDPMax)
 
 	if !rebuildPeers {
 		return
@@ -863,7 +1129,7 @@ func (h *Hub) applyWebRTCConfig(cfg WebRTCConfig, rebuildPeers bool) {
 		return
 	}
 
-	log.Printf("Rebuilding %d peer connections to apply updated WebRTC config", len(targets))
+	hubLog.Info("rebuilding peer connections to apply updated WebRTC config", "peers", len(targets))
 	for _, target := range targets {
 		h.rebuildPeerConnection(target.peer, target.room)
 	}
@@ -915,36 +1181,166 @@ func (h *Hub) rebuildPeerConnection(peer *Peer, room *Room) {
 	h.ClosePeerConnection(peer)
 
 	if err := h.CreatePeerConnection(peer, room); err != nil {
-		log.Printf("failed to rebuild peer connection for %s: %v", peer.ID, err)
+		mediaLog.Error("rebuild peer connection failed", "peer_id", peer.ID, "room_id", room.ID, "err", err)
 		return
 	}
 
 	h.AddTrackToPeers(peer, room)
 	go func(target *Peer, targetRoom *Room) {
 		if err := h.NegotiateOffer(target, true); err != nil {
-			log.Printf("failed to send rebuilt initial offer to %s: %v", target.ID, err)
+			signalingLog.Warn("rebuilt initial offer failed", "peer_id", target.ID, "room_id", targetRoom.ID, "err", err)
 			return
 		}
 		if h.AddRoomTracksToPeer(target, targetRoom) {
 			if err := h.NegotiateOffer(target, false); err != nil {
-				log.Printf("failed to send rebuilt room-track offer to %s: %v", target.ID, err)
+				signalingLog.Warn("rebuilt room-track offer failed", "peer_id", target.ID, "room_id", targetRoom.ID, "err", err)
 			}
 		}
 	}(peer, room)
 }
 
-func (h *Hub) drainSenderRTCP(sender *webrtc.RTPSender) {
-	go func() {
-		rtcpBuf := make([]byte, 1500)
-		for {
-			if _, _, err := sender.Read(rtcpBuf); err != nil {
+// switchPeerRoom moves peer's media into room after its membership has been
+// updated. The existing PeerConnection is kept and renegotiated; only a
+// missing, failed or closed one is rebuilt, which bumps the epoch and makes
+// the client start over with a reset offer.
+func (h *Hub) switchPeerRoom(peer *Peer, room *Room) {
+	h.metrics.peerMoves.WithLabelValues(h.syncPeerMedia(peer, room)).Inc()
+}
+
+// SetupPeerMedia sets up peer's media after it joined room. A peer that
+// joins for the first time, or after a session restore, has no
+// PeerConnection yet and gets a new one; a live one is kept and renegotiated.
+func (h *Hub) SetupPeerMedia(peer *Peer, room *Room) {
+	h.syncPeerMedia(peer, room)
+}
+
+// syncPeerMedia makes peer's senders match room: senders for tracks room
+// does not forward to it, other than whispers to it, the audio of a
+// sub-channel it listens in on and a running all-call, are removed, room's
+// tracks (or last-N slots) are added and the peer gets one renegotiation
+// offer, while its own track is attached to room's peers. It reports whether
+// the PeerConnection was "reused" or "rebuilt".
+func (h *Hub) syncPeerMedia(peer *Peer, room *Room) string {
+	peer.RLock()
+	pc := peer.PC
+	peer.RUnlock()
+
+	if pc == nil || pc.ConnectionState() == webrtc.PeerConnectionStateFailed ||
+		pc.ConnectionState() == webrtc.PeerConnectionStateClosed {
+		h.ClosePeerConnection(peer)
+		if err := h.CreatePeerConnection(peer, room); err != nil {
+			mediaLog.Error("create peer connection failed", "peer_id", peer.ID, "room_id", room.ID, "err", err)
+			return "rebuilt"
+		}
+		h.AddTrackToPeers(peer, room)
+		go func(target *Peer, targetRoom *Room) {
+			if err := h.NegotiateOffer(target, true); err != nil {
+				signalingLog.Warn("initial offer failed", "peer_id", target.ID, "room_id", targetRoom.ID, "err", err)
 				return
 			}
+			if h.AddRoomTracksToPeer(target, targetRoom) {
+				if err := h.NegotiateOffer(target, false); err != nil {
+					signalingLog.Warn("room-track offer failed", "peer_id", target.ID, "room_id", targetRoom.ID, "err", err)
+				}
+			}
+		}(peer, room)
+		return "rebuilt"
+	}
+
+	// Joining the sub-channel a peer listens in on ends the listen-in; the
+	// members' audio is kept as the room's own tracks.
+	peer.RLock()
+	joinedListened := peer.listeningTo == room.ID
+	peer.RUnlock()
+	if joinedListened {
+		h.endListening(peer)
+	}
+
+	keep := make(map[webrtc.TrackLocal]bool)
+	sel := room.selector()
+	if sel != nil {
+		for _, track := range peer.slotTracks(sel.size()) {
+			keep[track] = true
+		}
+	}
+	room.mu.RLock()
+	others := make([]*Peer, 0, len(room.Peers))
+	for _, p := range room.Peers {
+		if p.ID != peer.ID {
+			others = append(others, p)
 		}
-	}()
+	}
+	room.mu.RUnlock()
+	for _, p := range others {
+		for _, track := range p.forwardedTracks(sel == nil) {
+			keep[track] = true
+		}
+	}
+	for _, track := range h.whisperTracksTo(peer) {
+		keep[track] = true
+	}
+	for _, track := range h.listenTracks(peer) {
+		keep[track] = true
+	}
+	if track := h.allCallTrack(peer); track != nil {
+		keep[track] = true
+	}
+
+	// Serialize with in-flight negotiations so the removals land in one offer.
+	peer.negoMu.Lock()
+	removed := 0
+	for _, sender := range pc.GetSenders() {
+		track := sender.Track()
+		if track == nil || keep[track] {
+			continue
+		}
+		if err := pc.RemoveTrack(sender); err != nil {
+			mediaLog.Warn("remove track failed", "peer_id", peer.ID, "err", err)
+			continue
+		}
+		removed++
+	}
+	peer.negoMu.Unlock()
+
+	h.AddTrackToPeers(peer, room)
+	added := h.AddRoomTracksToPeer(peer, room)
+
+	mediaLog.Debug("synced peer senders", "peer_id", peer.ID, "room_id", room.ID,
+		"removed_tracks", removed, "added_tracks", added)
+
+	if removed > 0 || added {
+		go func(target *Peer, targetRoom *Room) {
+			if err := h.NegotiateOffer(target, false); err != nil {
+				signalingLog.Warn("move offer failed", "peer_id", target.ID, "room_id", targetRoom.ID, "err", err)
+			}
+		}(peer, room)
+	}
+	return "reused"
+}
+
+// currentRoom resolves the room or sub-channel peer is in, or nil.
+func (h *Hub) currentRoom(peer *Peer) *Room {
+	peer.RLock()
+	roomID := peer.RoomID
+	mainRoomID := peer.MainRoomID
+	peer.RUnlock()
+
+	h.mu.RLock()
+	mainRoom, ok := h.Rooms[mainRoomID]
+	h.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+	if roomID == mainRoomID {
+		return mainRoom
+	}
+
+	mainRoom.mu.RLock()
+	defer mainRoom.mu.RUnlock()
+	return mainRoom.SubChannels[roomID]
 }
 
-func hasSenderForTrack(pc *webrtc.PeerConnection, track *webrtc.TrackLocalStaticRTP) bool {
+func hasSenderForTrack(pc *webrtc.PeerConnection, track webrtc.TrackLocal) bool {
 	for _, sender := range pc.GetSenders() {
 		if sender.Track() == track {
 			return true
@@ -0,0 +1,276 @@
+package sfu
+
+import (
+	"errors"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+)
+
+// A whisper sends a peer's voice to chosen users of its main room, in any of
+// its channels, instead of to the peer's own channel. Each whisperer keeps
+// one outbound track per recipient, so a recipient only hears whispers meant
+// for it. Tracks and their senders are kept between whispers, so holding the
+// whisper key again does not wait for a renegotiation.
+
+// newWhisperTrack creates the track carrying fromID's whispers to one
+// recipient. It rewrites like a last-N slot, so each whisper continues the
+// stream where the previous one ended.
+func newWhisperTrack(fromID string) *slotTrack {
+	return &slotTrack{
+		ForwardTrack: NewForwardTrack(
+			webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus},
+			"audio-whisper-"+fromID,
+			"whisper-"+fromID,
+		),
+	}
+}
+
+// endTalkspurt makes the next packet start a new talkspurt, as it would
+// after a change of source.
+func (s *slotTrack) endTalkspurt() {
+	s.mu.Lock()
+	s.source = ""
+	s.mu.Unlock()
+}
+
+// mainRoomMembers returns the peers in peer's main room and its
+// sub-channels by ID, together with the main room ID.
+func (h *Hub) mainRoomMembers(peer *Peer) (map[string]*Peer, string) {
+	peer.RLock()
+	mainRoomID := peer.MainRoomID
+	peer.RUnlock()
+
+	h.mu.RLock()
+	mainRoom, ok := h.Rooms[mainRoomID]
+	h.mu.RUnlock()
+	if !ok {
+		return nil, mainRoomID
+	}
+
+	mainRoom.mu.RLock()
+	all := mainRoom.AllPeersInMainAndSubs()
+	mainRoom.mu.RUnlock()
+
+	members := make(map[string]*Peer, len(all))
+	for _, p := range all {
+		members[p.ID] = p
+	}
+	return members, mainRoomID
+}
+
+// StartWhisper sends peer's voice to targetIDs until StopWhisper. Every
+// target must be in peer's main room or one of its sub-channels. Calling it
+// again while whispering replaces the recipients. In a push-to-talk channel
+// the whisper is only forwarded while peer also holds talk.
+func (h *Hub) StartWhisper(peer *Peer, targetIDs []string) error {
+	if len(targetIDs) == 0 {
+		return NewSignalError(ErrInvalidMessage, "Choose at least one user to whisper to")
+	}
+	members, mainRoomID := h.mainRoomMembers(peer)
+	if members == nil {
+		return NewSignalError(ErrChannelNotFound, "Room not found")
+	}
+
+	targets := make(map[string]*Peer, len(targetIDs))
+	for _, id := range targetIDs {
+		if id == peer.ID {
+			continue
+		}
+		target, ok := members[id]
+		if ok {
+			target.RLock()
+			ok = target.MainRoomID == mainRoomID
+			target.RUnlock()
+		}
+		if !ok {
+			return NewSignalError(ErrUserNotFound, "User is not in this room")
+		}
+		targets[id] = target
+	}
+	if len(targets) == 0 {
+		return NewSignalError(ErrInvalidMessage, "Choose at least one user to whisper to")
+	}
+
+	peer.Lock()
+	previous := peer.whisperTo
+	if peer.whisperTracks == nil {
+		peer.whisperTracks = make(map[string]*slotTrack)
+	}
+	to := make(map[string]*slotTrack, len(targets))
+	for id := range targets {
+		track := peer.whisperTracks[id]
+		if track == nil {
+			track = newWhisperTrack(peer.ID)
+			peer.whisperTracks[id] = track
+		}
+		to[id] = track
+	}
+	peer.whisperTo = to
+	peer.Unlock()
+
+	for id, target := range targets {
+		to[id].endTalkspurt()
+		if h.addWhisperSender(target, to[id]) {
+			go func(target *Peer) {
+				if err := h.NegotiateOffer(target, false); err != nil {
+					signalingLog.Warn("whisper offer failed", "peer_id", target.ID, "source_peer_id", peer.ID, "err", err)
+				}
+			}(target)
+		}
+		target.SendJSON("whisper", WhisperPayload{From: peer.ID, Active: true})
+	}
+	for id := range previous {
+		if _, ok := to[id]; !ok && members[id] != nil {
+			members[id].SendJSON("whisper", WhisperPayload{From: peer.ID, Active: false})
+		}
+	}
+
+	if len(previous) == 0 {
+		h.metrics.whispers.Inc()
+	}
+	mediaLog.Info("whisper started", "peer_id", peer.ID, "room_id", mainRoomID, "targets", len(to))
+	return nil
+}
+
+// StopWhisper sends peer's voice to its channel again.
+func (h *Hub) StopWhisper(peer *Peer) {
+	peer.Lock()
+	to := peer.whisperTo
+	peer.whisperTo = nil
+	peer.Unlock()
+	if to == nil {
+		return
+	}
+
+	members, _ := h.mainRoomMembers(peer)
+	for id := range to {
+		if target := members[id]; target != nil {
+			target.SendJSON("whisper", WhisperPayload{From: peer.ID, Active: false})
+		}
+	}
+	mediaLog.Info("whisper stopped", "peer_id", peer.ID)
+}
+
+// addWhisperSender gives target a sender for track. Like
+// addSlotTracksToPeer it does not renegotiate; it reports whether a sender
+// was added.
+func (h *Hub) addWhisperSender(target *Peer, track *slotTrack) bool {
+	target.RLock()
+	pc := target.PC
+	target.RUnlock()
+	if pc == nil || hasSenderForTrack(pc, track) {
+		return false
+	}
+
+	transceiver, err := pc.AddTransceiverFromTrack(track, webrtc.RTPTransceiverInit{
+		Direction: webrtc.RTPTransceiverDirectionSendonly,
+	})
+	if err != nil {
+		mediaLog.Warn("add whisper track failed", "peer_id", target.ID, "track_id", track.ID(), "err", err)
+		return false
+	}
+	if transceiver != nil && transceiver.Sender() != nil {
+		h.readSenderRTCP(transceiver.Sender())
+	}
+	return true
+}
+
+// forwardWhisper writes pkt from peerID to each recipient's whisper track.
+func forwardWhisper(peerID string, to map[string]*slotTrack, pkt *rtp.Packet, srcExtensions map[uint8]string, now time.Time) error {
+	var errs []error
+	for _, track := range to {
+		if err := track.writeFrom(peerID, pkt, srcExtensions, now); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// whisperTracksTo returns the whisper tracks the other members of peer's
+// main room keep for it, whose senders survive peer's channel moves.
+func (h *Hub) whisperTracksTo(peer *Peer) []*slotTrack {
+	members, _ := h.mainRoomMembers(peer)
+	var tracks []*slotTrack
+	for _, p := range members {
+		if p == peer {
+			continue
+		}
+		p.RLock()
+		if track := p.whisperTracks[peer.ID]; track != nil {
+			tracks = append(tracks, track)
+		}
+		p.RUnlock()
+	}
+	return tracks
+}
+
+// dropWhispers ends peer's whisper before it leaves its main room and
+// forgets the whisper tracks between it and the other members, removing
+// the senders of its own tracks from their recipients. A member whose only
+// recipient was peer stops whispering and is told with "whisper-ended".
+func (h *Hub) dropWhispers(peer *Peer) {
+	h.StopWhisper(peer)
+
+	peer.Lock()
+	own := peer.whisperTracks
+	peer.whisperTracks = nil
+	peer.Unlock()
+
+	members, _ := h.mainRoomMembers(peer)
+	for id, p := range members {
+		if p == peer {
+			continue
+		}
+
+		p.Lock()
+		delete(p.whisperTracks, peer.ID)
+		ended := false
+		if _, ok := p.whisperTo[peer.ID]; ok {
+			// whisperTo is replaced rather than modified; see Peer.
+			to := make(map[string]*slotTrack, len(p.whisperTo))
+			for targetID, track := range p.whisperTo {
+				if targetID != peer.ID {
+					to[targetID] = track
+				}
+			}
+			// Without recipients the whisper ends as with StopWhisper, and
+			// p's audio goes to its channel again.
+			if len(to) == 0 {
+				to = nil
+				ended = true
+			}
+			p.whisperTo = to
+		}
+		pc := p.PC
+		p.Unlock()
+
+		if ended {
+			p.SendJSON("whisper-ended", WhisperEndedPayload{})
+			mediaLog.Info("whisper ended, no recipients left", "peer_id", p.ID)
+		}
+
+		track := own[id]
+		if track == nil || pc == nil {
+			continue
+		}
+		removed := false
+		for _, sender := range pc.GetSenders() {
+			if sender.Track() == webrtc.TrackLocal(track) {
+				if err := pc.RemoveTrack(sender); err != nil {
+					mediaLog.Warn("remove whisper track failed", "peer_id", p.ID, "err", err)
+					continue
+				}
+				removed = true
+			}
+		}
+		if removed {
+			go func(target *Peer) {
+				if err := h.NegotiateOffer(target, false); err != nil {
+					signalingLog.Warn("renegotiation after whisper removal failed", "peer_id", target.ID, "err", err)
+				}
+			}(p)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package sfu
+
+import "testing"
+
+func TestWhisperEndsWhenLastRecipientLeaves(t *testing.T) {
+	h, _ := newTestHub(t)
+	main, peers := newTestRoom(t, h, "alice", "bob", "carol")
+	alice, bob, carol := peers[0], peers[1], peers[2]
+	for _, p := range peers {
+		h.SetupPeerMedia(p, main)
+	}
+
+	if err := h.StartWhisper(alice, []string{bob.ID, carol.ID}); err != nil {
+		t.Fatalf("StartWhisper: %v", err)
+	}
+
+	h.RemovePeer(bob, false)
+	alice.RLock()
+	to := alice.whisperTo
+	alice.RUnlock()
+	if _, ok := to[carol.ID]; !ok || len(to) != 1 {
+		t.Fatalf("whisper recipients %v after bob left, want carol only", to)
+	}
+
+	h.RemovePeer(carol, false)
+	alice.RLock()
+	defer alice.RUnlock()
+	if alice.whisperTo != nil {
+		t.Fatalf("whisper to %d recipients kept after the last one left", len(alice.whisperTo))
+	}
+}
@@ -1,20 +1,25 @@
 package main
 
 import (
+	"context"
 	"crypto/subtle"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"runtime/debug"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 	"unicode"
 
 	"github.com/google/uuid"
 	"github.com/jo-sobo/qvoch/internal/handlers"
-	_ "github.com/jo-sobo/qvoch/internal/sfu"
+	"github.com/jo-sobo/qvoch/internal/logging"
+	"github.com/jo-sobo/qvoch/internal/metrics"
+	"github.com/jo-sobo/qvoch/internal/sfu"
 )
 
 const (
@@ -38,21 +43,106 @@ func main() {
 		port = "17223"
 	}
 
+	cfg := sfu.LoadConfig()
+	hub := sfu.NewHub(cfg, sfu.RealClock())
+	hub.Start()
+	defer hub.Stop()
+
+	wsHandler := handlers.NewWebSocketHandler(hub)
+
 	mux := http.NewServeMux()
-	mux.HandleFunc("/ws", handlers.HandleWebSocket)
+	mux.Handle("/ws", wsHandler)
+	mux.Handle("GET /recordings/{id}", handlers.NewRecordingDownloadHandler(hub))
 	mux.Handle("/", http.FileServer(http.Dir("web/dist")))
 
 	var handler http.Handler = mux
 	handler = securityHeadersMiddleware(handler)
 	handler = sitePassphraseMiddleware(handler)
 
+	reg := metrics.NewRegistry()
+	hub.RegisterMetrics(reg)
+	handlers.RegisterMetrics(reg)
+
+	metricsAddr := strings.TrimSpace(os.Getenv("METRICS_ADDR"))
+	metricsToken := os.Getenv("METRICS_TOKEN")
+	metricsHandler := bearerAuthMiddleware("metrics", metricsToken, reg.Handler())
+
+	var metricsSrv *http.Server
+	switch {
+	case metricsAddr != "":
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("/metrics", metricsHandler)
+		metricsSrv = &http.Server{Addr: metricsAddr, Handler: metricsMux}
+		go func() {
+			httpLog.Info("metrics listener started", "addr", metricsAddr, "path", "/metrics", "token", metricsToken != "")
+			if err := metricsSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				httpLog.Error("metrics server failed", "err", err)
+			}
+		}()
+	case metricsToken != "":
+		// Mounted ahead of the passphrase middleware: scrapers authenticate
+		// with the bearer token instead of the site cookie.
+		rootMux := http.NewServeMux()
+		rootMux.Handle("/metrics", metricsHandler)
+		rootMux.Handle("/", handler)
+		handler = rootMux
+		httpLog.Info("metrics enabled on main listener", "path", "/metrics", "token", true)
+	}
+
+	// The admin API is only mounted with a token; like /metrics it sits ahead
+	// of the passphrase middleware and authenticates with a bearer token.
+	if adminToken := os.Getenv("ADMIN_TOKEN"); adminToken != "" {
+		rootMux := http.NewServeMux()
+		rootMux.Handle("/admin/api/", bearerAuthMiddleware("admin", adminToken, handlers.NewAdminHandler(hub)))
+		rootMux.Handle("/", handler)
+		handler = rootMux
+		httpLog.Info("admin API enabled", "path", "/admin/api/")
+	}
+
 	addr := fmt.Sprintf(":%s", port)
-	log.Printf("QVoCh server starting on %s (build=%s)", addr, resolveServerBuildID())
-	if err := http.ListenAndServe(addr, handler); err != nil {
-		log.Fatalf("server error: %v", err)
+	srv := &http.Server{
+		Addr:    addr,
+		Handler: handler,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		httpLog.Info("QVoCh server starting", "addr", addr, "build", resolveServerBuildID())
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			httpLog.Error("server failed", "err", err)
+			os.Exit(1)
+		}
+		return
+	case <-ctx.Done():
+	}
+	stop()
+
+	httpLog.Info("shutdown: signal received, draining", "timeout", cfg.ShutdownDrainTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownDrainTimeout)
+	defer cancel()
+
+	if err := wsHandler.Shutdown(shutdownCtx, cfg.ShutdownReconnectAfter); err != nil {
+		httpLog.Warn("shutdown: websocket drain incomplete", "err", err)
+	}
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		httpLog.Warn("shutdown: http server", "err", err)
+	}
+	if metricsSrv != nil {
+		metricsSrv.Shutdown(shutdownCtx)
 	}
+	httpLog.Info("shutdown: complete")
 }
 
+var httpLog = logging.For(logging.HTTP)
+
 var (
 	sitePassphrase string
 	authToken      string
@@ -62,7 +152,7 @@ func init() {
 	sitePassphrase = os.Getenv("SITE_PASSPHRASE")
 	if sitePassphrase != "" {
 		authToken = uuid.New().String()
-		log.Printf("Site passphrase enabled — auth required")
+		httpLog.Info("site passphrase enabled, auth required")
 	}
 }
 
@@ -304,12 +394,29 @@ button:hover{background:#0ea5e9}
 </html>`, errorHTML)
 }
 
+// bearerAuthMiddleware requires "Authorization: Bearer <token>" when a
+// token is configured.
+func bearerAuthMiddleware(realm, token string, next http.Handler) http.Handler {
+	if token == "" {
+		return next
+	}
+	expected := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+realm+`"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 func securityHeadersMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("X-Content-Type-Options", "nosniff")
 		w.Header().Set("X-Frame-Options", "DENY")
 		w.Header().Set("Referrer-Policy", "strict-origin-when-cross-origin")
-		w.Header().Set("Permissions-Policy", "camera=(), microphone=(self), geolocation=()")
+		w.Header().Set("Permissions-Policy", "camera=(self), microphone=(self), geolocation=()")
 		w.Header().Set("Content-Security-Policy",
 			"default-src 'self'; "+
 				"script-src 'self'; "+
@@ -1,9 +1,9 @@
 import { useState, useEffect, useRef } from 'react';
-import { useStore } from './stores/useStore';
+import { useStore, channelPTT } from './stores/useStore';
 import { LandingPage } from './components/LandingPage';
 import { RoomView } from './components/RoomView';
 import { ToastContainer } from './components/Toast';
-import { connect, persistSessionForRejoin, leaveRoomAndReset } from './services/socket';
+import { connect, send, persistSessionForRejoin, leaveRoomAndReset } from './services/socket';
 import { ensureAudioContext, getLocalVolume, setVoiceTransmissionActive } from './services/webrtc';
 import { AlertTriangle } from 'lucide-react';
 
@@ -18,6 +18,12 @@ function isTypingTarget(target: EventTarget | null): boolean {
   return target.closest('[contenteditable="true"]') !== null;
 }
 
+// Space is push-to-talk when the user picked it or the channel enforces it.
+function pushToTalkActive(): boolean {
+  const state = useStore.getState();
+  return state.voiceMode === 'ptt' || channelPTT(state) !== null;
+}
+
 function App() {
   const [view, setView] = useState<View>('landing');
   const [leaveIntent, setLeaveIntent] = useState<LeaveIntent | null>(null);
@@ -123,10 +129,13 @@ function App() {
 
     let rafId: number | null = null;
     const loop = () => {
-      const { voiceMode: mode, vadThreshold } = useStore.getState();
+      const { vadThreshold } = useStore.getState();
       let shouldTransmit = false;
 
-      if (mode === 'ptt') {
+      if (useStore.getState().whispering) {
+        shouldTransmit = true;
+        vadTalkingRef.current = false;
+      } else if (pushToTalkActive()) {
         shouldTransmit = pttPressedRef.current;
         vadTalkingRef.current = false;
       } else {
@@ -170,24 +179,37 @@ function App() {
   useEffect(() => {
     if (!roomId) return;
 
+    // The server only forwards audio in a push-to-talk channel while the
+    // user holds talk, so presses there are announced.
+    let holdingTalk = false;
+
     const releasePTT = () => {
       pttPressedRef.current = false;
+      if (holdingTalk) {
+        holdingTalk = false;
+        send('ptt-stop', {});
+      }
     };
 
     const handleKeyDown = (e: KeyboardEvent) => {
       if (e.code !== 'Space') return;
-      if (useStore.getState().voiceMode !== 'ptt') return;
+      if (!pushToTalkActive()) return;
       if (isTypingTarget(e.target)) return;
       e.preventDefault();
+      if (pttPressedRef.current) return;
       pttPressedRef.current = true;
+      if (channelPTT(useStore.getState())) {
+        holdingTalk = true;
+        send('ptt-start', {});
+      }
     };
 
     const handleKeyUp = (e: KeyboardEvent) => {
       if (e.code !== 'Space') return;
-      if (useStore.getState().voiceMode !== 'ptt') return;
+      if (!pttPressedRef.current && !pushToTalkActive()) return;
       if (isTypingTarget(e.target)) return;
       e.preventDefault();
-      pttPressedRef.current = false;
+      releasePTT();
     };
 
     const handleVisibility = () => {
@@ -206,6 +228,7 @@ function App() {
       window.removeEventListener('keyup', handleKeyUp);
       window.removeEventListener('blur', releasePTT);
       document.removeEventListener('visibilitychange', handleVisibility);
+      releasePTT();
     };
   }, [roomId]);
 
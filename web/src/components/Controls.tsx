@@ -1,7 +1,11 @@
-import { useStore } from '../stores/useStore';
+import { useEffect, useRef } from 'react';
+import { useStore, channelPTT } from '../stores/useStore';
 import { send, leaveRoomAndReset } from '../services/socket';
-import { setMuted as setWebRTCMuted, setOutputMuted as setWebRTCOutputMuted } from '../services/webrtc';
-import { Mic, MicOff, LogOut, ArrowLeft, Settings, Headphones, HeadphoneOff } from 'lucide-react';
+import { setMuted as setWebRTCMuted, setOutputMuted as setWebRTCOutputMuted, startVideo, stopVideo } from '../services/webrtc';
+import { Mic, MicOff, LogOut, ArrowLeft, Settings, Headphones, HeadphoneOff, Circle, Square, Monitor, MonitorOff, Video, VideoOff, Radio, Ear, Megaphone, Download } from 'lucide-react';
+import type { PTTMode, VideoSource } from '../types';
+
+const nextPTTMode: Record<PTTMode, PTTMode> = { off: 'open', open: 'floor', floor: 'off' };
 
 export function Controls() {
   const muted = useStore((s) => s.muted);
@@ -11,8 +15,33 @@ export function Controls() {
   const currentChannelId = useStore((s) => s.currentChannelId);
   const roomId = useStore((s) => s.roomId);
   const setSettingsOpen = useStore((s) => s.setSettingsOpen);
+  const userId = useStore((s) => s.userId);
+  const roomOwnerId = useStore((s) => s.roomOwnerId);
+  const roomRecording = useStore((s) => s.roomRecording);
+  const ptt = useStore(channelPTT);
+  const users = useStore((s) => s.users);
+  const whisperTargets = useStore((s) => s.whisperTargets);
+  const whispering = useStore((s) => s.whispering);
+  const setWhispering = useStore((s) => s.setWhispering);
+  const whispersFrom = useStore((s) => s.whispersFrom);
+  const allCallFrom = useStore((s) => s.allCallFrom);
+  const recordingDownloads = useStore((s) => s.recordingDownloads);
+  const removeRecordingDownload = useStore((s) => s.removeRecordingDownload);
+  const subChannels = useStore((s) => s.subChannels);
+  const localVideo = useStore((s) => s.localVideo);
+  const addToast = useStore((s) => s.addToast);
 
   const isInSubChannel = currentChannelId !== roomId;
+  const currentSub = subChannels.find((c) => c.id === currentChannelId);
+  const isOwner = roomOwnerId === userId || (isInSubChannel && currentSub?.ownerId === userId);
+  const recording = isInSubChannel ? currentSub?.recording : roomRecording;
+  const pttMode: PTTMode = ptt?.mode ?? 'off';
+  const channelUsers = isInSubChannel ? currentSub?.users ?? [] : users;
+  const talkerNames = (ptt?.talkers ?? []).map((id) => channelUsers.find((u) => u.id === id)?.name ?? 'Someone');
+  const whisperNames = Object.keys(whispersFrom).map((id) => users.find((u) => u.id === id)?.name ?? 'Someone');
+  const isRoomOwner = roomOwnerId === userId;
+  const announcing = allCallFrom === userId;
+  const allCallName = allCallFrom ? users.find((u) => u.id === allCallFrom)?.name ?? 'Someone' : null;
 
   const handleMuteToggle = () => {
     const newMuted = !muted;
@@ -35,8 +64,115 @@ export function Controls() {
     send('move-to-main', {});
   };
 
+  const handleVideoToggle = (source: VideoSource) => {
+    if (localVideo[source]) {
+      stopVideo(source);
+      return;
+    }
+    startVideo(source).catch((err) => {
+      // Cancelling the browser's picker is not worth a toast.
+      if (err instanceof DOMException && err.name === 'NotAllowedError') return;
+      console.error(`Failed to start ${source}:`, err);
+      addToast(source === 'screen' ? 'Could not start screen sharing' : 'Could not start camera');
+    });
+  };
+
+  const handleRecordingToggle = () => {
+    send(recording ? 'recording-stop' : 'recording-start', { channelId: currentChannelId });
+  };
+
+  // Whispering lasts while the button is held; the server sends the voice to
+  // the whisper group instead of the channel. In a push-to-talk channel the
+  // server only forwards whispers while talk is held, so it is taken too.
+  const whisperTalkRef = useRef(false);
+
+  const handleWhisperStart = (e: React.PointerEvent) => {
+    if (whisperTargets.length === 0 || whispering) return;
+    e.currentTarget.setPointerCapture(e.pointerId);
+    if (channelPTT(useStore.getState())) {
+      whisperTalkRef.current = send('ptt-start', {});
+    }
+    if (send('whisper-start', { targets: whisperTargets })) {
+      setWhispering(true);
+    }
+  };
+
+  const handleWhisperStop = () => {
+    if (!useStore.getState().whispering) return;
+    setWhispering(false);
+    send('whisper-stop', {});
+  };
+
+  // However the whisper ended, talk taken for it is released.
+  useEffect(() => {
+    if (!whispering && whisperTalkRef.current) {
+      whisperTalkRef.current = false;
+      send('ptt-stop', {});
+    }
+  }, [whispering]);
+
+  // Leaving the window or losing the last target ends the whisper, since the
+  // button may never see the pointer being released.
+  useEffect(() => {
+    if (!whispering) return;
+    if (whisperTargets.length === 0) {
+      handleWhisperStop();
+      return;
+    }
+    window.addEventListener('blur', handleWhisperStop);
+    return () => window.removeEventListener('blur', handleWhisperStop);
+  }, [whispering, whisperTargets.length]);
+
+  const handlePTTModeToggle = () => {
+    send('ptt-mode', { channelId: currentChannelId, mode: nextPTTMode[pttMode] });
+  };
+
+  const handleAllCallToggle = () => {
+    send(announcing ? 'all-call-stop' : 'all-call-start', {});
+  };
+
   return (
     <div className="p-3 border-border space-y-2">
+      {recordingDownloads.map((d) => (
+        <a
+          key={d.recordingId}
+          href={d.downloadUrl}
+          download
+          // Removed after the click so the browser still follows the link.
+          onClick={() => setTimeout(() => removeRecordingDownload(d.recordingId), 0)}
+          className="text-xs text-accent hover:underline flex items-center gap-1.5"
+          title="The link can be used once"
+        >
+          <Download className="w-3.5 h-3.5" />
+          Download recording of {d.channelName}
+        </a>
+      ))}
+
+      {allCallName && (
+        <div className="text-xs text-amber-400 flex items-center gap-1.5">
+          <Megaphone className="w-3.5 h-3.5" />
+          {announcing ? 'You are addressing all channels' : `${allCallName} is addressing all channels`}
+        </div>
+      )}
+
+      {whisperNames.length > 0 && (
+        <div className="text-xs text-purple-400 flex items-center gap-1.5">
+          <Ear className="w-3.5 h-3.5" />
+          {whisperNames.join(', ')} whispering to you
+        </div>
+      )}
+
+      {ptt && (
+        <div className="text-xs text-text-secondary flex items-center gap-1.5">
+          <Radio className="w-3.5 h-3.5" />
+          {talkerNames.length > 0
+            ? `${talkerNames.join(', ')} talking`
+            : ptt.mode === 'floor'
+              ? 'Floor control: hold Space to take the floor'
+              : 'Push-to-talk: hold Space to talk'}
+        </div>
+      )}
+
       {isInSubChannel && (
         <button
           onClick={handleReturnToMain}
@@ -47,6 +183,25 @@ export function Controls() {
         </button>
       )}
 
+      {whisperTargets.length > 0 && (
+        <button
+          onPointerDown={handleWhisperStart}
+          onPointerUp={handleWhisperStop}
+          onPointerCancel={handleWhisperStop}
+          onContextMenu={(e) => e.preventDefault()}
+          className={`w-full py-2 px-3 rounded-md text-sm transition-colors flex items-center justify-center gap-2 select-none touch-none ${
+            whispering
+              ? 'bg-purple-500/30 text-purple-300'
+              : 'bg-bg-tertiary hover:bg-bg-tertiary/80 text-text-secondary'
+          }`}
+        >
+          <Ear className="w-4 h-4" />
+          {whispering
+            ? 'Whispering…'
+            : `Hold to whisper to ${whisperTargets.length} ${whisperTargets.length === 1 ? 'user' : 'users'}`}
+        </button>
+      )}
+
       <div className="flex gap-2">
         <button
           onClick={handleMuteToggle}
@@ -83,6 +238,91 @@ export function Controls() {
           )}
         </button>
 
+        <button
+          onClick={() => handleVideoToggle('screen')}
+          className={`py-2 px-3 rounded-md text-sm transition-colors flex items-center gap-1 ${
+            localVideo.screen
+              ? 'bg-accent/20 text-accent hover:bg-accent/30'
+              : 'bg-bg-tertiary hover:bg-bg-tertiary/80 text-text-secondary'
+          }`}
+          title={localVideo.screen ? 'Stop sharing screen' : 'Share screen'}
+        >
+          {localVideo.screen ? (
+            <MonitorOff className="w-4 h-4" />
+          ) : (
+            <Monitor className="w-4 h-4" />
+          )}
+        </button>
+
+        <button
+          onClick={() => handleVideoToggle('camera')}
+          className={`py-2 px-3 rounded-md text-sm transition-colors flex items-center gap-1 ${
+            localVideo.camera
+              ? 'bg-accent/20 text-accent hover:bg-accent/30'
+              : 'bg-bg-tertiary hover:bg-bg-tertiary/80 text-text-secondary'
+          }`}
+          title={localVideo.camera ? 'Turn camera off' : 'Turn camera on'}
+        >
+          {localVideo.camera ? (
+            <VideoOff className="w-4 h-4" />
+          ) : (
+            <Video className="w-4 h-4" />
+          )}
+        </button>
+
+        {isOwner && (
+          <button
+            onClick={handleRecordingToggle}
+            className={`py-2 px-3 rounded-md text-sm transition-colors flex items-center gap-1 ${
+              recording
+                ? 'bg-red-500/20 text-red-400 hover:bg-red-500/30'
+                : 'bg-bg-tertiary hover:bg-bg-tertiary/80 text-text-secondary'
+            }`}
+            title={recording ? 'Stop recording' : 'Record channel'}
+          >
+            {recording ? (
+              <Square className="w-4 h-4" />
+            ) : (
+              <Circle className="w-4 h-4" />
+            )}
+          </button>
+        )}
+
+        {isOwner && (
+          <button
+            onClick={handlePTTModeToggle}
+            className={`py-2 px-3 rounded-md text-sm transition-colors flex items-center gap-1 ${
+              ptt
+                ? 'bg-accent/20 text-accent hover:bg-accent/30'
+                : 'bg-bg-tertiary hover:bg-bg-tertiary/80 text-text-secondary'
+            }`}
+            title={
+              pttMode === 'off'
+                ? 'Enable push-to-talk'
+                : pttMode === 'open'
+                  ? 'Push-to-talk on; switch to floor control'
+                  : 'Floor control on; turn push-to-talk off'
+            }
+          >
+            <Radio className="w-4 h-4" />
+          </button>
+        )}
+
+        {isRoomOwner && (
+          <button
+            onClick={handleAllCallToggle}
+            disabled={allCallFrom != null && !announcing}
+            className={`py-2 px-3 rounded-md text-sm transition-colors flex items-center gap-1 disabled:opacity-50 ${
+              announcing
+                ? 'bg-amber-500/20 text-amber-400 hover:bg-amber-500/30'
+                : 'bg-bg-tertiary hover:bg-bg-tertiary/80 text-text-secondary'
+            }`}
+            title={announcing ? 'End all-call' : 'All-call: talk to every channel'}
+          >
+            <Megaphone className="w-4 h-4" />
+          </button>
+        )}
+
         <button
           onClick={() => setSettingsOpen(true)}
           className="py-2 px-3 bg-bg-tertiary hover:bg-bg-tertiary/80 rounded-md text-sm transition-colors flex items-center gap-1"
@@ -5,6 +5,7 @@ import { initLocalAudio, resetLocalAudioPromise } from '../services/webrtc';
 import { decodePasswordFromLink } from '../services/crypto';
 import { Headphones, LogIn, Plus, Loader2, AlertTriangle } from 'lucide-react';
 import { AppBuildFooter } from './AppBuildFooter';
+import type { AudioProfile } from '../types';
 
 type Tab = 'create' | 'join';
 
@@ -68,6 +69,7 @@ export function LandingPage() {
   const [username, setUsername] = useState('');
   const [channelName, setChannelName] = useState('');
   const [password, setPassword] = useState('');
+  const [audioProfile, setAudioProfile] = useState<AudioProfile>('voice');
   const [inviteToken] = useState<string | null>(initialInviteState.inviteToken);
   const [invitePassword] = useState<string | null>(initialInviteState.invitePassword);
   const [rejoinTarget, setRejoinTarget] = useState<RejoinTarget | null>(null);
@@ -215,6 +217,7 @@ export function LandingPage() {
       username: username.trim(),
       channelName: channelName.trim(),
       password: password,
+      audioProfile,
     });
 
     useStore.setState({ username: username.trim() });
@@ -414,6 +417,32 @@ export function LandingPage() {
                         className="w-full px-3 py-2 bg-bg-input border border-border rounded-md text-text-primary placeholder-text-muted focus:outline-none focus:border-accent"
                       />
                     </div>
+                    <div>
+                      <label className="block text-sm text-text-secondary mb-1">
+                        Audio
+                      </label>
+                      <div className="flex gap-2">
+                        {(['voice', 'music'] as const).map((profile) => (
+                          <button
+                            key={profile}
+                            type="button"
+                            onClick={() => setAudioProfile(profile)}
+                            className={`flex-1 py-1.5 text-sm rounded-md border transition-colors ${
+                              audioProfile === profile
+                                ? 'border-accent text-accent bg-accent/10'
+                                : 'border-border text-text-secondary hover:text-text-primary'
+                            }`}
+                          >
+                            {profile === 'voice' ? 'Voice' : 'Music'}
+                          </button>
+                        ))}
+                      </div>
+                      <p className="mt-1 text-xs text-text-muted">
+                        {audioProfile === 'voice'
+                          ? 'Mono, optimized for speech'
+                          : 'Stereo at a higher bitrate, for music and streams'}
+                      </p>
+                    </div>
                     <button
                       type="submit"
                       disabled={
@@ -0,0 +1,48 @@
+import { useStore } from '../stores/useStore';
+import { send } from '../services/socket';
+import { Headphones, Check, X } from 'lucide-react';
+
+export function ListenRequestModal() {
+  const listenRequests = useStore((s) => s.listenRequests);
+  const removeListenRequest = useStore((s) => s.removeListenRequest);
+
+  const request = listenRequests[0];
+  if (!request) return null;
+
+  const answer = (accepted: boolean) => {
+    send('listen-response', { requestId: request.requestId, accepted });
+    removeListenRequest(request.requestId);
+  };
+
+  return (
+    <div className="fixed inset-0 bg-black/60 flex items-center justify-center z-100">
+      <div className="bg-bg-secondary border border-border rounded-lg p-5 max-w-sm w-full mx-4 shadow-xl">
+        <div className="flex items-center gap-2 mb-3">
+          <Headphones className="w-5 h-5 text-accent" />
+          <h3 className="text-sm font-semibold text-text-primary">Listen-in request</h3>
+        </div>
+
+        <p className="text-xs text-text-secondary mb-4">
+          <span className="text-text-primary font-medium">{request.fromName}</span> wants to listen to this
+          channel without joining it. They will hear everyone here but cannot talk. Everyone in the channel has
+          to agree.
+        </p>
+
+        <div className="flex gap-2">
+          <button
+            onClick={() => answer(true)}
+            className="flex-1 py-2 bg-accent hover:bg-accent-hover text-white text-sm font-medium rounded-md transition-colors flex items-center justify-center gap-1"
+          >
+            <Check className="w-3.5 h-3.5" /> Allow
+          </button>
+          <button
+            onClick={() => answer(false)}
+            className="flex-1 py-2 bg-bg-tertiary hover:bg-bg-tertiary/80 text-text-primary text-sm rounded-md transition-colors flex items-center justify-center gap-1"
+          >
+            <X className="w-3.5 h-3.5" /> Decline
+          </button>
+        </div>
+      </div>
+    </div>
+  );
+}
@@ -0,0 +1,58 @@
+import { useStore } from '../stores/useStore';
+import { send } from '../services/socket';
+import { Circle, Check, X } from 'lucide-react';
+
+export function RecordingConsentModal() {
+  const userId = useStore((s) => s.userId);
+  const roomId = useStore((s) => s.roomId);
+  const roomRecording = useStore((s) => s.roomRecording);
+  const currentChannelId = useStore((s) => s.currentChannelId);
+  const subChannels = useStore((s) => s.subChannels);
+  const recordingAnswers = useStore((s) => s.recordingAnswers);
+  const answerRecording = useStore((s) => s.answerRecording);
+
+  const sub = subChannels.find((c) => c.id === currentChannelId);
+  const recording = currentChannelId === roomId ? roomRecording : sub?.recording ?? null;
+
+  // Whoever starts a recording consents by doing so.
+  if (!recording || recording.startedBy === userId || recordingAnswers[recording.id]) return null;
+
+  const handleConsent = () => {
+    send('recording-consent', { recordingId: recording.id });
+    answerRecording(recording.id);
+  };
+
+  const handleDecline = () => {
+    answerRecording(recording.id);
+  };
+
+  return (
+    <div className="fixed inset-0 bg-black/60 flex items-center justify-center z-100">
+      <div className="bg-bg-secondary border border-border rounded-lg p-5 max-w-sm w-full mx-4 shadow-xl">
+        <div className="flex items-center gap-2 mb-3">
+          <Circle className="w-5 h-5 text-red-400 fill-red-400" />
+          <h3 className="text-sm font-semibold text-text-primary">This channel is being recorded</h3>
+        </div>
+
+        <p className="text-xs text-text-secondary mb-4">
+          The owner started a recording. Your voice is only recorded if you agree. If you decline, you can still listen and talk, but your audio is left out of the recording.
+        </p>
+
+        <div className="flex gap-2">
+          <button
+            onClick={handleConsent}
+            className="flex-1 py-2 bg-accent hover:bg-accent-hover text-white text-sm font-medium rounded-md transition-colors flex items-center justify-center gap-1"
+          >
+            <Check className="w-3.5 h-3.5" /> Record me
+          </button>
+          <button
+            onClick={handleDecline}
+            className="flex-1 py-2 bg-bg-tertiary hover:bg-bg-tertiary/80 text-text-primary text-sm rounded-md transition-colors flex items-center justify-center gap-1"
+          >
+            <X className="w-3.5 h-3.5" /> Decline
+          </button>
+        </div>
+      </div>
+    </div>
+  );
+}
@@ -3,6 +3,9 @@ import { UserList } from './UserList';
 import { ChatPanel } from './ChatPanel';
 import { Controls } from './Controls';
 import { InviteModal } from './InviteModal';
+import { RecordingConsentModal } from './RecordingConsentModal';
+import { ListenRequestModal } from './ListenRequestModal';
+import { VideoGrid } from './VideoGrid';
 import { SettingsPanel } from './SettingsPanel';
 import { encodePasswordForLink } from '../services/crypto';
 import { Headphones, Wifi, WifiOff, Link2, Check, Users, MessageSquare, AlertTriangle } from 'lucide-react';
@@ -16,6 +19,7 @@ type MobileTab = 'users' | 'chat';
 
 export function RoomView() {
   const roomFullName = useStore((s) => s.roomFullName);
+  const roomAudioProfile = useStore((s) => s.roomAudioProfile);
   const connected = useStore((s) => s.connected);
   const reconnecting = useStore((s) => s.reconnecting);
   const inviteToken = useStore((s) => s.inviteToken);
@@ -107,6 +111,9 @@ export function RoomView() {
             <div className="flex items-center gap-1 text-xs text-text-muted">
               <Users className="w-3 h-3" />
               <span>{users.length} online</span>
+              {roomAudioProfile === 'music' && (
+                <span className="ml-1 px-1.5 py-0.5 rounded bg-accent/10 text-accent">Music</span>
+              )}
             </div>
           </div>
         </div>
@@ -182,6 +189,7 @@ export function RoomView() {
         </div>
 
         <div className="flex-1 flex flex-col min-w-0">
+          <VideoGrid />
           <ChatPanel />
         </div>
       </div>
@@ -190,6 +198,7 @@ export function RoomView() {
       <div className="flex-1 flex flex-col md:hidden overflow-hidden">
         {mobileTab === 'users' ? (
           <>
+            <VideoGrid />
             <div className="flex-1 overflow-hidden bg-bg-secondary/50">
               <UserList />
             </div>
@@ -201,6 +210,8 @@ export function RoomView() {
       </div>
 
       <InviteModal />
+      <RecordingConsentModal />
+      <ListenRequestModal />
       <SettingsPanel />
     </div>
   );
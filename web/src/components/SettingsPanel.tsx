@@ -1,7 +1,8 @@
 import { useState, useEffect, useCallback, useRef, type ReactNode } from 'react';
 import { useStore } from '../stores/useStore';
 import { switchAudioInput, setOutputMuted, setOutputDevice, setLocalVolumeCallback } from '../services/webrtc';
-import { X, Sun, Moon, Mic, Volume2 } from 'lucide-react';
+import { send } from '../services/socket';
+import { X, Sun, Moon, Mic, Volume2, Activity } from 'lucide-react';
 import { AppBuildFooter } from './AppBuildFooter';
 
 interface AudioDevice {
@@ -24,6 +25,8 @@ export function SettingsPanel() {
   const setVoiceMode = useStore((s) => s.setVoiceMode);
   const vadThreshold = useStore((s) => s.vadThreshold);
   const setVadThreshold = useStore((s) => s.setVadThreshold);
+  const connectionStats = useStore((s) => s.connectionStats);
+  const roomId = useStore((s) => s.roomId);
 
   const [inputDevices, setInputDevices] = useState<AudioDevice[]>([]);
   const [outputDevices, setOutputDevices] = useState<AudioDevice[]>([]);
@@ -53,6 +56,14 @@ export function SettingsPanel() {
     loadDevices();
   }, [settingsOpen]);
 
+  // Poll the server for this connection's stats while the panel is open.
+  useEffect(() => {
+    if (!settingsOpen || !roomId) return;
+    send('stats', {});
+    const timer = setInterval(() => send('stats', {}), 2000);
+    return () => clearInterval(timer);
+  }, [settingsOpen, roomId]);
+
   useEffect(() => {
     if (!settingsOpen) {
       setLocalVolumeCallback(null);
@@ -217,6 +228,43 @@ export function SettingsPanel() {
               </button>
             </div>
           </SettingsCard>
+
+          {roomId && (
+            <SettingsCard
+              title="Connection"
+              description="Link quality as measured by the server"
+              icon={<Activity className="w-4 h-4" />}
+            >
+              {connectionStats ? (
+                <dl className="grid grid-cols-2 gap-x-4 gap-y-1 text-xs">
+                  <dt className="text-text-muted">Quality</dt>
+                  <dd className="text-text-primary capitalize">{connectionStats.quality}</dd>
+                  <dt className="text-text-muted">Round trip</dt>
+                  <dd className="text-text-primary">{Math.round(connectionStats.rttMs)} ms</dd>
+                  <dt className="text-text-muted">Loss up / down</dt>
+                  <dd className="text-text-primary">
+                    {(connectionStats.uplinkLoss * 100).toFixed(1)}% / {(connectionStats.downlinkLoss * 100).toFixed(1)}%
+                  </dd>
+                  <dt className="text-text-muted">Jitter up / down</dt>
+                  <dd className="text-text-primary">
+                    {Math.round(connectionStats.uplinkJitterMs)} / {Math.round(connectionStats.downlinkJitterMs)} ms
+                  </dd>
+                  <dt className="text-text-muted">Upload</dt>
+                  <dd className="text-text-primary">{Math.round(connectionStats.uplinkBitrate / 1000)} kbit/s</dd>
+                  {connectionStats.candidatePair && (
+                    <>
+                      <dt className="text-text-muted">Route</dt>
+                      <dd className="text-text-primary">
+                        {connectionStats.candidatePair.remoteType} / {connectionStats.candidatePair.protocol}
+                      </dd>
+                    </>
+                  )}
+                </dl>
+              ) : (
+                <p className="text-xs text-text-muted">No media connection yet.</p>
+              )}
+            </SettingsCard>
+          )}
         </div>
 
         <div className="px-5 py-3 border-t border-border bg-bg-primary/35">
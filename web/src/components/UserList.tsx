@@ -2,11 +2,11 @@ import { useStore } from '../stores/useStore';
 import { send } from '../services/socket';
 import {
   setUserVolume as setWebRTCUserVolume,
-  subscribeVolumeCallback,
   subscribeVoiceTransmissionCallback,
 } from '../services/webrtc';
-import { MicOff, Volume2, VolumeX } from 'lucide-react';
+import { Ear, Headphones, HeadphoneOff, MicOff, Monitor, SignalLow, SignalMedium, Video, Volume2, VolumeX } from 'lucide-react';
 import { useState, useRef, useEffect } from 'react';
+import type { Quality } from '../types';
 
 interface ContextMenuState {
   x: number;
@@ -51,18 +51,21 @@ export function UserList() {
   const currentChannelId = useStore((s) => s.currentChannelId);
   const roomId = useStore((s) => s.roomId);
   const myUserId = useStore((s) => s.userId);
+  const roomOwnerId = useStore((s) => s.roomOwnerId);
   const outputMuted = useStore((s) => s.outputMuted);
   const userVolumes = useStore((s) => s.userVolumes);
   const storeSetUserVolume = useStore((s) => s.setUserVolume);
+  const talkingUsers = useStore((s) => s.speakers);
+  const whisperTargets = useStore((s) => s.whisperTargets);
+  const toggleWhisperTarget = useStore((s) => s.toggleWhisperTarget);
+  const whispersFrom = useStore((s) => s.whispersFrom);
   const [contextMenu, setContextMenu] = useState<ContextMenuState | null>(null);
   const [inviteNameInput, setInviteNameInput] = useState(false);
   const [channelName, setChannelName] = useState('');
-  const [talkingUsers, setTalkingUsers] = useState<Record<string, boolean>>({});
   const [localTalking, setLocalTalking] = useState(false);
   const menuRef = useRef<HTMLDivElement>(null);
   const longPressTimer = useRef<ReturnType<typeof setTimeout> | null>(null);
   const touchStartPos = useRef<{ x: number; y: number } | null>(null);
-  const recentSpeechAt = useRef<Record<string, number>>({});
 
   useEffect(() => {
     const handler = () => {
@@ -73,46 +76,6 @@ export function UserList() {
     return () => document.removeEventListener('click', handler);
   }, []);
 
-  useEffect(() => {
-    const unsubscribe = subscribeVolumeCallback((volumes) => {
-      const now = performance.now();
-      const speakingThreshold = 18;
-      const holdMs = 240;
-
-      for (const [streamId, level] of volumes) {
-        if (!streamId.startsWith('stream-')) continue;
-        const userId = streamId.slice(7);
-        if (level >= speakingThreshold) {
-          recentSpeechAt.current[userId] = now;
-        }
-      }
-
-      const nextTalking: Record<string, boolean> = {};
-      for (const [userId, ts] of Object.entries(recentSpeechAt.current)) {
-        if (now - ts <= holdMs) {
-          nextTalking[userId] = true;
-        } else {
-          delete recentSpeechAt.current[userId];
-        }
-      }
-
-      setTalkingUsers((prev) => {
-        const prevIds = Object.keys(prev);
-        const nextIds = Object.keys(nextTalking);
-        if (prevIds.length === nextIds.length && nextIds.every((id) => prev[id])) {
-          return prev;
-        }
-        return nextTalking;
-      });
-    });
-
-    return () => {
-      unsubscribe();
-      recentSpeechAt.current = {};
-      setTalkingUsers({});
-    };
-  }, []);
-
   useEffect(() => {
     const unsubscribe = subscribeVoiceTransmissionCallback((active) => {
       setLocalTalking((prev) => (prev === active ? prev : active));
@@ -196,6 +159,20 @@ export function UserList() {
     send('move-to-sub', { subChannelId: subId });
   };
 
+  const handleListenToggle = (e: React.MouseEvent, subId: string, listening: boolean) => {
+    e.stopPropagation();
+    if (listening) {
+      send('listen-stop', {});
+    } else {
+      send('listen-start', { channelId: subId });
+    }
+  };
+
+  const handleForceMute = (targetUserId: string, muted: boolean) => {
+    send('force-mute', { targetUserId, muted });
+    setContextMenu(null);
+  };
+
   const handleVolumeChange = (userId: string, volume: number) => {
     storeSetUserVolume(userId, volume);
     setWebRTCUserVolume(userId, volume);
@@ -204,6 +181,14 @@ export function UserList() {
   const contextTargetInMain = contextMenu
     ? users.find((u) => u.id === contextMenu.userId && !u.inSubChannel)
     : null;
+  const contextTargetSub = contextMenu
+    ? subChannels.find((c) => c.users.some((u) => u.id === contextMenu.userId))
+    : undefined;
+  const contextTarget = contextTargetInMain ?? contextTargetSub?.users.find((u) => u.id === contextMenu?.userId);
+  // Mirrors the server: the room owner can mute anyone, a sub-channel's
+  // owner only its members, and nobody but the owner can mute the owner.
+  const canForceMute = !!contextTarget && contextTarget.id !== roomOwnerId &&
+    (roomOwnerId === myUserId || contextTargetSub?.ownerId === myUserId);
 
   return (
     <div className="flex flex-col h-full">
@@ -247,7 +232,11 @@ export function UserList() {
                     }}
                     title={talking ? 'Talking' : 'Not talking'}
                   />
-                  {user.muted && <MicOff className="w-4 h-4 text-text-muted" />}
+                  {user.publishing?.includes('screen') && <Monitor className="w-4 h-4 text-accent" />}
+                  {user.publishing?.includes('camera') && <Video className="w-4 h-4 text-accent" />}
+                  <QualityIcon quality={user.quality} className="w-4 h-4" />
+                  <WhisperIcon target={whisperTargets.includes(user.id)} from={!!whispersFrom[user.id]} className="w-4 h-4" />
+                  {(user.muted || user.forceMuted) && <MicOff className="w-4 h-4 text-text-muted" />}
                   {speakerMuted && <VolumeX className="w-4 h-4 text-text-muted" />}
                 </div>
                 <span className="flex-1 min-w-0 text-sm text-text-primary truncate">
@@ -263,6 +252,8 @@ export function UserList() {
 
         {subChannels.map((sub) => {
           const isCurrentSub = currentChannelId === sub.id;
+          const listening = !!myUserId && (sub.listeners ?? []).includes(myUserId);
+          const listenerNames = (sub.listeners ?? []).map((id) => users.find((u) => u.id === id)?.name ?? 'Someone');
 
           return (
             <div key={sub.id} className="mb-2">
@@ -280,7 +271,24 @@ export function UserList() {
                   }`}>
                     {sub.name || 'Private'}
                   </span>
+                  {!isCurrentSub && (
+                    <button
+                      onClick={(e) => handleListenToggle(e, sub.id, listening)}
+                      className={`p-0.5 rounded transition-colors ${
+                        listening ? 'text-accent hover:text-accent-hover' : 'text-text-muted hover:text-text-secondary'
+                      }`}
+                      title={listening ? 'Stop listening' : 'Listen in'}
+                    >
+                      {listening ? <HeadphoneOff className="w-3.5 h-3.5" /> : <Headphones className="w-3.5 h-3.5" />}
+                    </button>
+                  )}
                 </div>
+                {listenerNames.length > 0 && (
+                  <div className="mt-0.5 flex items-center gap-1 text-xs text-text-muted" title="Hearing this channel without being in it">
+                    <Headphones className="w-3 h-3" />
+                    <span className="truncate">Listening: {listenerNames.join(', ')}</span>
+                  </div>
+                )}
                 {sub.expiresAt && (
                   <div className="mt-1">
                     <SubCountdownTimer expiresAt={sub.expiresAt} />
@@ -317,7 +325,11 @@ export function UserList() {
                         }}
                         title={talking ? 'Talking' : 'Not talking'}
                       />
-                      {user.muted && <MicOff className="w-3.5 h-3.5 text-text-muted" />}
+                      {user.publishing?.includes('screen') && <Monitor className="w-3.5 h-3.5 text-accent" />}
+                      {user.publishing?.includes('camera') && <Video className="w-3.5 h-3.5 text-accent" />}
+                      <QualityIcon quality={user.quality} className="w-3.5 h-3.5" />
+                      <WhisperIcon target={whisperTargets.includes(user.id)} from={!!whispersFrom[user.id]} className="w-3.5 h-3.5" />
+                      {(user.muted || user.forceMuted) && <MicOff className="w-3.5 h-3.5 text-text-muted" />}
                       {speakerMuted && <VolumeX className="w-3.5 h-3.5 text-text-muted" />}
                     </div>
                     <span className="flex-1 min-w-0 text-sm text-text-secondary truncate">
@@ -358,6 +370,22 @@ export function UserList() {
             />
           </div>
 
+          <button
+            onClick={() => toggleWhisperTarget(contextMenu.userId)}
+            className="w-full px-4 py-2 text-sm text-text-primary hover:bg-bg-tertiary text-left"
+          >
+            {whisperTargets.includes(contextMenu.userId) ? 'Remove from Whisper' : 'Add to Whisper'}
+          </button>
+
+          {canForceMute && contextTarget && (
+            <button
+              onClick={() => handleForceMute(contextTarget.id, !contextTarget.forceMuted)}
+              className="w-full px-4 py-2 text-sm text-text-primary hover:bg-bg-tertiary text-left"
+            >
+              {contextTarget.forceMuted ? 'Allow to Speak' : 'Force Mute'}
+            </button>
+          )}
+
           {isInMainChannel && contextTargetInMain && (
             <>
               {!inviteNameInput ? (
@@ -393,3 +421,43 @@ export function UserList() {
     </div>
   );
 }
+
+// QualityIcon flags users whose connection is fair or poor; good
+// connections show nothing.
+function QualityIcon({ quality, className }: { quality?: Quality; className: string }) {
+  if (quality === 'fair') {
+    return (
+      <span title="Fair connection">
+        <SignalMedium className={`${className} text-yellow-400`} />
+      </span>
+    );
+  }
+  if (quality === 'poor') {
+    return (
+      <span title="Poor connection">
+        <SignalLow className={`${className} text-red-400`} />
+      </span>
+    );
+  }
+  return null;
+}
+
+// WhisperIcon marks users who are whispering to you and the users you
+// whisper to.
+function WhisperIcon({ target, from, className }: { target: boolean; from: boolean; className: string }) {
+  if (from) {
+    return (
+      <span title="Whispering to you">
+        <Ear className={`${className} text-purple-400 animate-pulse`} />
+      </span>
+    );
+  }
+  if (target) {
+    return (
+      <span title="In your whisper group">
+        <Ear className={`${className} text-accent`} />
+      </span>
+    );
+  }
+  return null;
+}
@@ -0,0 +1,49 @@
+import { useEffect, useRef } from 'react';
+import { useStore } from '../stores/useStore';
+import { Monitor, Video } from 'lucide-react';
+
+function VideoTile({ streamId, stream }: { streamId: string; stream: MediaStream }) {
+  const users = useStore((s) => s.users);
+  const videoRef = useRef<HTMLVideoElement>(null);
+
+  useEffect(() => {
+    if (videoRef.current) {
+      videoRef.current.srcObject = stream;
+    }
+  }, [stream]);
+
+  const isScreen = streamId.startsWith('screen-');
+  const userId = streamId.substring(streamId.indexOf('-') + 1);
+  const name = users.find((u) => u.id === userId)?.name ?? 'Unknown';
+
+  return (
+    <div className="relative bg-black rounded-md overflow-hidden aspect-video">
+      <video
+        ref={videoRef}
+        autoPlay
+        playsInline
+        muted
+        className="w-full h-full object-contain"
+      />
+      <div className="absolute bottom-1 left-1 flex items-center gap-1 px-1.5 py-0.5 rounded bg-black/60 text-xs text-white">
+        {isScreen ? <Monitor className="w-3 h-3" /> : <Video className="w-3 h-3" />}
+        <span className="truncate max-w-40">{name}</span>
+      </div>
+    </div>
+  );
+}
+
+export function VideoGrid() {
+  const videoStreams = useStore((s) => s.videoStreams);
+  const entries = Object.entries(videoStreams);
+
+  if (entries.length === 0) return null;
+
+  return (
+    <div className="grid grid-cols-1 lg:grid-cols-2 gap-2 p-2 border-b border-border/40 max-h-[60%] overflow-y-auto">
+      {entries.map(([streamId, stream]) => (
+        <VideoTile key={streamId} streamId={streamId} stream={stream} />
+      ))}
+    </div>
+  );
+}
@@ -1,5 +1,5 @@
 import { useStore } from '../stores/useStore';
-import { handleOffer, handleCandidate as handleRTCCandidate, initLocalAudio, ensureAudioContext, resetLocalAudioPromise, isLocalAudioReady, closeWebRTC } from './webrtc';
+import { handleOffer, handleCandidate as handleRTCCandidate, initLocalAudio, ensureAudioContext, resetLocalAudioPromise, isLocalAudioReady, closeWebRTC, setICEServers, setLastNSlots, setAllCall } from './webrtc';
 import { deriveRoomKey, decryptMessage, exportKey, storeRoomKey, importKey, getRoomKey } from './crypto';
 import type {
   WelcomePayload,
@@ -10,6 +10,17 @@ import type {
   CandidatePayload,
   InviteReqPayload,
   InviteExpiredPayload,
+  ServerShutdownPayload,
+  RemovedPayload,
+  SpeakingPayload,
+  LastNPayload,
+  ForceMutePayload,
+  QualityPayload,
+  ConnectionStats,
+  WhisperPayload,
+  AllCallPayload,
+  ListenRequestPayload,
+  RecordingStoppedPayload,
 } from '../types';
 import type { User } from '../types';
 
@@ -17,6 +28,7 @@ let ws: WebSocket | null = null;
 let reconnectAttempts = 0;
 let reconnectTimer: ReturnType<typeof setTimeout> | null = null;
 let pendingSessionFallback: { username: string; inviteToken: string } | null = null;
+let shutdownReconnectDelay: number | null = null;
 
 let sessionChannel: BroadcastChannel | null = null;
 
@@ -155,7 +167,8 @@ function scheduleReconnect(): void {
   if (reconnectTimer) return;
 
   reconnectAttempts++;
-  const delay = getReconnectDelay();
+  const delay = shutdownReconnectDelay ?? getReconnectDelay();
+  shutdownReconnectDelay = null;
   const store = useStore.getState();
   store.setReconnecting(true);
 
@@ -167,6 +180,7 @@ function scheduleReconnect(): void {
 
 export function disconnect(): void {
   pendingSessionFallback = null;
+  shutdownReconnectDelay = null;
   if (reconnectTimer) {
     clearTimeout(reconnectTimer);
     reconnectTimer = null;
@@ -193,6 +207,7 @@ function handleMessage(type: string, payload: unknown): void {
   switch (type) {
     case 'welcome': {
       const p = payload as WelcomePayload;
+      setICEServers(p.iceServers);
       store.setUser(p.userId, p.sessionToken, store.username);
       store.setRoomState({
         id: p.roomState.id,
@@ -200,8 +215,14 @@ function handleMessage(type: string, payload: unknown): void {
         fullName: p.roomState.fullName,
         currentChannelId: p.roomState.currentChannelId,
         inviteToken: p.inviteToken,
+        ownerId: p.roomState.ownerId,
+        audioProfile: p.roomState.audioProfile,
       });
       store.updateUsers(p.roomState.users, p.roomState.subChannels);
+      store.setRoomRecording(p.roomState.recording ?? null);
+      store.setRoomPTT(p.roomState.ptt ?? null);
+      store.setAllCallFrom(p.roomState.allCall ?? null);
+      setAllCall(p.roomState.allCall ?? null);
 
       localStorage.setItem('sessionToken', p.sessionToken);
       localStorage.setItem('qvoch-session-token', p.sessionToken);
@@ -265,6 +286,14 @@ function handleMessage(type: string, payload: unknown): void {
       const p = payload as ErrorPayload;
       console.error(`Server error [${p.code}]: ${p.message}`);
 
+      // Errors are not tied to requests; stop transmitting for a whisper the
+      // server may have rejected rather than talk to the whole channel, and
+      // end it on the server in case it was started after all.
+      if (store.whispering) {
+        store.setWhispering(false);
+        send('whisper-stop', {});
+      }
+
       if (
         pendingSessionFallback
         && (p.code === 'INVALID_MESSAGE' || p.code === 'CHANNEL_NOT_FOUND')
@@ -276,6 +305,12 @@ function handleMessage(type: string, payload: unknown): void {
         break;
       }
 
+      if (p.retryAfterMs && p.retryAfterMs > 0) {
+        const seconds = Math.ceil(p.retryAfterMs / 1000);
+        store.addToast(`Error: ${p.message} (retry in ${seconds}s)`);
+        break;
+      }
+
       store.addToast(`Error: ${p.message}`);
       break;
     }
@@ -284,6 +319,8 @@ function handleMessage(type: string, payload: unknown): void {
       const p = payload as RoomUpdatePayload;
       const prevUsers = store.users;
       store.updateUsers(p.users, p.subChannels);
+      store.setRoomRecording(p.recording ?? null);
+      store.setRoomPTT(p.ptt ?? null);
 
       detectJoinLeave(prevUsers, p.users, store.userId);
 
@@ -302,6 +339,65 @@ function handleMessage(type: string, payload: unknown): void {
       break;
     }
 
+    case 'force-mute': {
+      const p = payload as ForceMutePayload;
+      const fallback = p.muted
+        ? 'You were muted by a moderator.'
+        : 'A moderator unmuted you.';
+      store.addToast(p.message || fallback);
+      break;
+    }
+
+    case 'last-n': {
+      const p = payload as LastNPayload;
+      if (p.channelId === store.currentChannelId) {
+        setLastNSlots(p.slots);
+      }
+      break;
+    }
+
+    case 'speaking': {
+      const p = payload as SpeakingPayload;
+      if (p.channelId === store.currentChannelId) {
+        store.setSpeakers(p.speakers);
+      }
+      break;
+    }
+
+    case 'quality': {
+      const p = payload as QualityPayload;
+      store.setQuality(p.peers);
+      break;
+    }
+
+    case 'whisper': {
+      const p = payload as WhisperPayload;
+      store.setWhisperFrom(p.from, p.active);
+      break;
+    }
+
+    case 'whisper-ended': {
+      // Everyone we whispered to left; stop transmitting rather than talk
+      // to the whole channel.
+      if (store.whispering) {
+        store.setWhispering(false);
+        store.addToast('Whisper ended: nobody you whispered to is here anymore.');
+      }
+      break;
+    }
+
+    case 'all-call': {
+      const p = payload as AllCallPayload;
+      store.setAllCallFrom(p.active ? p.from : null);
+      setAllCall(p.active ? p.from : null);
+      break;
+    }
+
+    case 'stats': {
+      store.setConnectionStats(payload as ConnectionStats);
+      break;
+    }
+
     case 'chat': {
       const msg = payload as ChatMessage;
       const channelId = msg.channelId || store.currentChannelId;
@@ -354,7 +450,7 @@ function handleMessage(type: string, payload: unknown): void {
 
     case 'offer': {
       const p = payload as OfferPayload;
-      handleOffer(p.sdp, p.reset, p.seq, p.epoch);
+      handleOffer(p.sdp, p.reset, p.seq, p.epoch, p.video);
       break;
     }
 
@@ -375,6 +471,23 @@ function handleMessage(type: string, payload: unknown): void {
       break;
     }
 
+    case 'listen-request': {
+      const p = payload as ListenRequestPayload;
+      store.addListenRequest(p);
+      // The server denies requests that are not answered within 30s.
+      setTimeout(() => useStore.getState().removeListenRequest(p.requestId), 30000);
+      break;
+    }
+
+    case 'recording-stopped': {
+      const p = payload as RecordingStoppedPayload;
+      store.addRecordingDownload(p);
+      store.addToast(`Recording of ${p.channelName} finished`);
+      // The server only honors the download link for 15 minutes.
+      setTimeout(() => useStore.getState().removeRecordingDownload(p.recordingId), 15 * 60 * 1000);
+      break;
+    }
+
     case 'invite-expired': {
       const p = payload as InviteExpiredPayload;
       const pending = store.pendingInvite;
@@ -384,6 +497,36 @@ function handleMessage(type: string, payload: unknown): void {
       break;
     }
 
+    case 'server-shutdown': {
+      const p = payload as ServerShutdownPayload;
+      // Spread reconnects so a restarting server isn't hit by every client at once.
+      shutdownReconnectDelay = Math.max(0, p.reconnectAfterMs) + Math.floor(Math.random() * 1000);
+      if (store.roomId) {
+        store.addToast('Server is restarting, reconnecting shortly...');
+      }
+      break;
+    }
+
+    case 'removed': {
+      const p = payload as RemovedPayload;
+      if (p.reason === 'channel-closed') {
+        // The server moves us back to the main channel; stay connected.
+        store.addToast(p.message || 'This sub-channel was closed by an administrator.');
+        break;
+      }
+      const fallback = p.reason === 'kicked'
+        ? 'You were removed from the room by an administrator.'
+        : 'This room was closed by an administrator.';
+      closeWebRTC();
+      disconnect();
+      clearPersistedRejoinState();
+      sessionStorage.removeItem('qvoch-password');
+      store.reset();
+      useStore.getState().addToast(p.message || fallback);
+      window.location.hash = '#/';
+      break;
+    }
+
     case '__internal_probe': break;
   }
 }
@@ -1,12 +1,19 @@
 import { send } from './socket';
 import { useStore } from '../stores/useStore';
+import type { VideoSource } from '../types';
 
-const rtcConfig: RTCConfiguration = {
-  iceServers: [
-    { urls: 'stun:stun.l.google.com:19302' },
-    { urls: 'stun:stun1.l.google.com:19302' },
-  ],
-};
+const DEFAULT_ICE_SERVERS: RTCIceServer[] = [
+  { urls: 'stun:stun.l.google.com:19302' },
+  { urls: 'stun:stun1.l.google.com:19302' },
+];
+
+// Replaced by the list from the server's welcome message so both ends use
+// the same STUN/TURN servers (including per-session TURN credentials).
+let iceServers: RTCIceServer[] = DEFAULT_ICE_SERVERS;
+
+export function setICEServers(servers: RTCIceServer[] | undefined): void {
+  iceServers = servers ?? DEFAULT_ICE_SERVERS;
+}
 
 let pc: RTCPeerConnection | null = null;
 let localStream: MediaStream | null = null;
@@ -17,6 +24,8 @@ let localManualMuted = false;
 let localVoiceGateOpen = true;
 
 const MAX_USER_VOLUME_MULTIPLIER = 2;
+// Gain applied to everyone but the announcer during an all-call.
+const ALL_CALL_DUCK_GAIN = 0.3;
 
 type PendingCandidate = {
   ice: RTCIceCandidateInit;
@@ -41,10 +50,20 @@ type RemoteStreamEntry = {
   sourceNode: MediaStreamAudioSourceNode | null;
   outputNode: MediaStreamAudioDestinationNode | null;
   userGain: number;
+  ducked: boolean;
 };
 
 const remoteStreams = new Map<string, RemoteStreamEntry>();
 
+// Local screen share and camera tracks, and the transceivers the server
+// offered for them (keyed by source via the offer's mid map).
+const localVideo = new Map<VideoSource, MediaStreamTrack>();
+const videoTransceivers = new Map<VideoSource, RTCRtpTransceiver>();
+
+// In last-N channels the server forwards speakers over a fixed set of slot
+// streams ("slot-<n>"); this maps each slot stream to the user it carries.
+const slotUsers = new Map<string, string>();
+
 type VolumeCallback = (volumes: Map<string, number>) => void;
 const volumeCallbacks = new Set<VolumeCallback>();
 let volumeAnimFrame: number | null = null;
@@ -120,12 +139,20 @@ function applyAudioOutputDevice(audio: HTMLAudioElement, deviceId: string | null
 
 function setEntryGain(entry: RemoteStreamEntry, gain: number): void {
   entry.userGain = clamp(gain, 0, MAX_USER_VOLUME_MULTIPLIER);
+  const effective = entry.userGain * (entry.ducked ? ALL_CALL_DUCK_GAIN : 1);
   if (entry.gainNode) {
-    entry.gainNode.gain.value = entry.userGain;
+    entry.gainNode.gain.value = effective;
     entry.audio.volume = 1;
     return;
   }
-  entry.audio.volume = clamp(entry.userGain, 0, 1);
+  entry.audio.volume = clamp(effective, 0, 1);
+}
+
+// User whose all-call is running; everyone else is ducked while it lasts.
+let allCallFrom: string | null = null;
+
+function isDucked(streamId: string): boolean {
+  return allCallFrom != null && extractUserIdFromStreamId(streamId) !== allCallFrom;
 }
 
 function buildRemoteAudioGraph(entry: RemoteStreamEntry, stream: MediaStream): void {
@@ -168,6 +195,7 @@ function configureRemoteEntry(entry: RemoteStreamEntry, streamId: string, stream
   const userId = extractUserIdFromStreamId(streamId);
   const { userVolumes, outputMuted, audioOutputDeviceId } = useStore.getState();
   const volumePct = userId && userVolumes[userId] != null ? userVolumes[userId] : 100;
+  entry.ducked = isDucked(streamId);
   setEntryGain(entry, volumePercentToGain(volumePct));
   entry.audio.muted = outputMuted;
   applyAudioOutputDevice(entry.audio, audioOutputDeviceId);
@@ -255,7 +283,13 @@ export function ensureAudioContext(): void {
   }
 }
 
-export function handleOffer(sdp: string, reset: boolean | undefined, seq: number, epoch: number): void {
+export function handleOffer(
+  sdp: string,
+  reset: boolean | undefined,
+  seq: number,
+  epoch: number,
+  video?: Record<string, VideoSource>,
+): void {
   offerQueue = offerQueue
     .then(async () => {
       if (reset) {
@@ -277,7 +311,7 @@ export function handleOffer(sdp: string, reset: boolean | undefined, seq: number
         return;
       }
 
-      await processOffer(sdp, !!reset, seq);
+      await processOffer(sdp, !!reset, seq, video);
       lastProcessedSeq = seq;
     })
     .catch((err) => {
@@ -285,7 +319,12 @@ export function handleOffer(sdp: string, reset: boolean | undefined, seq: number
     });
 }
 
-async function processOffer(sdp: string, reset: boolean, seq: number): Promise<void> {
+async function processOffer(
+  sdp: string,
+  reset: boolean,
+  seq: number,
+  video: Record<string, VideoSource> | undefined,
+): Promise<void> {
   const canReuse = !reset
     && pc !== null
     && pc.connectionState !== 'failed'
@@ -303,6 +342,7 @@ async function processOffer(sdp: string, reset: boolean, seq: number): Promise<v
 
   try {
     await currentPc.setRemoteDescription(offer);
+    await attachLocalVideo(currentPc, video);
 
     const pendingForCurrent = pendingCandidates.filter((item) => item.epoch === currentEpoch);
     pendingCandidates = pendingCandidates.filter((item) => item.epoch !== currentEpoch);
@@ -319,6 +359,14 @@ async function processOffer(sdp: string, reset: boolean, seq: number): Promise<v
     if (currentPc.localDescription) {
       send('answer', { sdp: currentPc.localDescription.sdp, seq, epoch: currentEpoch });
     }
+
+    // A new PeerConnection on the server has no video transceivers; ask
+    // again for every source that is still being shared.
+    if (!canReuse) {
+      for (const source of localVideo.keys()) {
+        send('publish-video', { source, enabled: true });
+      }
+    }
   } catch (err) {
     console.error('Failed to handle offer:', err);
   }
@@ -375,8 +423,10 @@ function createPeerConnection(): void {
     entry.outputNode?.disconnect();
   }
   remoteStreams.clear();
+  videoTransceivers.clear();
+  useStore.getState().clearVideoStreams();
 
-  pc = new RTCPeerConnection(rtcConfig);
+  pc = new RTCPeerConnection({ iceServers });
 
   if (localStream) {
     for (const track of localStream.getAudioTracks()) {
@@ -400,11 +450,17 @@ function createPeerConnection(): void {
     const stream = event.streams[0] || new MediaStream([event.track]);
     const streamId = stream.id;
 
+    if (event.track.kind === 'video') {
+      attachRemoteVideo(event.track, stream);
+      return;
+    }
+
     if (remoteStreams.has(streamId)) {
       const existing = remoteStreams.get(streamId)!;
       configureRemoteEntry(existing, streamId, stream);
 
       attachTrackLifecycle(event.track, streamId);
+      attachStreamLifecycle(stream, streamId);
       return;
     }
 
@@ -417,11 +473,13 @@ function createPeerConnection(): void {
       sourceNode: null,
       outputNode: null,
       userGain: 1,
+      ducked: false,
     };
 
     configureRemoteEntry(entry, streamId, stream);
     remoteStreams.set(streamId, entry);
     attachTrackLifecycle(event.track, streamId);
+    attachStreamLifecycle(stream, streamId);
 
     if (!volumeAnimFrame) {
       startVolumeMonitoring();
@@ -433,27 +491,144 @@ function createPeerConnection(): void {
   };
 }
 
+// Screen shares and cameras arrive as "screen-<userId>" and
+// "camera-<userId>" streams and are rendered by the video grid.
+function attachRemoteVideo(track: MediaStreamTrack, stream: MediaStream): void {
+  const { setVideoStream } = useStore.getState();
+  setVideoStream(stream.id, stream);
+  const release = () => {
+    if (track.readyState === 'ended' || !stream.getTracks().includes(track)) {
+      useStore.getState().setVideoStream(stream.id, null);
+    }
+  };
+  track.onended = release;
+  stream.onremovetrack = release;
+}
+
+// attachLocalVideo binds local capture tracks to the video transceivers the
+// server offered for them. They send only; the server never sends video back
+// on these m-lines.
+async function attachLocalVideo(
+  currentPc: RTCPeerConnection,
+  video: Record<string, VideoSource> | undefined,
+): Promise<void> {
+  if (!video) return;
+  for (const [mid, source] of Object.entries(video)) {
+    const transceiver = currentPc.getTransceivers().find((t) => t.mid === mid);
+    if (!transceiver) continue;
+    videoTransceivers.set(source, transceiver);
+    transceiver.direction = 'sendonly';
+    await transceiver.sender.replaceTrack(localVideo.get(source) ?? null);
+  }
+}
+
+export async function startVideo(source: VideoSource): Promise<void> {
+  if (localVideo.has(source)) return;
+
+  const stream = source === 'screen'
+    ? await navigator.mediaDevices.getDisplayMedia({ video: true })
+    : await navigator.mediaDevices.getUserMedia({ video: true });
+  const track = stream.getVideoTracks()[0];
+  if (!track) return;
+
+  if (source === 'screen') {
+    track.contentHint = 'detail';
+  }
+  // Ending the share from the browser's own UI stops publishing too.
+  track.onended = () => stopVideo(source);
+
+  localVideo.set(source, track);
+  useStore.getState().setLocalVideo(source, true);
+
+  const transceiver = videoTransceivers.get(source);
+  if (transceiver) {
+    await transceiver.sender.replaceTrack(track);
+  }
+  send('publish-video', { source, enabled: true });
+}
+
+export function stopVideo(source: VideoSource): void {
+  const track = localVideo.get(source);
+  if (!track) return;
+
+  track.onended = null;
+  track.stop();
+  localVideo.delete(source);
+  useStore.getState().setLocalVideo(source, false);
+
+  videoTransceivers.get(source)?.sender.replaceTrack(null).catch(() => {});
+  send('publish-video', { source, enabled: false });
+}
+
 function attachTrackLifecycle(track: MediaStreamTrack, streamId: string): void {
-  track.onended = () => {
-    const entry = remoteStreams.get(streamId);
-    if (entry) {
-      entry.audio.pause();
-      entry.audio.srcObject = null;
-      entry.sourceNode?.disconnect();
-      entry.gainNode?.disconnect();
-      entry.outputNode?.disconnect();
-      remoteStreams.delete(streamId);
+  track.onended = () => releaseRemoteStream(streamId);
+}
+
+// The server keeps one PeerConnection across channel moves and detaches
+// senders of users who are no longer audible, which removes their tracks
+// from the stream instead of ending them.
+function attachStreamLifecycle(stream: MediaStream, streamId: string): void {
+  stream.onremovetrack = () => {
+    if (stream.getTracks().length === 0) {
+      releaseRemoteStream(streamId);
     }
   };
 }
 
+function releaseRemoteStream(streamId: string): void {
+  const entry = remoteStreams.get(streamId);
+  if (entry) {
+    entry.audio.pause();
+    entry.audio.srcObject = null;
+    entry.sourceNode?.disconnect();
+    entry.gainNode?.disconnect();
+    entry.outputNode?.disconnect();
+    remoteStreams.delete(streamId);
+  }
+}
+
 function extractUserIdFromStreamId(streamId: string): string | null {
   if (streamId.startsWith('stream-')) {
     return streamId.substring(7);
   }
+  if (streamId.startsWith('slot-')) {
+    return slotUsers.get(streamId) ?? null;
+  }
+  if (streamId.startsWith('whisper-')) {
+    return streamId.substring(8);
+  }
   return null;
 }
 
+export function setLastNSlots(slots: string[]): void {
+  slotUsers.clear();
+  slots.forEach((userId, i) => {
+    if (userId) {
+      slotUsers.set(`slot-${i}`, userId);
+    }
+  });
+
+  // Per-user volume follows the speaker as it moves between slots.
+  const { userVolumes } = useStore.getState();
+  for (const [streamId, entry] of remoteStreams) {
+    if (!streamId.startsWith('slot-')) continue;
+    const userId = slotUsers.get(streamId);
+    const volumePct = userId && userVolumes[userId] != null ? userVolumes[userId] : 100;
+    entry.ducked = isDucked(streamId);
+    setEntryGain(entry, volumePercentToGain(volumePct));
+  }
+}
+
+// setAllCall ducks every remote voice but from's while an all-call runs;
+// null restores them.
+export function setAllCall(from: string | null): void {
+  allCallFrom = from;
+  for (const [streamId, entry] of remoteStreams) {
+    entry.ducked = isDucked(streamId);
+    setEntryGain(entry, entry.userGain);
+  }
+}
+
 function startVolumeMonitoring(): void {
   const check = () => {
     if (volumeCallbacks.size > 0 && remoteStreams.size > 0) {
@@ -505,10 +680,10 @@ export function setOutputDevice(deviceId: string): void {
 }
 
 export function setUserVolume(userId: string, volume: number): void {
-  const streamId = `stream-${userId}`;
-  const entry = remoteStreams.get(streamId);
-  if (entry) {
-    setEntryGain(entry, volumePercentToGain(volume));
+  for (const [streamId, entry] of remoteStreams) {
+    if (extractUserIdFromStreamId(streamId) === userId) {
+      setEntryGain(entry, volumePercentToGain(volume));
+    }
   }
 }
 
@@ -545,6 +720,19 @@ export function closeWebRTC(): void {
     entry.outputNode?.disconnect();
   }
   remoteStreams.clear();
+  slotUsers.clear();
+  allCallFrom = null;
+
+  for (const track of localVideo.values()) {
+    track.onended = null;
+    track.stop();
+  }
+  localVideo.clear();
+  videoTransceivers.clear();
+  const store = useStore.getState();
+  store.clearVideoStreams();
+  store.setLocalVideo('screen', false);
+  store.setLocalVideo('camera', false);
 
   if (pc) {
     pc.close();
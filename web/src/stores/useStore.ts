@@ -1,5 +1,5 @@
 import { create } from 'zustand';
-import type { User, SubChannel, ChatMessage, InviteRequest } from '../types';
+import type { User, SubChannel, ChatMessage, InviteRequest, RecordingInfo, VideoSource, AudioProfile, Quality, ConnectionStats, PTTInfo, ListenRequestPayload, RecordingStoppedPayload } from '../types';
 
 export type Theme = 'dark' | 'light';
 export type VoiceMode = 'vad' | 'ptt';
@@ -21,12 +21,25 @@ interface AppState {
   roomName: string | null;
   roomFullName: string | null;
   inviteToken: string | null;
+  roomOwnerId: string | null;
+  roomAudioProfile: AudioProfile;
   currentChannelId: string | null;
   password: string | null;
   e2eKey: CryptoKey | null;
 
   users: User[];
   subChannels: SubChannel[];
+  speakers: Record<string, boolean>;
+  connectionStats: ConnectionStats | null;
+  roomRecording: RecordingInfo | null;
+  roomPTT: PTTInfo | null;
+  whisperTargets: string[];
+  whispering: boolean;
+  whispersFrom: Record<string, boolean>;
+  allCallFrom: string | null;
+  recordingAnswers: Record<string, boolean>;
+  videoStreams: Record<string, MediaStream>;
+  localVideo: Partial<Record<VideoSource, boolean>>;
 
   chatMessages: Record<string, ChatMessage[]>;
 
@@ -35,6 +48,8 @@ interface AppState {
   outputMuted: boolean;
   settingsOpen: boolean;
   pendingInvite: InviteRequest | null;
+  listenRequests: ListenRequestPayload[];
+  recordingDownloads: RecordingStoppedPayload[];
   toasts: Toast[];
 
   userVolumes: Record<string, number>;
@@ -55,16 +70,35 @@ interface AppState {
     fullName: string;
     currentChannelId: string;
     inviteToken: string;
+    ownerId?: string;
+    audioProfile?: AudioProfile;
   }) => void;
   setPassword: (password: string | null) => void;
   setE2eKey: (key: CryptoKey | null) => void;
   updateUsers: (users: User[], subChannels: SubChannel[]) => void;
+  setSpeakers: (speakers: string[]) => void;
+  setQuality: (peers: Record<string, Quality | ''>) => void;
+  setConnectionStats: (stats: ConnectionStats | null) => void;
+  setRoomRecording: (recording: RecordingInfo | null) => void;
+  setRoomPTT: (ptt: PTTInfo | null) => void;
+  toggleWhisperTarget: (userId: string) => void;
+  setWhispering: (whispering: boolean) => void;
+  setWhisperFrom: (userId: string, active: boolean) => void;
+  setAllCallFrom: (userId: string | null) => void;
+  answerRecording: (recordingId: string) => void;
+  setVideoStream: (streamId: string, stream: MediaStream | null) => void;
+  clearVideoStreams: () => void;
+  setLocalVideo: (source: VideoSource, active: boolean) => void;
   addChatMessage: (channelId: string, msg: ChatMessage) => void;
   setChatHistory: (channelId: string, messages: ChatMessage[]) => void;
   setMuted: (muted: boolean) => void;
   setOutputMuted: (muted: boolean) => void;
   setSettingsOpen: (open: boolean) => void;
   setPendingInvite: (invite: InviteRequest | null) => void;
+  addListenRequest: (request: ListenRequestPayload) => void;
+  removeListenRequest: (requestId: string) => void;
+  addRecordingDownload: (download: RecordingStoppedPayload) => void;
+  removeRecordingDownload: (recordingId: string) => void;
   setCurrentChannelId: (channelId: string) => void;
   addToast: (message: string) => void;
   removeToast: (id: string) => void;
@@ -108,17 +142,32 @@ const initialState = {
   roomName: null,
   roomFullName: null,
   inviteToken: null,
+  roomOwnerId: null,
+  roomAudioProfile: 'voice',
   currentChannelId: null,
   password: null,
   e2eKey: null,
   users: [],
   subChannels: [],
+  speakers: {} as Record<string, boolean>,
+  connectionStats: null,
+  roomRecording: null,
+  roomPTT: null,
+  whisperTargets: [] as string[],
+  whispering: false,
+  whispersFrom: {} as Record<string, boolean>,
+  allCallFrom: null as string | null,
+  recordingAnswers: {} as Record<string, boolean>,
+  videoStreams: {} as Record<string, MediaStream>,
+  localVideo: {} as Partial<Record<VideoSource, boolean>>,
   chatMessages: {},
   theme: getInitialTheme(),
   muted: false,
   outputMuted: false,
   settingsOpen: false,
   pendingInvite: null,
+  listenRequests: [] as ListenRequestPayload[],
+  recordingDownloads: [] as RecordingStoppedPayload[],
   toasts: [] as Toast[],
   userVolumes: {} as Record<string, number>,
   audioInputDeviceId: localStorage.getItem('qvoch-audio-input') || null,
@@ -150,12 +199,62 @@ export const useStore = create<AppState>((set) => ({
       roomFullName: room.fullName,
       currentChannelId: room.currentChannelId,
       inviteToken: room.inviteToken,
+      roomOwnerId: room.ownerId ?? null,
+      roomAudioProfile: room.audioProfile ?? 'voice',
     }),
 
   setPassword: (password) => set({ password }),
   setE2eKey: (key) => set({ e2eKey: key }),
 
-  updateUsers: (users, subChannels) => set({ users, subChannels }),
+  updateUsers: (users, subChannels) =>
+    set((state) => ({
+      users,
+      subChannels,
+      whisperTargets: state.whisperTargets.filter((id) => users.some((u) => u.id === id)),
+    })),
+  setSpeakers: (speakers) =>
+    set({ speakers: Object.fromEntries(speakers.map((id) => [id, true])) }),
+  setQuality: (peers) =>
+    set((state) => {
+      const apply = (u: User): User =>
+        u.id in peers ? { ...u, quality: peers[u.id] || undefined } : u;
+      return {
+        users: state.users.map(apply),
+        subChannels: state.subChannels.map((sub) => ({ ...sub, users: sub.users.map(apply) })),
+      };
+    }),
+  setConnectionStats: (stats) => set({ connectionStats: stats }),
+  setRoomRecording: (recording) => set({ roomRecording: recording }),
+  setRoomPTT: (ptt) => set({ roomPTT: ptt }),
+  toggleWhisperTarget: (userId) =>
+    set((state) => ({
+      whisperTargets: state.whisperTargets.includes(userId)
+        ? state.whisperTargets.filter((id) => id !== userId)
+        : [...state.whisperTargets, userId],
+    })),
+  setWhispering: (whispering) => set({ whispering }),
+  setWhisperFrom: (userId, active) =>
+    set((state) => {
+      const whispersFrom = { ...state.whispersFrom };
+      if (active) whispersFrom[userId] = true;
+      else delete whispersFrom[userId];
+      return { whispersFrom };
+    }),
+  setAllCallFrom: (userId) => set({ allCallFrom: userId }),
+  answerRecording: (recordingId) =>
+    set((state) => ({
+      recordingAnswers: { ...state.recordingAnswers, [recordingId]: true },
+    })),
+  setVideoStream: (streamId, stream) =>
+    set((state) => {
+      const videoStreams = { ...state.videoStreams };
+      if (stream) videoStreams[streamId] = stream;
+      else delete videoStreams[streamId];
+      return { videoStreams };
+    }),
+  clearVideoStreams: () => set({ videoStreams: {} }),
+  setLocalVideo: (source, active) =>
+    set((state) => ({ localVideo: { ...state.localVideo, [source]: active } })),
 
   addChatMessage: (channelId, msg) =>
     set((state) => ({
@@ -177,7 +276,27 @@ export const useStore = create<AppState>((set) => ({
   setOutputMuted: (muted) => set({ outputMuted: muted }),
   setSettingsOpen: (open) => set({ settingsOpen: open }),
   setPendingInvite: (invite) => set({ pendingInvite: invite }),
-  setCurrentChannelId: (channelId) => set({ currentChannelId: channelId }),
+  addListenRequest: (request) =>
+    set((state) => ({ listenRequests: [...state.listenRequests, request] })),
+  removeListenRequest: (requestId) =>
+    set((state) => ({ listenRequests: state.listenRequests.filter((r) => r.requestId !== requestId) })),
+  addRecordingDownload: (download) =>
+    set((state) => ({
+      recordingDownloads: [
+        ...state.recordingDownloads.filter((d) => d.recordingId !== download.recordingId),
+        download,
+      ],
+    })),
+  removeRecordingDownload: (recordingId) =>
+    set((state) => ({ recordingDownloads: state.recordingDownloads.filter((d) => d.recordingId !== recordingId) })),
+  setCurrentChannelId: (channelId) =>
+    set((state) => (
+      state.currentChannelId === channelId
+        ? {}
+        // The server withdraws recording consent when a peer leaves a
+        // channel, so prompt again after every move.
+        : { currentChannelId: channelId, speakers: {}, recordingAnswers: {} }
+    )),
 
   addToast: (message) =>
     set((state) => ({
@@ -215,3 +334,12 @@ export const useStore = create<AppState>((set) => ({
 
   reset: () => set(initialState),
 }));
+
+// channelPTT returns the push-to-talk state of the user's current channel,
+// or null when the channel has open mics.
+export function channelPTT(
+  state: Pick<AppState, 'roomId' | 'currentChannelId' | 'roomPTT' | 'subChannels'>,
+): PTTInfo | null {
+  if (state.currentChannelId === state.roomId) return state.roomPTT;
+  return state.subChannels.find((c) => c.id === state.currentChannelId)?.ptt ?? null;
+}
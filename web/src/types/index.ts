@@ -4,14 +4,38 @@ export interface User {
   id: string;
   name: string;
   muted: boolean;
+  forceMuted?: boolean;
+  publishing?: VideoSource[];
+  quality?: Quality;
   inSubChannel: string | null;
 }
 
+export type VideoSource = 'screen' | 'camera';
+
+export type Quality = 'good' | 'fair' | 'poor';
+
+export type PTTMode = 'off' | 'open' | 'floor';
+
+export interface PTTInfo {
+  mode: Exclude<PTTMode, 'off'>;
+  talkers: string[];
+}
+
+export interface RecordingInfo {
+  id: string;
+  startedBy: string;
+  startedAt: number;
+}
+
 export interface SubChannel {
   id: string;
   name: string;
+  ownerId?: string;
   users: User[];
   expiresAt?: number;
+  recording?: RecordingInfo;
+  ptt?: PTTInfo;
+  listeners?: string[];
 }
 
 export interface ChatMessage {
@@ -24,14 +48,21 @@ export interface ChatMessage {
   channelId?: string;
 }
 
+export type AudioProfile = 'voice' | 'music';
+
 export interface RoomState {
   id: string;
   name: string;
   fullName: string;
   currentChannelId: string;
+  ownerId?: string;
+  audioProfile?: AudioProfile;
   users: User[];
   subChannels: SubChannel[];
   chatHistory: ChatMessage[];
+  recording?: RecordingInfo;
+  ptt?: PTTInfo;
+  allCall?: string;
 }
 
 export interface InviteRequest {
@@ -54,6 +85,7 @@ export interface CreatePayload {
   username: string;
   channelName: string;
   password: string;
+  audioProfile?: AudioProfile;
 }
 
 export interface JoinPayload {
@@ -86,6 +118,11 @@ export interface MutePayload {
   muted: boolean;
 }
 
+export interface PublishVideoPayload {
+  source: VideoSource;
+  enabled: boolean;
+}
+
 export interface SubInvitePayload {
   targetUserId: string;
   channelName?: string;
@@ -96,12 +133,21 @@ export interface SubResponsePayload {
   accepted: boolean;
 }
 
+export interface RecordingControlPayload {
+  channelId: string;
+}
+
+export interface RecordingConsentPayload {
+  recordingId: string;
+}
+
 // Server -> Client
 
 export interface WelcomePayload {
   userId: string;
   sessionToken: string;
   inviteToken: string;
+  iceServers?: RTCIceServer[];
   roomState: RoomState;
   reconnectNotice?: string;
 }
@@ -109,11 +155,15 @@ export interface WelcomePayload {
 export interface ErrorPayload {
   code: string;
   message: string;
+  retryAfterMs?: number;
+  details?: Record<string, unknown>;
 }
 
 export interface RoomUpdatePayload {
   users: User[];
   subChannels: SubChannel[];
+  recording?: RecordingInfo;
+  ptt?: PTTInfo;
 }
 
 export interface OfferPayload {
@@ -121,6 +171,23 @@ export interface OfferPayload {
   reset?: boolean;
   seq: number;
   epoch: number;
+  video?: Record<string, VideoSource>;
+}
+
+// Sent to the owners of a finished recording. The download URL works once,
+// for a few minutes.
+export interface RecordingStoppedPayload {
+  recordingId: string;
+  channelId: string;
+  channelName: string;
+  downloadUrl: string;
+}
+
+export interface ListenRequestPayload {
+  requestId: string;
+  fromUserId: string;
+  fromName: string;
+  channelId: string;
 }
 
 export interface InviteReqPayload {
@@ -134,3 +201,61 @@ export interface InviteExpiredPayload {
   inviteId: string;
   reason: 'timeout' | 'declined';
 }
+
+export interface ServerShutdownPayload {
+  reason: string;
+  reconnectAfterMs: number;
+}
+
+export interface RemovedPayload {
+  reason: 'kicked' | 'room-closed' | 'channel-closed';
+  message?: string;
+}
+
+export interface ForceMutePayload {
+  muted: boolean;
+  message?: string;
+}
+
+export interface LastNPayload {
+  channelId: string;
+  slots: string[];
+}
+
+export interface SpeakingPayload {
+  channelId: string;
+  speakers: string[];
+}
+
+// Whispered audio arrives on a "whisper-<from>" stream.
+export interface WhisperPayload {
+  from: string;
+  active: boolean;
+}
+
+// The announcer's voice reaches every channel while an all-call is active.
+export interface AllCallPayload {
+  from: string;
+  active: boolean;
+}
+
+export interface QualityPayload {
+  peers: Record<string, Quality | ''>;
+}
+
+export interface CandidatePair {
+  protocol: string;
+  localType: string;
+  remoteType: string;
+}
+
+export interface ConnectionStats {
+  quality: Quality;
+  rttMs: number;
+  uplinkLoss: number;
+  uplinkJitterMs: number;
+  uplinkBitrate: number;
+  downlinkLoss: number;
+  downlinkJitterMs: number;
+  candidatePair?: CandidatePair;
+}